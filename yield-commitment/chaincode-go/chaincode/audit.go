@@ -0,0 +1,138 @@
+package chaincode
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// GetHistoryForKey is not available for private data, so every transaction that changes a
+// commitment, its offers or its auction appends an audit record to the commitmentCollection.
+// Records are keyed by commitment, transaction time and transaction ID so that a partial
+// composite key query returns them in order.
+const auditObjectType = "audit"
+
+// AuditRecord describes a change made to a commitment by a transaction. The hashes are the
+// SHA-256 of the commitment record before and after the transaction, hex encoded. Transactions
+// that only change offers, terms or auctions leave both hashes equal.
+type AuditRecord struct {
+	CommitmentID string `json:"commitmentID"`
+	TxID         string `json:"txID"`
+	Timestamp    string `json:"timestamp"`
+	Submitter    string `json:"submitter"`
+	SubmitterMSP string `json:"submitterMSP"`
+	Action       string `json:"action"`
+	BeforeHash   string `json:"beforeHash"`
+	AfterHash    string `json:"afterHash"`
+}
+
+// hashRecord returns the hex encoded SHA-256 of a record, or an empty string if there is none
+func hashRecord(record []byte) string {
+	if record == nil {
+		return ""
+	}
+	hash := sha256.Sum256(record)
+	return hex.EncodeToString(hash[:])
+}
+
+// txAction returns the name of the invoked transaction, without the contract namespace
+func txAction(ctx contractapi.TransactionContextInterface) string {
+	function, _ := ctx.GetStub().GetFunctionAndParameters()
+	return function[strings.LastIndex(function, ":")+1:]
+}
+
+// recordAudit appends an audit record for the commitment to the commitmentCollection. The
+// record before the transaction is read from the ledger, after is the record written by the
+// transaction, or nil if the transaction leaves the commitment record unchanged.
+func (s *SmartContract) recordAudit(ctx contractapi.TransactionContextInterface, commitmentID string, after []byte) error {
+	commitmentKey, err := objectKey(ctx, commitmentObjectType, commitmentID)
+	if err != nil {
+		return err
+	}
+
+	// Reads return the state before the transaction, even for keys it has written
+	before, err := ctx.GetStub().GetPrivateData(commitmentCollection, commitmentKey)
+	if err != nil {
+		return fmt.Errorf("failed to read commitment: %v", err)
+	}
+	if after == nil {
+		after = before
+	}
+
+	clientID, err := s.submittingClientIdentity(ctx)
+	if err != nil {
+		return err
+	}
+	clientMSP, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return fmt.Errorf("failed to get verified MSPID: %v", err)
+	}
+	timestamp, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+
+	record := AuditRecord{
+		CommitmentID: commitmentID,
+		TxID:         ctx.GetStub().GetTxID(),
+		Timestamp:    timestamp.UTC().Format(time.RFC3339Nano),
+		Submitter:    clientID,
+		SubmitterMSP: clientMSP,
+		Action:       txAction(ctx),
+		BeforeHash:   hashRecord(before),
+		AfterHash:    hashRecord(after),
+	}
+	recordJSON, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal audit record: %v", err)
+	}
+
+	// The zero padded time sorts the records of a commitment chronologically
+	auditKey, err := objectKey(ctx, auditObjectType, commitmentID, fmt.Sprintf("%020d", timestamp.UnixNano()), record.TxID)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("recordAudit Put: collection %v, ID %v, action %v", commitmentCollection, commitmentID, record.Action)
+	err = ctx.GetStub().PutPrivateData(commitmentCollection, auditKey, recordJSON)
+	if err != nil {
+		return fmt.Errorf("failed to put audit record: %v", err)
+	}
+	return nil
+}
+
+// GetCommitmentHistory returns the audit trail of a commitment, oldest change first
+func (s *SmartContract) GetCommitmentHistory(ctx contractapi.TransactionContextInterface, commitmentID string) ([]*AuditRecord, error) {
+	log.Printf("GetCommitmentHistory: collection %v, ID %v", commitmentCollection, commitmentID)
+
+	resultsIterator, err := ctx.GetStub().GetPrivateDataByPartialCompositeKey(commitmentCollection, auditObjectType, []string{commitmentID})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	results := []*AuditRecord{}
+
+	for resultsIterator.HasNext() {
+		response, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var record *AuditRecord
+		err = json.Unmarshal(response.Value, &record)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal JSON: %v", err)
+		}
+
+		results = append(results, record)
+	}
+
+	return results, nil
+}
@@ -0,0 +1,55 @@
+package chaincode
+
+import (
+	"testing"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/stretchr/testify/require"
+)
+
+func (n *testNetwork) history(id string) []*AuditRecord {
+	var history []*AuditRecord
+	err := n.evaluate(n.buyer, func(ctx contractapi.TransactionContextInterface) error {
+		var err error
+		history, err = n.contract.GetCommitmentHistory(ctx, id)
+		return err
+	})
+	require.NoError(n.t, err)
+	return history
+}
+
+func TestGetCommitmentHistory(t *testing.T) {
+	n := newTestNetwork(t)
+	require.Empty(t, n.history("c1"))
+
+	n.createCommitment("c1")
+	n.createCommitment("c10")
+	n.agree("c1", n.buyer)
+	n.mustSubmit(n.producer, "TransferCommitment", transient{"commitment_owner": map[string]string{"commitmentID": "c1", "buyerMSP": "Org2MSP", "buyerID": n.buyer.ID()}})
+
+	history := n.history("c1")
+	actions := []string{}
+	for _, record := range history {
+		require.Equal(t, "c1", record.CommitmentID)
+		require.NotEmpty(t, record.TxID)
+		actions = append(actions, record.Action)
+	}
+	require.Equal(t, []string{"CreateCommitment", "AgreeToSell", "AgreeToTransfer", "TransferCommitment"}, actions)
+
+	// Each change starts from the record the previous one left, setting terms leaves it unchanged
+	created, terms, offered, transferred := history[0], history[1], history[2], history[3]
+	require.Empty(t, created.BeforeHash)
+	require.Equal(t, created.AfterHash, terms.BeforeHash)
+	require.Equal(t, terms.BeforeHash, terms.AfterHash)
+	require.Equal(t, terms.AfterHash, offered.BeforeHash)
+	require.NotEqual(t, offered.BeforeHash, offered.AfterHash)
+	require.Equal(t, offered.AfterHash, transferred.BeforeHash)
+
+	require.Equal(t, n.producer.ID(), created.Submitter)
+	require.Equal(t, "Org1MSP", created.SubmitterMSP)
+	require.Equal(t, n.buyer.ID(), offered.Submitter)
+	require.Equal(t, "Org2MSP", offered.SubmitterMSP)
+	require.True(t, created.Timestamp < offered.Timestamp, "%v is not before %v", created.Timestamp, offered.Timestamp)
+
+	require.Len(t, n.history("c10"), 1)
+}
@@ -0,0 +1,700 @@
+package chaincode
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+const auctionObjectType = "auction"
+const sealedBidObjectType = "sealedBid"
+const bidObjectType = "bid"
+
+// Auction states. Bids are submitted while the auction is open, revealed once the owner
+// has closed it after the deadline, and the winner is recorded when the auction ends.
+const (
+	AuctionOpen   = "open"
+	AuctionClosed = "closed"
+	AuctionEnded  = "ended"
+)
+
+// auctionSettlementPeriod is the time the winner of an auction has to make their offer at the
+// winning rate. Once it has passed without an offer the seller can cancel the auction.
+const auctionSettlementPeriod = 7 * 24 * time.Hour
+
+// minBidSaltLength is the length a bid salt must have, 128 bits when hex encoded, so that
+// the sealed bid cannot be opened by hashing candidate rates with every short salt
+const minBidSaltLength = 32
+
+// Auction describes a sealed-bid auction on the rate of a commitment. It is stored in the
+// commitmentCollection and only holds bid hashes until the bids are revealed. Bids are
+// revealed between the deadline and the reveal deadline, and the winner has until the
+// settlement deadline to make their offer.
+type Auction struct {
+	CommitmentID       string         `json:"commitmentID"`
+	Seller             string         `json:"seller"`
+	Deadline           string         `json:"deadline"`
+	RevealDeadline     string         `json:"revealDeadline"`
+	Status             string         `json:"status"`
+	Bidders            []string       `json:"bidders"`
+	RevealedBids       []*RevealedBid `json:"revealedBids"`
+	Winner             string         `json:"winner"`
+	WinningRate        int            `json:"winningRate"`
+	SettlementDeadline string         `json:"settlementDeadline"`
+}
+
+// SealedBid is the salted hash of a bid, stored in the commitmentCollection
+type SealedBid struct {
+	CommitmentID string `json:"commitmentID"`
+	Bidder       string `json:"bidder"`
+	BidderMSP    string `json:"bidderMSP"`
+	Hash         string `json:"hash"`
+}
+
+// RevealedBid is a bid that has been revealed and verified against its sealed hash
+type RevealedBid struct {
+	Bidder    string `json:"bidder"`
+	BidderMSP string `json:"bidderMSP"`
+	Rate      int    `json:"rate"`
+}
+
+// bidDetails are the bid terms stored in the bidder's org collection. The salt keeps other
+// channel members from recovering the rate by hashing candidate values.
+type bidDetails struct {
+	CommitmentID string `json:"commitmentID"`
+	Rate         int    `json:"rate"`
+	Salt         string `json:"salt"`
+}
+
+// readAuction returns the auction on a commitment, or nil if there is none
+func readAuction(ctx contractapi.TransactionContextInterface, commitmentID string) (*Auction, error) {
+	auctionKey, err := objectKey(ctx, auctionObjectType, commitmentID)
+	if err != nil {
+		return nil, err
+	}
+
+	auctionJSON, err := ctx.GetStub().GetPrivateData(commitmentCollection, auctionKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read auction: %v", err)
+	}
+	if auctionJSON == nil {
+		return nil, nil
+	}
+
+	var auction *Auction
+	err = json.Unmarshal(auctionJSON, &auction)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal JSON: %v", err)
+	}
+	return auction, nil
+}
+
+// putAuction writes the auction to the commitmentCollection
+func putAuction(ctx contractapi.TransactionContextInterface, auction *Auction) error {
+	auctionJSON, err := json.Marshal(auction)
+	if err != nil {
+		return fmt.Errorf("failed to marshal auction: %v", err)
+	}
+
+	auctionKey, err := objectKey(ctx, auctionObjectType, auction.CommitmentID)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Put: collection %v, auction %v, status %v", commitmentCollection, auction.CommitmentID, auction.Status)
+	return ctx.GetStub().PutPrivateData(commitmentCollection, auctionKey, auctionJSON)
+}
+
+// deleteAuction removes the auction and its sealed bids from the commitmentCollection
+func deleteAuction(ctx contractapi.TransactionContextInterface, auction *Auction) error {
+	for _, bidder := range auction.Bidders {
+		sealedBidKey, err := objectKey(ctx, sealedBidObjectType, auction.CommitmentID, bidder)
+		if err != nil {
+			return err
+		}
+		err = ctx.GetStub().DelPrivateData(commitmentCollection, sealedBidKey)
+		if err != nil {
+			return fmt.Errorf("failed to delete sealed bid: %v", err)
+		}
+	}
+
+	auctionKey, err := objectKey(ctx, auctionObjectType, auction.CommitmentID)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Deleting auction: %v", auction.CommitmentID)
+	return ctx.GetStub().DelPrivateData(commitmentCollection, auctionKey)
+}
+
+// revealWindowOpen reports whether bids on the auction can still be revealed. Auctions opened
+// before reveal deadlines were introduced have no reveal window.
+func revealWindowOpen(auction *Auction, now time.Time) (bool, error) {
+	if auction.RevealDeadline == "" {
+		return false, nil
+	}
+	revealDeadline, err := time.Parse(time.RFC3339, auction.RevealDeadline)
+	if err != nil {
+		return false, fmt.Errorf("invalid auction reveal deadline: %v", err)
+	}
+	return !now.After(revealDeadline), nil
+}
+
+// checkSettlementPassed returns an error while the winner of an ended auction can still make
+// their offer. Auctions ended before settlement deadlines were introduced have none.
+func checkSettlementPassed(ctx contractapi.TransactionContextInterface, auction *Auction) error {
+	if auction.SettlementDeadline == "" {
+		return nil
+	}
+	settlementDeadline, err := time.Parse(time.RFC3339, auction.SettlementDeadline)
+	if err != nil {
+		return fmt.Errorf("invalid auction settlement deadline: %v", err)
+	}
+	now, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+	if !now.After(settlementDeadline) {
+		return fmt.Errorf("the winner of the auction for commitment %v has until %v to make an offer", auction.CommitmentID, auction.SettlementDeadline)
+	}
+	return nil
+}
+
+// txTime returns the timestamp of the transaction proposal
+func txTime(ctx contractapi.TransactionContextInterface) (time.Time, error) {
+	timestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to get transaction timestamp: %v", err)
+	}
+	return time.Unix(timestamp.Seconds, int64(timestamp.Nanos)), nil
+}
+
+// readBidInput reads the bid terms from the transient map
+func readBidInput(ctx contractapi.TransactionContextInterface) (*bidDetails, error) {
+	transientMap, err := ctx.GetStub().GetTransient()
+	if err != nil {
+		return nil, fmt.Errorf("error getting transient: %v", err)
+	}
+
+	// Bids are private until revealed, therefore they get passed in transient field
+	transientBidJSON, ok := transientMap["bid"]
+	if !ok {
+		return nil, fmt.Errorf("bid not found in the transient map")
+	}
+
+	var bid bidDetails
+	err = json.Unmarshal(transientBidJSON, &bid)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal JSON: %v", err)
+	}
+
+	if len(bid.CommitmentID) == 0 {
+		return nil, fmt.Errorf("commitmentID field must be a non-empty string")
+	}
+	if bid.Rate <= 0 {
+		return nil, fmt.Errorf("rate field must be a positive integer")
+	}
+	if len(bid.Salt) < minBidSaltLength {
+		return nil, fmt.Errorf("salt field must be at least %v characters long", minBidSaltLength)
+	}
+	return &bid, nil
+}
+
+// OpenAuction is used by the owner of a commitment to start a sealed-bid auction on its rate.
+// Bids can be submitted until the deadline and revealed until the reveal deadline, both RFC3339 times.
+func (s *SmartContract) OpenAuction(ctx contractapi.TransactionContextInterface) error {
+
+	transientMap, err := ctx.GetStub().GetTransient()
+	if err != nil {
+		return fmt.Errorf("error getting transient: %v", err)
+	}
+
+	transientAuctionJSON, ok := transientMap["auction_properties"]
+	if !ok {
+		return fmt.Errorf("auction properties not found in the transient map")
+	}
+
+	type auctionTransientInput struct {
+		ID             string `json:"commitmentID"`
+		Deadline       string `json:"deadline"`
+		RevealDeadline string `json:"revealDeadline"`
+	}
+
+	var auctionInput auctionTransientInput
+	err = json.Unmarshal(transientAuctionJSON, &auctionInput)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal JSON: %v", err)
+	}
+
+	if len(auctionInput.ID) == 0 {
+		return fmt.Errorf("commitmentID field must be a non-empty string")
+	}
+	deadline, err := time.Parse(time.RFC3339, auctionInput.Deadline)
+	if err != nil {
+		return fmt.Errorf("deadline field must be an RFC3339 time: %v", err)
+	}
+	revealDeadline, err := time.Parse(time.RFC3339, auctionInput.RevealDeadline)
+	if err != nil {
+		return fmt.Errorf("revealDeadline field must be an RFC3339 time: %v", err)
+	}
+	if !revealDeadline.After(deadline) {
+		return fmt.Errorf("revealDeadline must be after the deadline")
+	}
+
+	now, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+	if !deadline.After(now) {
+		return fmt.Errorf("auction deadline %v has already passed", auctionInput.Deadline)
+	}
+
+	// Verify that the client is submitting request to peer in their organization
+	err = s.verifyClientOrgMatchesPeerOrg(ctx)
+	if err != nil {
+		return fmt.Errorf("OpenAuction cannot be performed: Error %v", err)
+	}
+
+	commitment, err := s.ReadCommitment(ctx, auctionInput.ID)
+	if err != nil {
+		return fmt.Errorf("error reading commitment: %v", err)
+	}
+	if commitment == nil {
+		return fmt.Errorf("%v does not exist", auctionInput.ID)
+	}
+
+	clientID, err := s.submittingClientIdentity(ctx)
+	if err != nil {
+		return err
+	}
+	if clientID != commitment.Owner {
+		return fmt.Errorf("error: submitting client identity does not own commitment")
+	}
+
+	// Offers made outside of the auction would compete with the winner
+	if !isTradeable(commitment) {
+		return fmt.Errorf("commitment %v is %v and cannot be auctioned", auctionInput.ID, commitmentStatus(commitment))
+	}
+
+	existing, err := readAuction(ctx, auctionInput.ID)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		return fmt.Errorf("an auction already exists for commitment %v", auctionInput.ID)
+	}
+
+	auction := &Auction{
+		CommitmentID:   auctionInput.ID,
+		Seller:         clientID,
+		Deadline:       auctionInput.Deadline,
+		RevealDeadline: auctionInput.RevealDeadline,
+		Status:         AuctionOpen,
+		Bidders:        []string{},
+		RevealedBids:   []*RevealedBid{},
+	}
+	err = s.recordAudit(ctx, auction.CommitmentID, nil)
+	if err != nil {
+		return err
+	}
+	return putAuction(ctx, auction)
+}
+
+// SubmitBid is used by a buyer to place a sealed bid. The bid details are stored in the
+// buyer's org collection and only their salted hash is stored in the commitmentCollection.
+// Submitting again before the deadline replaces the buyer's bid.
+func (s *SmartContract) SubmitBid(ctx contractapi.TransactionContextInterface) error {
+
+	bid, err := readBidInput(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Verify that the client is submitting request to peer in their organization
+	err = s.verifyClientOrgMatchesPeerOrg(ctx)
+	if err != nil {
+		return fmt.Errorf("SubmitBid cannot be performed: Error %v", err)
+	}
+
+	auction, err := readAuction(ctx, bid.CommitmentID)
+	if err != nil {
+		return err
+	}
+	if auction == nil {
+		return fmt.Errorf("no auction exists for commitment %v", bid.CommitmentID)
+	}
+	if auction.Status != AuctionOpen {
+		return fmt.Errorf("auction for commitment %v is %v and does not accept bids", bid.CommitmentID, auction.Status)
+	}
+
+	deadline, err := time.Parse(time.RFC3339, auction.Deadline)
+	if err != nil {
+		return fmt.Errorf("invalid auction deadline: %v", err)
+	}
+	now, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+	if now.After(deadline) {
+		return fmt.Errorf("auction for commitment %v closed for bids at %v", bid.CommitmentID, auction.Deadline)
+	}
+
+	clientID, err := s.submittingClientIdentity(ctx)
+	if err != nil {
+		return err
+	}
+	if clientID == auction.Seller {
+		return fmt.Errorf("error: the seller cannot bid on their own commitment")
+	}
+	clientMSP, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return fmt.Errorf("failed to get verified MSPID: %v", err)
+	}
+
+	bidJSON, err := json.Marshal(bid)
+	if err != nil {
+		return fmt.Errorf("failed to marshal bid: %v", err)
+	}
+	bidHash := sha256.Sum256(bidJSON)
+
+	orgCollection, err := s.getCollectionName(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to infer private collection name for the org: %v", err)
+	}
+
+	bidKey, err := objectKey(ctx, bidObjectType, bid.CommitmentID, clientID)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("SubmitBid Put: collection %v, ID %v", orgCollection, bid.CommitmentID)
+	err = ctx.GetStub().PutPrivateData(orgCollection, bidKey, bidJSON)
+	if err != nil {
+		return fmt.Errorf("failed to put bid: %v", err)
+	}
+
+	sealedBid := SealedBid{
+		CommitmentID: bid.CommitmentID,
+		Bidder:       clientID,
+		BidderMSP:    clientMSP,
+		Hash:         hex.EncodeToString(bidHash[:]),
+	}
+	sealedBidJSON, err := json.Marshal(sealedBid)
+	if err != nil {
+		return fmt.Errorf("failed to marshal sealed bid: %v", err)
+	}
+
+	sealedBidKey, err := objectKey(ctx, sealedBidObjectType, bid.CommitmentID, clientID)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("SubmitBid Put: collection %v, ID %v", commitmentCollection, bid.CommitmentID)
+	err = ctx.GetStub().PutPrivateData(commitmentCollection, sealedBidKey, sealedBidJSON)
+	if err != nil {
+		return fmt.Errorf("failed to put sealed bid: %v", err)
+	}
+
+	auction.Bidders = append(removeOffer(auction.Bidders, clientID), clientID)
+	err = s.recordAudit(ctx, auction.CommitmentID, nil)
+	if err != nil {
+		return err
+	}
+	return putAuction(ctx, auction)
+}
+
+// CloseAuction is used by the seller once the deadline has passed to stop accepting bids
+// and allow bidders to reveal them
+func (s *SmartContract) CloseAuction(ctx contractapi.TransactionContextInterface, commitmentID string) error {
+
+	// Verify that the client is submitting request to peer in their organization
+	err := s.verifyClientOrgMatchesPeerOrg(ctx)
+	if err != nil {
+		return fmt.Errorf("CloseAuction cannot be performed: Error %v", err)
+	}
+
+	auction, err := readAuction(ctx, commitmentID)
+	if err != nil {
+		return err
+	}
+	if auction == nil {
+		return fmt.Errorf("no auction exists for commitment %v", commitmentID)
+	}
+	if auction.Status != AuctionOpen {
+		return fmt.Errorf("auction for commitment %v is already %v", commitmentID, auction.Status)
+	}
+
+	clientID, err := s.submittingClientIdentity(ctx)
+	if err != nil {
+		return err
+	}
+	if clientID != auction.Seller {
+		return fmt.Errorf("error: only the seller can close the auction")
+	}
+
+	deadline, err := time.Parse(time.RFC3339, auction.Deadline)
+	if err != nil {
+		return fmt.Errorf("invalid auction deadline: %v", err)
+	}
+	now, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+	if !now.After(deadline) {
+		return fmt.Errorf("auction for commitment %v cannot be closed before %v", commitmentID, auction.Deadline)
+	}
+
+	auction.Status = AuctionClosed
+	err = s.recordAudit(ctx, auction.CommitmentID, nil)
+	if err != nil {
+		return err
+	}
+	return putAuction(ctx, auction)
+}
+
+// RevealBid is used by a bidder after the auction closed to reveal their bid, up to the reveal
+// deadline. The revealed terms must hash to the sealed bid in the commitmentCollection, and to
+// the bid details held in the bidder's org collection unless these have already been purged.
+func (s *SmartContract) RevealBid(ctx contractapi.TransactionContextInterface) error {
+
+	bid, err := readBidInput(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Verify that the client is submitting request to peer in their organization
+	err = s.verifyClientOrgMatchesPeerOrg(ctx)
+	if err != nil {
+		return fmt.Errorf("RevealBid cannot be performed: Error %v", err)
+	}
+
+	auction, err := readAuction(ctx, bid.CommitmentID)
+	if err != nil {
+		return err
+	}
+	if auction == nil {
+		return fmt.Errorf("no auction exists for commitment %v", bid.CommitmentID)
+	}
+	if auction.Status != AuctionClosed {
+		return fmt.Errorf("auction for commitment %v is %v, bids can only be revealed once it is closed", bid.CommitmentID, auction.Status)
+	}
+	now, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+	if auction.RevealDeadline != "" {
+		open, err := revealWindowOpen(auction, now)
+		if err != nil {
+			return err
+		}
+		if !open {
+			return fmt.Errorf("bids on commitment %v could only be revealed until %v", bid.CommitmentID, auction.RevealDeadline)
+		}
+	}
+
+	clientID, err := s.submittingClientIdentity(ctx)
+	if err != nil {
+		return err
+	}
+	for _, revealed := range auction.RevealedBids {
+		if revealed.Bidder == clientID {
+			return fmt.Errorf("bid on %v has already been revealed", bid.CommitmentID)
+		}
+	}
+
+	sealedBidKey, err := objectKey(ctx, sealedBidObjectType, bid.CommitmentID, clientID)
+	if err != nil {
+		return err
+	}
+	sealedBidJSON, err := ctx.GetStub().GetPrivateData(commitmentCollection, sealedBidKey)
+	if err != nil {
+		return fmt.Errorf("failed to read sealed bid: %v", err)
+	}
+	if sealedBidJSON == nil {
+		return fmt.Errorf("no sealed bid on %v from submitting client", bid.CommitmentID)
+	}
+	var sealedBid SealedBid
+	err = json.Unmarshal(sealedBidJSON, &sealedBid)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal JSON: %v", err)
+	}
+
+	bidJSON, err := json.Marshal(bid)
+	if err != nil {
+		return fmt.Errorf("failed to marshal bid: %v", err)
+	}
+	revealedHash := sha256.Sum256(bidJSON)
+
+	// Check 1: the revealed terms match the sealed bid published before the deadline
+	if hex.EncodeToString(revealedHash[:]) != sealedBid.Hash {
+		return fmt.Errorf("revealed bid does not match the sealed bid on %v", bid.CommitmentID)
+	}
+
+	// Check 2: the revealed terms match the bid details held in the bidder's org collection.
+	// Org collections keep private data for a few blocks only, so the details of a bid placed
+	// well before the deadline are usually purged by now and the sealed bid is all there is.
+	bidderCollection := s.topology().OrgCollection(sealedBid.BidderMSP)
+	bidKey, err := objectKey(ctx, bidObjectType, bid.CommitmentID, clientID)
+	if err != nil {
+		return err
+	}
+	bidderHash, err := ctx.GetStub().GetPrivateDataHash(bidderCollection, bidKey)
+	if err != nil {
+		return fmt.Errorf("failed to get hash of bid from collection %v: %v", bidderCollection, err)
+	}
+	if bidderHash != nil && !bytes.Equal(bidderHash, revealedHash[:]) {
+		return fmt.Errorf("revealed bid does not match the bid in collection %v", bidderCollection)
+	}
+
+	auction.RevealedBids = append(auction.RevealedBids, &RevealedBid{
+		Bidder:    clientID,
+		BidderMSP: sealedBid.BidderMSP,
+		Rate:      bid.Rate,
+	})
+	err = s.recordAudit(ctx, auction.CommitmentID, nil)
+	if err != nil {
+		return err
+	}
+	return putAuction(ctx, auction)
+}
+
+// EndAuction is used by the seller to determine the winner among the revealed bids, once
+// every bid has been revealed or the reveal deadline has passed. The highest rate wins, ties
+// go to the bid revealed first. The seller and the winner then complete the purchase at the
+// winning rate with AgreeToSell and AgreeToTransfer, followed by TransferCommitment. Without
+// any revealed bid the auction is removed.
+func (s *SmartContract) EndAuction(ctx contractapi.TransactionContextInterface, commitmentID string) error {
+
+	// Verify that the client is submitting request to peer in their organization
+	err := s.verifyClientOrgMatchesPeerOrg(ctx)
+	if err != nil {
+		return fmt.Errorf("EndAuction cannot be performed: Error %v", err)
+	}
+
+	auction, err := readAuction(ctx, commitmentID)
+	if err != nil {
+		return err
+	}
+	if auction == nil {
+		return fmt.Errorf("no auction exists for commitment %v", commitmentID)
+	}
+	if auction.Status != AuctionClosed {
+		return fmt.Errorf("auction for commitment %v is %v and cannot be ended", commitmentID, auction.Status)
+	}
+
+	clientID, err := s.submittingClientIdentity(ctx)
+	if err != nil {
+		return err
+	}
+	if clientID != auction.Seller {
+		return fmt.Errorf("error: only the seller can end the auction")
+	}
+
+	// The seller cannot cut the reveal window short to exclude bids that are yet to be revealed
+	now, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+	revealing, err := revealWindowOpen(auction, now)
+	if err != nil {
+		return err
+	}
+	if revealing && len(auction.RevealedBids) < len(auction.Bidders) {
+		return fmt.Errorf("auction for commitment %v cannot be ended before %v while bids are unrevealed", commitmentID, auction.RevealDeadline)
+	}
+
+	var winner *RevealedBid
+	for _, revealed := range auction.RevealedBids {
+		if winner == nil || revealed.Rate > winner.Rate {
+			winner = revealed
+		}
+	}
+	if winner == nil {
+		err = s.recordAudit(ctx, auction.CommitmentID, nil)
+		if err != nil {
+			return err
+		}
+		return deleteAuction(ctx, auction)
+	}
+
+	auction.Status = AuctionEnded
+	auction.Winner = winner.Bidder
+	auction.WinningRate = winner.Rate
+	auction.SettlementDeadline = now.Add(auctionSettlementPeriod).UTC().Format(time.RFC3339)
+
+	log.Printf("EndAuction: commitment %v, winner %v", commitmentID, winner.Bidder)
+	err = s.recordAudit(ctx, auction.CommitmentID, nil)
+	if err != nil {
+		return err
+	}
+	return putAuction(ctx, auction)
+}
+
+// CancelAuction is used by the seller to withdraw an auction that nobody has bid on, or an
+// ended auction whose winner has not made their offer by the settlement deadline. The
+// commitment is then open to offers and new auctions again.
+func (s *SmartContract) CancelAuction(ctx contractapi.TransactionContextInterface, commitmentID string) error {
+
+	// Verify that the client is submitting request to peer in their organization
+	err := s.verifyClientOrgMatchesPeerOrg(ctx)
+	if err != nil {
+		return fmt.Errorf("CancelAuction cannot be performed: Error %v", err)
+	}
+
+	auction, err := readAuction(ctx, commitmentID)
+	if err != nil {
+		return err
+	}
+	if auction == nil {
+		return fmt.Errorf("no auction exists for commitment %v", commitmentID)
+	}
+
+	clientID, err := s.submittingClientIdentity(ctx)
+	if err != nil {
+		return err
+	}
+	if clientID != auction.Seller {
+		return fmt.Errorf("error: only the seller can cancel the auction")
+	}
+
+	if auction.Status != AuctionEnded {
+		if len(auction.Bidders) > 0 {
+			return fmt.Errorf("auction for commitment %v has bids and can only be cancelled once it has ended", commitmentID)
+		}
+	} else {
+		offerKey, err := transferAgreementKey(ctx, commitmentID, auction.Winner)
+		if err != nil {
+			return err
+		}
+		offerJSON, err := ctx.GetStub().GetPrivateData(commitmentCollection, offerKey)
+		if err != nil {
+			return fmt.Errorf("failed to read transfer agreement: %v", err)
+		}
+		if offerJSON != nil {
+			return fmt.Errorf("the winner of the auction for commitment %v has made an offer", commitmentID)
+		}
+
+		err = checkSettlementPassed(ctx, auction)
+		if err != nil {
+			return err
+		}
+	}
+
+	log.Printf("CancelAuction: commitment %v, status %v", commitmentID, auction.Status)
+	err = s.recordAudit(ctx, auction.CommitmentID, nil)
+	if err != nil {
+		return err
+	}
+	return deleteAuction(ctx, auction)
+}
+
+// ReadAuction returns the auction on a commitment
+func (s *SmartContract) ReadAuction(ctx contractapi.TransactionContextInterface, commitmentID string) (*Auction, error) {
+	return readAuction(ctx, commitmentID)
+}
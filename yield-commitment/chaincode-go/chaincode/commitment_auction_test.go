@@ -0,0 +1,281 @@
+package chaincode
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/hyperledger/fabric-samples/yield-commitment/chaincode-go/simulator"
+	"github.com/stretchr/testify/require"
+)
+
+// The auctions of these tests take bids on the first day of the simulated ledger and bids
+// are revealed on the second day
+var (
+	auctionDeadline       = time.Date(2020, time.January, 2, 0, 0, 0, 0, time.UTC)
+	auctionRevealDeadline = time.Date(2020, time.January, 3, 0, 0, 0, 0, time.UTC)
+)
+
+func auctionInput(id string) map[string]interface{} {
+	return map[string]interface{}{
+		"commitmentID":   id,
+		"deadline":       auctionDeadline.Format(time.RFC3339),
+		"revealDeadline": auctionRevealDeadline.Format(time.RFC3339),
+	}
+}
+
+// Bid salts are 128 bits, hex encoded
+const (
+	buyerBidSalt = "b1e2c3d4a5f60718293a4b5c6d7e8f90"
+	rivalBidSalt = "a9c8e7d6b5f4031201f2e3d4c5b6a798"
+)
+
+func bidInput(id string, rate int, salt string) transient {
+	return transient{"bid": map[string]interface{}{"commitmentID": id, "rate": rate, "salt": salt}}
+}
+
+// auctionCall runs CloseAuction, EndAuction or CancelAuction as the client
+func (n *testNetwork) auctionCall(client *simulator.Client, function string, id string) error {
+	return n.call(client, function, func(ctx contractapi.TransactionContextInterface) error {
+		switch function {
+		case "CloseAuction":
+			return n.contract.CloseAuction(ctx, id)
+		case "EndAuction":
+			return n.contract.EndAuction(ctx, id)
+		default:
+			return n.contract.CancelAuction(ctx, id)
+		}
+	})
+}
+
+// readAuction returns the committed auction on a commitment
+func (n *testNetwork) readAuction(id string) *Auction {
+	var auction *Auction
+	err := n.evaluate(n.producer, func(ctx contractapi.TransactionContextInterface) error {
+		var err error
+		auction, err = n.contract.ReadAuction(ctx, id)
+		return err
+	})
+	require.NoError(n.t, err)
+	return auction
+}
+
+// closedAuction opens an auction on c1 with bids of 5000 by the buyer and 6000 by the rival, and closes it
+func closedAuction(n *testNetwork) {
+	n.createCommitment("c1")
+	n.mustSubmit(n.producer, "OpenAuction", transient{"auction_properties": auctionInput("c1")})
+	n.mustSubmit(n.buyer, "SubmitBid", bidInput("c1", 5000, buyerBidSalt))
+	n.mustSubmit(n.rival, "SubmitBid", bidInput("c1", 6000, rivalBidSalt))
+
+	n.ledger.SetTime(auctionDeadline.Add(time.Hour))
+	require.NoError(n.t, n.auctionCall(n.producer, "CloseAuction", "c1"))
+}
+
+func TestOpenAuction(t *testing.T) {
+	setup := func(n *testNetwork) { n.createCommitment("c1") }
+
+	runTransactionCases(t, "OpenAuction", setup, []transactionCase{
+		{
+			name:  "missing reveal deadline",
+			input: transient{"auction_properties": with(auctionInput("c1"), "revealDeadline", nil)},
+			err:   "revealDeadline field must be an RFC3339 time",
+		},
+		{
+			name:  "reveal deadline before the deadline",
+			input: transient{"auction_properties": with(auctionInput("c1"), "revealDeadline", auctionDeadline.Add(-time.Hour).Format(time.RFC3339))},
+			err:   "revealDeadline must be after the deadline",
+		},
+		{
+			name:  "deadline passed",
+			setup: func(n *testNetwork) { n.ledger.SetTime(auctionDeadline.Add(time.Hour)) },
+			input: transient{"auction_properties": auctionInput("c1")},
+			err:   "has already passed",
+		},
+		{
+			name:   "not the owner",
+			client: otherOrg1,
+			input:  transient{"auction_properties": auctionInput("c1")},
+			err:    "submitting client identity does not own commitment",
+		},
+		{
+			name:  "auction",
+			input: transient{"auction_properties": auctionInput("c1")},
+			check: func(t *testing.T, n *testNetwork) {
+				auction := n.readAuction("c1")
+				require.Equal(t, AuctionOpen, auction.Status)
+				require.Equal(t, "2020-01-03T00:00:00Z", auction.RevealDeadline)
+
+				// Offers outside of the auction are not accepted
+				err := n.submit(n.buyer, "AgreeToTransfer", transient{"commitment_value": termsInput("c1")})
+				require.Error(t, err)
+				require.Contains(t, err.Error(), "an auction is in progress on commitment c1")
+			},
+		},
+	})
+}
+
+func TestSubmitBid(t *testing.T) {
+	setup := func(n *testNetwork) {
+		n.createCommitment("c1")
+		n.mustSubmit(n.producer, "OpenAuction", transient{"auction_properties": auctionInput("c1")})
+	}
+
+	runTransactionCases(t, "SubmitBid", setup, []transactionCase{
+		{
+			name:   "short salt",
+			client: buyer,
+			input:  bidInput("c1", 5000, "b1"),
+			err:    "salt field must be at least 32 characters long",
+		},
+		{
+			name:  "seller",
+			input: bidInput("c1", 5000, buyerBidSalt),
+			err:   "error: the seller cannot bid on their own commitment",
+		},
+		{
+			name:   "bid",
+			client: buyer,
+			input:  bidInput("c1", 5000, buyerBidSalt),
+			check: func(t *testing.T, n *testNetwork) {
+				require.Equal(t, []string{n.buyer.ID()}, n.readAuction("c1").Bidders)
+				require.Len(t, n.ledger.PrivateDataKeys("Org2MSPPrivateCollection"), 1)
+			},
+		},
+	})
+}
+
+func TestRevealBid(t *testing.T) {
+	runTransactionCases(t, "RevealBid", closedAuction, []transactionCase{
+		{
+			name:   "rate that was not bid",
+			client: buyer,
+			input:  bidInput("c1", 7000, buyerBidSalt),
+			err:    "revealed bid does not match the sealed bid on c1",
+		},
+		{
+			name:   "bid",
+			client: buyer,
+			input:  bidInput("c1", 5000, buyerBidSalt),
+			check: func(t *testing.T, n *testNetwork) {
+				require.Equal(t, []*RevealedBid{{Bidder: n.buyer.ID(), BidderMSP: "Org2MSP", Rate: 5000}}, n.readAuction("c1").RevealedBids)
+			},
+		},
+		{
+			name: "bid whose details were purged from the org collection",
+			setup: func(n *testNetwork) {
+				require.NoError(n.t, n.call(n.buyer, "purge", func(ctx contractapi.TransactionContextInterface) error {
+					bidKey, err := objectKey(ctx, bidObjectType, "c1", n.buyer.ID())
+					require.NoError(n.t, err)
+					return ctx.GetStub().DelPrivateData("Org2MSPPrivateCollection", bidKey)
+				}))
+				require.Len(n.t, n.ledger.PrivateDataKeys("Org2MSPPrivateCollection"), 1)
+			},
+			client: buyer,
+			input:  bidInput("c1", 5000, buyerBidSalt),
+			check: func(t *testing.T, n *testNetwork) {
+				require.Len(t, n.readAuction("c1").RevealedBids, 1)
+			},
+		},
+	})
+}
+
+func TestEndAuctionWaitsForReveals(t *testing.T) {
+	n := newTestNetwork(t)
+	closedAuction(n)
+	n.mustSubmit(n.buyer, "RevealBid", bidInput("c1", 5000, buyerBidSalt))
+
+	// The rival's higher bid is still to be revealed
+	err := n.auctionCall(n.producer, "EndAuction", "c1")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "auction for commitment c1 cannot be ended before 2020-01-03T00:00:00Z while bids are unrevealed")
+
+	n.mustSubmit(n.rival, "RevealBid", bidInput("c1", 6000, rivalBidSalt))
+	require.NoError(t, n.auctionCall(n.producer, "EndAuction", "c1"))
+
+	auction := n.readAuction("c1")
+	require.Equal(t, AuctionEnded, auction.Status)
+	require.Equal(t, n.rival.ID(), auction.Winner)
+	require.Equal(t, 6000, auction.WinningRate)
+}
+
+func TestEndAuctionAfterRevealDeadline(t *testing.T) {
+	n := newTestNetwork(t)
+	closedAuction(n)
+	n.mustSubmit(n.buyer, "RevealBid", bidInput("c1", 5000, buyerBidSalt))
+
+	n.ledger.SetTime(auctionRevealDeadline.Add(time.Hour))
+	err := n.submit(n.rival, "RevealBid", bidInput("c1", 6000, rivalBidSalt))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "bids on commitment c1 could only be revealed until 2020-01-03T00:00:00Z")
+
+	n.ledger.SetTime(auctionRevealDeadline.Add(2 * time.Hour))
+	require.NoError(t, n.auctionCall(n.producer, "EndAuction", "c1"))
+	auction := n.readAuction("c1")
+	require.Equal(t, n.buyer.ID(), auction.Winner)
+	require.Equal(t, 5000, auction.WinningRate)
+	require.Equal(t, "2020-01-10T02:00:00Z", auction.SettlementDeadline)
+
+	// The winner completes the purchase at the winning rate
+	winningTerms := transient{"commitment_value": with(termsInput("c1"), "rate", 5000)}
+	require.Error(t, n.submit(n.rival, "AgreeToTransfer", winningTerms))
+	n.mustSubmit(n.producer, "AgreeToSell", winningTerms)
+	n.mustSubmit(n.buyer, "AgreeToTransfer", winningTerms)
+	n.mustSubmit(n.producer, "TransferCommitment", transient{"commitment_owner": map[string]string{"commitmentID": "c1", "buyerMSP": "Org2MSP", "buyerID": n.buyer.ID()}})
+	require.Equal(t, n.buyer.ID(), n.readCommitment("c1").Owner)
+	require.Nil(t, n.readAuction("c1"))
+}
+
+func TestCancelAuction(t *testing.T) {
+	t.Run("without bids", func(t *testing.T) {
+		n := newTestNetwork(t)
+		n.createCommitment("c1")
+		n.mustSubmit(n.producer, "OpenAuction", transient{"auction_properties": auctionInput("c1")})
+
+		err := n.auctionCall(n.other, "CancelAuction", "c1")
+		require.EqualError(t, err, "error: only the seller can cancel the auction")
+
+		require.NoError(t, n.auctionCall(n.producer, "CancelAuction", "c1"))
+		require.Nil(t, n.readAuction("c1"))
+		n.agree("c1", n.buyer)
+	})
+
+	t.Run("with bids", func(t *testing.T) {
+		n := newTestNetwork(t)
+		closedAuction(n)
+
+		err := n.auctionCall(n.producer, "CancelAuction", "c1")
+		require.EqualError(t, err, "auction for commitment c1 has bids and can only be cancelled once it has ended")
+	})
+
+	t.Run("winner without an offer", func(t *testing.T) {
+		n := newTestNetwork(t)
+		closedAuction(n)
+		n.mustSubmit(n.buyer, "RevealBid", bidInput("c1", 5000, buyerBidSalt))
+		n.mustSubmit(n.rival, "RevealBid", bidInput("c1", 6000, rivalBidSalt))
+		require.NoError(t, n.auctionCall(n.producer, "EndAuction", "c1"))
+
+		err := n.auctionCall(n.producer, "CancelAuction", "c1")
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "the winner of the auction for commitment c1 has until")
+
+		n.ledger.SetTime(auctionDeadline.Add(auctionSettlementPeriod + 2*time.Hour))
+		require.NoError(t, n.auctionCall(n.producer, "CancelAuction", "c1"))
+		require.Nil(t, n.readAuction("c1"))
+
+		// The commitment is open to offers and new auctions again
+		n.agree("c1", n.buyer)
+	})
+
+	t.Run("winner with an offer", func(t *testing.T) {
+		n := newTestNetwork(t)
+		closedAuction(n)
+		n.mustSubmit(n.rival, "RevealBid", bidInput("c1", 6000, rivalBidSalt))
+		n.mustSubmit(n.buyer, "RevealBid", bidInput("c1", 5000, buyerBidSalt))
+		require.NoError(t, n.auctionCall(n.producer, "EndAuction", "c1"))
+		n.mustSubmit(n.rival, "AgreeToTransfer", transient{"commitment_value": with(termsInput("c1"), "rate", 6000)})
+
+		n.ledger.SetTime(auctionDeadline.Add(auctionSettlementPeriod + 2*time.Hour))
+		err := n.auctionCall(n.producer, "CancelAuction", "c1")
+		require.EqualError(t, err, "the winner of the auction for commitment c1 has made an offer")
+	})
+}
@@ -0,0 +1,47 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/hyperledger/fabric-samples/yield-commitment/chaincode-go/events"
+)
+
+// eventHeader returns the header of an event emitted by the current transaction
+func eventHeader(ctx contractapi.TransactionContextInterface) (events.Header, error) {
+	timestamp, err := txTime(ctx)
+	if err != nil {
+		return events.Header{}, err
+	}
+	return events.Header{
+		Version:   events.Version,
+		TxID:      ctx.GetStub().GetTxID(),
+		Timestamp: timestamp.UTC().Format(time.RFC3339),
+	}, nil
+}
+
+// emitEvent sets the chaincode event of the transaction. Only the last event set by a
+// transaction is delivered, so each transaction emits a single event.
+func emitEvent(ctx contractapi.TransactionContextInterface, name string, payload interface{}) error {
+	payloadJSON, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %v event: %v", name, err)
+	}
+
+	err = ctx.GetStub().SetEvent(name, payloadJSON)
+	if err != nil {
+		return fmt.Errorf("failed to set %v event: %v", name, err)
+	}
+	return nil
+}
+
+// clientMSP returns the MSP ID of the submitting client
+func clientMSP(ctx contractapi.TransactionContextInterface) (string, error) {
+	mspID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return "", fmt.Errorf("failed to get verified MSPID: %v", err)
+	}
+	return mspID, nil
+}
@@ -0,0 +1,197 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+const fulfillmentObjectType = "fulfillment"
+
+// Fulfillment compares the production committed in a commitment with the yield
+// that has been delivered against it
+type Fulfillment struct {
+	CommitmentID string  `json:"commitmentID"`
+	Committed    float64 `json:"committed"`
+	Delivered    float64 `json:"delivered"`
+	Shortfall    float64 `json:"shortfall"`
+	YieldCount   int     `json:"yieldCount"`
+}
+
+// deliveryRecord is the running total of yields stored per commitment in the yieldCollection
+type deliveryRecord struct {
+	CommitmentID string  `json:"commitmentID"`
+	Delivered    float64 `json:"delivered"`
+	YieldCount   int     `json:"yieldCount"`
+}
+
+// readDeliveryRecord returns the running total of yields for a commitment, or an
+// empty record if no yield has been reported yet.
+func readDeliveryRecord(ctx contractapi.TransactionContextInterface, commitmentID string) (*deliveryRecord, error) {
+	deliveryKey, err := ctx.GetStub().CreateCompositeKey(fulfillmentObjectType, []string{commitmentID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	deliveryJSON, err := ctx.GetStub().GetPrivateData(yieldCollection, deliveryKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read delivery record: %v", err)
+	}
+
+	record := &deliveryRecord{CommitmentID: commitmentID}
+	if deliveryJSON == nil {
+		return record, nil
+	}
+
+	err = json.Unmarshal(deliveryJSON, record)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal JSON: %v", err)
+	}
+	return record, nil
+}
+
+// recordDelivery adds a yield to the commitment's running total and advances the
+// commitment to Delivering, or to Fulfilled once the committed production is met.
+// A yield on a lot is shared out to the member commitments in proportion to their
+// production, and it is their producers whose reputation is updated.
+func (s *SmartContract) recordDelivery(ctx contractapi.TransactionContextInterface, commitment *Commitment, produced float64) error {
+	lot, err := readLot(ctx, commitment.ID)
+	if err != nil {
+		return err
+	}
+	if lot == nil {
+		update, err := s.deliver(ctx, commitment, produced, false)
+		if err != nil {
+			return err
+		}
+		return s.updateReputation(ctx, commitment.Producer, update)
+	}
+
+	_, err = s.deliver(ctx, commitment, produced, false)
+	if err != nil {
+		return err
+	}
+	lotFulfilled := commitmentStatus(commitment) == StatusFulfilled
+
+	updates := &reputationUpdates{}
+	for _, member := range lot.Members {
+		memberCommitment, err := s.ReadCommitment(ctx, member.CommitmentID)
+		if err != nil {
+			return fmt.Errorf("error reading commitment: %v", err)
+		}
+		if memberCommitment == nil {
+			return fmt.Errorf("member commitment %v of lot %v does not exist", member.CommitmentID, lot.ID)
+		}
+		if commitmentStatus(memberCommitment) == StatusFulfilled {
+			continue
+		}
+
+		update, err := s.deliver(ctx, memberCommitment, produced*member.Share, lotFulfilled)
+		if err != nil {
+			return err
+		}
+		updates.add(memberCommitment.Producer, update)
+	}
+	return updates.apply(ctx, s)
+}
+
+// deliver adds a yield to the commitment's running total, stores the total and the
+// commitment and returns the change to apply to the producer's reputation. The
+// commitment is fulfilled once the committed production is met, or when complete is set.
+func (s *SmartContract) deliver(ctx contractapi.TransactionContextInterface, commitment *Commitment, produced float64, complete bool) (func(*Data), error) {
+	switch commitmentStatus(commitment) {
+	case StatusOpen, StatusTransferred, StatusPooled:
+		err := transitionCommitment(commitment, StatusDelivering)
+		if err != nil {
+			return nil, err
+		}
+	case StatusDelivering:
+	default:
+		return nil, fmt.Errorf("commitment %v is %v and cannot accept yields", commitment.ID, commitmentStatus(commitment))
+	}
+
+	record, err := readDeliveryRecord(ctx, commitment.ID)
+	if err != nil {
+		return nil, err
+	}
+	firstYield := record.YieldCount == 0
+	record.Delivered += produced
+	record.YieldCount++
+
+	fulfilled := complete || record.Delivered >= float64(commitment.Production)
+	onTime := false
+	if fulfilled {
+		err = transitionCommitment(commitment, StatusFulfilled)
+		if err != nil {
+			return nil, err
+		}
+		onTime, err = deliveredOnTime(ctx, commitment)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	recordJSONasBytes, err := json.Marshal(record)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal delivery record: %v", err)
+	}
+
+	deliveryKey, err := ctx.GetStub().CreateCompositeKey(fulfillmentObjectType, []string{commitment.ID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	log.Printf("recordDelivery Put: collection %v, ID %v, delivered %v", yieldCollection, commitment.ID, record.Delivered)
+	err = ctx.GetStub().PutPrivateData(yieldCollection, deliveryKey, recordJSONasBytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to put delivery record: %v", err)
+	}
+
+	err = s.putCommitment(ctx, commitment)
+	if err != nil {
+		return nil, err
+	}
+
+	// The delivery and the close are applied to the producer's reputation together
+	return func(data *Data) {
+		if firstYield {
+			data.Committed += float64(commitment.Production)
+		}
+		data.Delivered += produced
+		if fulfilled {
+			recordClosed(data, commitment, onTime)
+		}
+	}, nil
+}
+
+// GetFulfillment returns the committed production, the delivered yield and the
+// remaining shortfall of a commitment
+func (s *SmartContract) GetFulfillment(ctx contractapi.TransactionContextInterface, commitmentID string) (*Fulfillment, error) {
+
+	commitment, err := s.ReadCommitment(ctx, commitmentID)
+	if err != nil {
+		return nil, fmt.Errorf("error reading commitment: %v", err)
+	}
+	if commitment == nil {
+		return nil, fmt.Errorf("%v does not exist", commitmentID)
+	}
+
+	record, err := readDeliveryRecord(ctx, commitmentID)
+	if err != nil {
+		return nil, err
+	}
+
+	fulfillment := &Fulfillment{
+		CommitmentID: commitmentID,
+		Committed:    float64(commitment.Production),
+		Delivered:    record.Delivered,
+		YieldCount:   record.YieldCount,
+	}
+	if fulfillment.Delivered < fulfillment.Committed {
+		fulfillment.Shortfall = fulfillment.Committed - fulfillment.Delivered
+	}
+
+	return fulfillment, nil
+}
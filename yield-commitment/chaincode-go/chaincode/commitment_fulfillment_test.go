@@ -0,0 +1,108 @@
+package chaincode
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/stretchr/testify/require"
+)
+
+// getFulfillment returns the fulfillment of a commitment as read by the producer
+func (n *testNetwork) getFulfillment(id string) (*Fulfillment, error) {
+	var fulfillment *Fulfillment
+	err := n.evaluate(n.producer, func(ctx contractapi.TransactionContextInterface) error {
+		var err error
+		fulfillment, err = n.contract.GetFulfillment(ctx, id)
+		return err
+	})
+	return fulfillment, err
+}
+
+func TestGetFulfillment(t *testing.T) {
+	n := newTestNetwork(t)
+	n.createCommitment("c1")
+
+	_, err := n.getFulfillment("c2")
+	require.EqualError(t, err, "c2 does not exist")
+
+	fulfillment, err := n.getFulfillment("c1")
+	require.NoError(t, err)
+	require.Equal(t, &Fulfillment{CommitmentID: "c1", Committed: 100, Shortfall: 100}, fulfillment)
+
+	n.recordYield("y1", "c1", 40)
+	fulfillment, err = n.getFulfillment("c1")
+	require.NoError(t, err)
+	require.Equal(t, &Fulfillment{CommitmentID: "c1", Committed: 100, Delivered: 40, Shortfall: 60, YieldCount: 1}, fulfillment)
+
+	// Delivering more than committed leaves no shortfall
+	n.recordYield("y2", "c1", 70)
+	fulfillment, err = n.getFulfillment("c1")
+	require.NoError(t, err)
+	require.Equal(t, &Fulfillment{CommitmentID: "c1", Committed: 100, Delivered: 110, YieldCount: 2}, fulfillment)
+}
+
+func TestRecordDelivery(t *testing.T) {
+	deadline := time.Date(2021, time.October, 1, 0, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		name     string
+		yields   []float64
+		closedAt time.Time
+		status   string
+		data     Data
+	}{
+		{
+			name:     "partial delivery",
+			yields:   []float64{40},
+			closedAt: deadline.Add(-time.Hour),
+			status:   StatusDelivering,
+			data:     Data{Committed: 100, Delivered: 40},
+		},
+		{
+			name:     "fulfilled on time",
+			yields:   []float64{40, 60},
+			closedAt: deadline.Add(-time.Hour),
+			status:   StatusFulfilled,
+			data:     Data{Committed: 100, Delivered: 100, ClosedCommitments: 1, OnTime: 1},
+		},
+		{
+			name:     "fulfilled late",
+			yields:   []float64{40, 60},
+			closedAt: deadline.Add(time.Hour),
+			status:   StatusFulfilled,
+			data:     Data{Committed: 100, Delivered: 100, ClosedCommitments: 1, Late: 1},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			n := newTestNetwork(t)
+			n.mustSubmit(n.producer, "CreateCommitment", transient{"commitment_properties": with(commitmentInput("c1"), "deliveryDeadline", deadline.Format(time.RFC3339))})
+
+			n.ledger.SetTime(tc.closedAt)
+			for i, produced := range tc.yields {
+				n.recordYield(fmt.Sprintf("y%v", i+1), "c1", produced)
+			}
+			require.Equal(t, tc.status, n.readCommitment("c1").Status)
+
+			data := n.readData(n.producer)
+			require.Equal(t, tc.data.Committed, data.Committed)
+			require.Equal(t, tc.data.Delivered, data.Delivered)
+			require.Equal(t, tc.data.ClosedCommitments, data.ClosedCommitments)
+			require.Equal(t, tc.data.OnTime, data.OnTime)
+			require.Equal(t, tc.data.Late, data.Late)
+		})
+	}
+}
+
+func TestYieldOnClosedCommitment(t *testing.T) {
+	n := newTestNetwork(t)
+	n.createCommitment("c1")
+	n.recordYield("y1", "c1", 100)
+
+	err := n.submit(n.producer, "CreateYield", transient{"yield_properties": map[string]interface{}{"objectType": "yield", "yieldID": "y2", "commitmentID": "c1", "produced": 10}})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "commitment c1 is Fulfilled and cannot accept yields")
+}
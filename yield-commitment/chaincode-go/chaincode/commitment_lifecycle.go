@@ -0,0 +1,236 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Commitment lifecycle states. The status is stored on the Commitment record in the
+// commitmentCollection so that every member of the channel can tell whether a
+// commitment is still tradeable.
+const (
+	StatusDraft          = "Draft"
+	StatusOpen           = "Open"
+	StatusUnderAgreement = "UnderAgreement"
+	StatusPooled         = "Pooled"
+	StatusTransferred    = "Transferred"
+	StatusDelivering     = "Delivering"
+	StatusFulfilled      = "Fulfilled"
+	StatusDefaulted      = "Defaulted"
+	StatusCancelled      = "Cancelled"
+)
+
+// commitmentTransitions lists the states a commitment may move to from each state.
+// Fulfilled, Defaulted and Cancelled are terminal. Pooled commitments are traded as
+// part of a lot, default with the lot and return to Open, or Transferred once the lot
+// has been sold on, when the lot is cancelled.
+var commitmentTransitions = map[string][]string{
+	StatusDraft:          {StatusOpen, StatusCancelled},
+	StatusOpen:           {StatusUnderAgreement, StatusPooled, StatusDelivering, StatusCancelled},
+	StatusUnderAgreement: {StatusOpen, StatusTransferred, StatusCancelled},
+	StatusTransferred:    {StatusUnderAgreement, StatusPooled, StatusDelivering, StatusCancelled},
+	StatusPooled:         {StatusOpen, StatusTransferred, StatusDelivering, StatusDefaulted},
+	StatusDelivering:     {StatusFulfilled, StatusDefaulted},
+}
+
+// ownerManagedStatuses are the states an owner may request directly through
+// SetCommitmentStatus. The remaining states are only reached as a side effect of
+// the agreement, transfer, delete and yield transactions.
+var ownerManagedStatuses = map[string]bool{
+	StatusOpen:       true,
+	StatusDelivering: true,
+	StatusDefaulted:  true,
+}
+
+// commitmentStatus returns the lifecycle state of a commitment. Commitments written
+// before the lifecycle was introduced carry no status and are treated as Open.
+func commitmentStatus(commitment *Commitment) string {
+	if commitment.Status == "" {
+		return StatusOpen
+	}
+	return commitment.Status
+}
+
+// isTradeable reports whether the commitment is available to buyers with no offer pending.
+func isTradeable(commitment *Commitment) bool {
+	status := commitmentStatus(commitment)
+	return status == StatusOpen || status == StatusTransferred
+}
+
+// availableStatus returns the state a commitment under agreement returns to when its
+// offers are withdrawn: Transferred once it has been sold on, Open while the producer
+// still owns it.
+func availableStatus(commitment *Commitment) string {
+	if commitment.Owner != commitment.Producer {
+		return StatusTransferred
+	}
+	return StatusOpen
+}
+
+// transitionCommitment moves the commitment to the next state, rejecting any
+// transition that is not part of the lifecycle.
+func transitionCommitment(commitment *Commitment, next string) error {
+	current := commitmentStatus(commitment)
+	for _, allowed := range commitmentTransitions[current] {
+		if allowed == next {
+			commitment.Status = next
+			return nil
+		}
+	}
+	return fmt.Errorf("commitment %v cannot move from %v to %v", commitment.ID, current, next)
+}
+
+// putCommitment writes the commitment record to the commitmentCollection, indexes its ID
+// for range queries and appends the change to the commitment's audit trail.
+func (s *SmartContract) putCommitment(ctx contractapi.TransactionContextInterface, commitment *Commitment) error {
+	// Queries only match commitments stored with their object type
+	commitment.Type = commitmentObjectType
+	commitmentJSONasBytes, err := json.Marshal(commitment)
+	if err != nil {
+		return fmt.Errorf("failed to marshal commitment %v: %v", commitment.ID, err)
+	}
+
+	err = s.recordAudit(ctx, commitment.ID, commitmentJSONasBytes)
+	if err != nil {
+		return err
+	}
+
+	commitmentKey, err := objectKey(ctx, commitmentObjectType, commitment.ID)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Put: collection %v, ID %v, status %v", commitmentCollection, commitment.ID, commitment.Status)
+	err = ctx.GetStub().PutPrivateData(commitmentCollection, commitmentKey, commitmentJSONasBytes)
+	if err != nil {
+		return fmt.Errorf("failed to put commitment into private data collecton: %v", err)
+	}
+	return putCommitmentRangeIndex(ctx, commitment.ID)
+}
+
+// SetCommitmentStatus can be used by the owner of a commitment to publish a draft
+// and to record delivery progress (Delivering, Defaulted). An owner other than the
+// producer can only record a default after the delivery deadline has passed. The other
+// states are reached through AgreeToTransfer, TransferCommitment, DeleteCommitment and CreateYield.
+func (s *SmartContract) SetCommitmentStatus(ctx contractapi.TransactionContextInterface) error {
+
+	transientMap, err := ctx.GetStub().GetTransient()
+	if err != nil {
+		return fmt.Errorf("error getting transient: %v", err)
+	}
+
+	// Commitment properties are private, therefore they get passed in transient field
+	transientStatusJSON, ok := transientMap["commitment_status"]
+	if !ok {
+		return fmt.Errorf("commitment status not found in the transient map")
+	}
+
+	type commitmentStatusTransientInput struct {
+		ID     string `json:"commitmentID"`
+		Status string `json:"status"`
+	}
+
+	var statusInput commitmentStatusTransientInput
+	err = json.Unmarshal(transientStatusJSON, &statusInput)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal JSON: %v", err)
+	}
+
+	if len(statusInput.ID) == 0 {
+		return fmt.Errorf("commitmentID field must be a non-empty string")
+	}
+	if !ownerManagedStatuses[statusInput.Status] {
+		return fmt.Errorf("status %v cannot be set directly", statusInput.Status)
+	}
+
+	// Verify that the client is submitting request to peer in their organization
+	err = s.verifyClientOrgMatchesPeerOrg(ctx)
+	if err != nil {
+		return fmt.Errorf("SetCommitmentStatus cannot be performed: Error %v", err)
+	}
+
+	commitment, err := s.ReadCommitment(ctx, statusInput.ID)
+	if err != nil {
+		return fmt.Errorf("error reading commitment: %v", err)
+	}
+	if commitment == nil {
+		return fmt.Errorf("%v does not exist", statusInput.ID)
+	}
+
+	clientID, err := s.submittingClientIdentity(ctx)
+	if err != nil {
+		return err
+	}
+	if clientID != commitment.Owner {
+		return fmt.Errorf("error: submitting client identity does not own commitment")
+	}
+
+	if commitment.LotID != "" {
+		return fmt.Errorf("commitment %v is pooled in lot %v and follows the status of the lot", commitment.ID, commitment.LotID)
+	}
+
+	// A default counts against the producer, so a buyer who owns the commitment may only
+	// declare it once the producer has missed the delivery deadline
+	if statusInput.Status == StatusDefaulted && clientID != commitment.Producer {
+		if commitment.DeliveryDeadline == "" {
+			return fmt.Errorf("commitment %v has no delivery deadline and can only be defaulted by its producer", commitment.ID)
+		}
+		onTime, err := deliveredOnTime(ctx, commitment)
+		if err != nil {
+			return err
+		}
+		if onTime {
+			return fmt.Errorf("commitment %v cannot be defaulted before its delivery deadline %v", commitment.ID, commitment.DeliveryDeadline)
+		}
+	}
+
+	err = transitionCommitment(commitment, statusInput.Status)
+	if err != nil {
+		return err
+	}
+
+	lot, err := readLot(ctx, commitment.ID)
+	if err != nil {
+		return err
+	}
+
+	// A default closes the commitment and counts against the producer's reputation. The
+	// producers of a lot are accounted for through its member commitments, which default with it.
+	if commitment.Status == StatusDefaulted {
+		if lot != nil {
+			err = s.defaultLotMembers(ctx, lot)
+			if err != nil {
+				return err
+			}
+		} else {
+			update, err := defaultUpdate(ctx, commitment)
+			if err != nil {
+				return err
+			}
+			err = s.updateReputation(ctx, commitment.Producer, update)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return s.putCommitment(ctx, commitment)
+}
+
+// defaultUpdate returns the change a default of the commitment makes to its producer's reputation.
+// Production that was never delivered against is added to the committed total.
+func defaultUpdate(ctx contractapi.TransactionContextInterface, commitment *Commitment) (func(*Data), error) {
+	record, err := readDeliveryRecord(ctx, commitment.ID)
+	if err != nil {
+		return nil, err
+	}
+	return func(data *Data) {
+		if record.YieldCount == 0 {
+			data.Committed += float64(commitment.Production)
+		}
+		recordClosed(data, commitment, false)
+	}, nil
+}
@@ -0,0 +1,167 @@
+package chaincode
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransitionCommitment(t *testing.T) {
+	cases := []struct {
+		from string
+		to   string
+		err  string
+	}{
+		{from: "", to: StatusUnderAgreement},
+		{from: StatusDraft, to: StatusOpen},
+		{from: StatusDraft, to: StatusUnderAgreement, err: "commitment c1 cannot move from Draft to UnderAgreement"},
+		{from: StatusOpen, to: StatusPooled},
+		{from: StatusUnderAgreement, to: StatusTransferred},
+		{from: StatusTransferred, to: StatusUnderAgreement},
+		{from: StatusPooled, to: StatusDefaulted},
+		{from: StatusPooled, to: StatusUnderAgreement, err: "cannot move from Pooled to UnderAgreement"},
+		{from: StatusDelivering, to: StatusFulfilled},
+		{from: StatusFulfilled, to: StatusOpen, err: "cannot move from Fulfilled to Open"},
+		{from: StatusCancelled, to: StatusOpen, err: "cannot move from Cancelled to Open"},
+	}
+
+	for _, tc := range cases {
+		commitment := &Commitment{ID: "c1", Status: tc.from}
+		err := transitionCommitment(commitment, tc.to)
+		if tc.err != "" {
+			require.Error(t, err)
+			require.Contains(t, err.Error(), tc.err)
+			require.Equal(t, tc.from, commitment.Status)
+			continue
+		}
+		require.NoError(t, err, "%v to %v", tc.from, tc.to)
+		require.Equal(t, tc.to, commitment.Status)
+	}
+}
+
+func TestAvailableStatus(t *testing.T) {
+	require.Equal(t, StatusOpen, availableStatus(&Commitment{Owner: "producer", Producer: "producer"}))
+	require.Equal(t, StatusTransferred, availableStatus(&Commitment{Owner: "buyer", Producer: "producer"}))
+}
+
+func TestSetCommitmentStatus(t *testing.T) {
+	setup := func(n *testNetwork) { n.createCommitment("c1") }
+	statusInput := func(id string, status string) transient {
+		return transient{"commitment_status": map[string]string{"commitmentID": id, "status": status}}
+	}
+
+	// sell transfers a commitment due at the deadline to the buyer, who starts its delivery
+	sell := func(n *testNetwork, deadline string) {
+		input := commitmentInput("c2")
+		if deadline != "" {
+			input = with(input, "deliveryDeadline", deadline)
+		}
+		n.mustSubmit(n.producer, "CreateCommitment", transient{"commitment_properties": input})
+		n.agree("c2", n.buyer)
+		n.mustSubmit(n.producer, "TransferCommitment", transient{"commitment_owner": map[string]string{"commitmentID": "c2", "buyerMSP": "Org2MSP", "buyerID": n.buyer.ID()}})
+		n.mustSubmit(n.buyer, "SetCommitmentStatus", statusInput("c2", StatusDelivering))
+	}
+	deadline := func(n *testNetwork) string { return n.ledger.Now().Add(24 * time.Hour).Format(time.RFC3339) }
+
+	runTransactionCases(t, "SetCommitmentStatus", setup, []transactionCase{
+		{
+			name:  "missing transient input",
+			input: transient{},
+			err:   "commitment status not found in the transient map",
+		},
+		{
+			name:  "missing commitmentID",
+			input: statusInput("", StatusDelivering),
+			err:   "commitmentID field must be a non-empty string",
+		},
+		{
+			name:  "status reached through another transaction",
+			input: statusInput("c1", StatusFulfilled),
+			err:   "status Fulfilled cannot be set directly",
+		},
+		{
+			name:    "client of another org",
+			peerMSP: "Org2MSP",
+			input:   statusInput("c1", StatusDelivering),
+			err:     crossOrgError,
+		},
+		{
+			name:  "unknown commitment",
+			input: statusInput("c2", StatusDelivering),
+			err:   "c2 does not exist",
+		},
+		{
+			name:   "not the owner",
+			client: otherOrg1,
+			input:  statusInput("c1", StatusDelivering),
+			err:    "submitting client identity does not own commitment",
+		},
+		{
+			name:  "transition outside the lifecycle",
+			input: statusInput("c1", StatusDefaulted),
+			err:   "commitment c1 cannot move from Open to Defaulted",
+		},
+		{
+			name: "publish a draft",
+			setup: func(n *testNetwork) {
+				n.mustSubmit(n.producer, "CreateCommitment", transient{"commitment_properties": with(commitmentInput("c2"), "draft", true)})
+			},
+			input: statusInput("c2", StatusOpen),
+			check: func(t *testing.T, n *testNetwork) {
+				require.Equal(t, StatusOpen, n.readCommitment("c2").Status)
+			},
+		},
+		{
+			name:  "start delivery",
+			input: statusInput("c1", StatusDelivering),
+			check: func(t *testing.T, n *testNetwork) {
+				require.Equal(t, StatusDelivering, n.readCommitment("c1").Status)
+				require.Nil(t, n.readData(n.producer))
+			},
+		},
+		{
+			name: "default",
+			setup: func(n *testNetwork) {
+				n.mustSubmit(n.producer, "SetCommitmentStatus", statusInput("c1", StatusDelivering))
+			},
+			input: statusInput("c1", StatusDefaulted),
+			check: func(t *testing.T, n *testNetwork) {
+				require.Equal(t, StatusDefaulted, n.readCommitment("c1").Status)
+
+				data := n.readData(n.producer)
+				require.Equal(t, 1, data.ClosedCommitments)
+				require.Equal(t, 1, data.Defaults)
+				require.Equal(t, float64(100), data.Committed)
+				require.Equal(t, 0.0, data.Reputation)
+			},
+		},
+		{
+			name:   "default by the buyer before the deadline",
+			setup:  func(n *testNetwork) { sell(n, deadline(n)) },
+			client: buyer,
+			input:  statusInput("c2", StatusDefaulted),
+			err:    "commitment c2 cannot be defaulted before its delivery deadline",
+		},
+		{
+			name:   "default by the buyer without a deadline",
+			setup:  func(n *testNetwork) { sell(n, "") },
+			client: buyer,
+			input:  statusInput("c2", StatusDefaulted),
+			err:    "commitment c2 has no delivery deadline and can only be defaulted by its producer",
+		},
+		{
+			name: "default by the buyer after the deadline",
+			setup: func(n *testNetwork) {
+				sell(n, deadline(n))
+				n.ledger.SetTime(n.ledger.Now().Add(48 * time.Hour))
+			},
+			client: buyer,
+			input:  statusInput("c2", StatusDefaulted),
+			check: func(t *testing.T, n *testNetwork) {
+				require.Equal(t, StatusDefaulted, n.readCommitment("c2").Status)
+				require.Equal(t, 1, n.readData(n.producer).Defaults)
+			},
+		},
+	})
+}
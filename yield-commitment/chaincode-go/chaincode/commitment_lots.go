@@ -0,0 +1,571 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/hyperledger/fabric-samples/yield-commitment/chaincode-go/events"
+)
+
+const lotObjectType = "lot"
+const poolConsentObjectType = "poolConsent"
+
+// Lot pools the commitments of several producers of the same crop so that they can be sold
+// to one buyer. The lot is itself a commitment, traded through the agreement and transfer
+// flow, and the lot record lists the member commitments with their share of the production.
+type Lot struct {
+	ID      string       `json:"lotID"`
+	Crop    string       `json:"crop"`
+	Members []*LotMember `json:"members"`
+}
+
+// LotMember is a commitment pooled in a lot
+type LotMember struct {
+	CommitmentID string  `json:"commitmentID"`
+	Production   int     `json:"production"`
+	Share        float64 `json:"share"` // Share is the fraction of the lot production committed by the member
+}
+
+// PoolConsent is the consent of the owner of a commitment to have it pooled in a lot by another
+// client, such as a cooperative pooling the commitments of its farmers. It is stored in the
+// commitmentCollection and used up when the commitment is pooled.
+type PoolConsent struct {
+	CommitmentID string `json:"commitmentID"`
+	LotID        string `json:"lotID"`
+	Owner        string `json:"owner"`
+	Pooler       string `json:"pooler"`
+}
+
+// readLot returns the lot record of a commitment, or nil if the commitment is not a lot
+func readLot(ctx contractapi.TransactionContextInterface, lotID string) (*Lot, error) {
+	lotKey, err := objectKey(ctx, lotObjectType, lotID)
+	if err != nil {
+		return nil, err
+	}
+
+	lotJSON, err := ctx.GetStub().GetPrivateData(commitmentCollection, lotKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read lot: %v", err)
+	}
+	if lotJSON == nil {
+		return nil, nil
+	}
+
+	var lot *Lot
+	err = json.Unmarshal(lotJSON, &lot)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal JSON: %v", err)
+	}
+	return lot, nil
+}
+
+// readPoolConsent returns the consent given to pool a commitment, or nil if there is none
+func readPoolConsent(ctx contractapi.TransactionContextInterface, commitmentID string) (*PoolConsent, error) {
+	consentKey, err := objectKey(ctx, poolConsentObjectType, commitmentID)
+	if err != nil {
+		return nil, err
+	}
+
+	consentJSON, err := ctx.GetStub().GetPrivateData(commitmentCollection, consentKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pool consent: %v", err)
+	}
+	if consentJSON == nil {
+		return nil, nil
+	}
+
+	var consent *PoolConsent
+	err = json.Unmarshal(consentJSON, &consent)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal JSON: %v", err)
+	}
+	return consent, nil
+}
+
+// deletePoolConsent removes the consent given to pool a commitment
+func deletePoolConsent(ctx contractapi.TransactionContextInterface, commitmentID string) error {
+	consentKey, err := objectKey(ctx, poolConsentObjectType, commitmentID)
+	if err != nil {
+		return err
+	}
+
+	err = ctx.GetStub().DelPrivateData(commitmentCollection, consentKey)
+	if err != nil {
+		return fmt.Errorf("failed to delete pool consent: %v", err)
+	}
+	return nil
+}
+
+// ConsentToPool is used by the owner of a commitment to let another client pool it in a lot
+// with PoolCommitments. The commitment stays owned by the submitting client until the lot is
+// sold. Consenting again replaces the previous consent.
+func (s *SmartContract) ConsentToPool(ctx contractapi.TransactionContextInterface, commitmentID string, lotID string, pooler string) error {
+	if len(commitmentID) == 0 || len(lotID) == 0 || len(pooler) == 0 {
+		return fmt.Errorf("commitmentID, lotID and pooler must be non-empty strings")
+	}
+
+	// Verify that the client is submitting request to peer in their organization
+	err := s.verifyClientOrgMatchesPeerOrg(ctx)
+	if err != nil {
+		return fmt.Errorf("ConsentToPool cannot be performed: Error %v", err)
+	}
+
+	commitment, err := s.ReadCommitment(ctx, commitmentID)
+	if err != nil {
+		return fmt.Errorf("error reading commitment: %v", err)
+	}
+	if commitment == nil {
+		return fmt.Errorf("%v does not exist", commitmentID)
+	}
+
+	clientID, err := s.submittingClientIdentity(ctx)
+	if err != nil {
+		return err
+	}
+	if clientID != commitment.Owner {
+		return fmt.Errorf("error: submitting client identity does not own commitment")
+	}
+	if !isTradeable(commitment) {
+		return fmt.Errorf("commitment %v is %v and cannot be pooled", commitmentID, commitmentStatus(commitment))
+	}
+
+	consentJSON, err := json.Marshal(PoolConsent{
+		CommitmentID: commitmentID,
+		LotID:        lotID,
+		Owner:        clientID,
+		Pooler:       pooler,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal pool consent: %v", err)
+	}
+	consentKey, err := objectKey(ctx, poolConsentObjectType, commitmentID)
+	if err != nil {
+		return err
+	}
+
+	err = s.recordAudit(ctx, commitmentID, nil)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("ConsentToPool Put: collection %v, ID %v, lot %v", commitmentCollection, commitmentID, lotID)
+	err = ctx.GetStub().PutPrivateData(commitmentCollection, consentKey, consentJSON)
+	if err != nil {
+		return fmt.Errorf("failed to put pool consent: %v", err)
+	}
+	return nil
+}
+
+// WithdrawPoolConsent is used by the owner of a commitment to withdraw its consent to have the
+// commitment pooled, as long as it has not been pooled yet
+func (s *SmartContract) WithdrawPoolConsent(ctx contractapi.TransactionContextInterface, commitmentID string) error {
+
+	// Verify that the client is submitting request to peer in their organization
+	err := s.verifyClientOrgMatchesPeerOrg(ctx)
+	if err != nil {
+		return fmt.Errorf("WithdrawPoolConsent cannot be performed: Error %v", err)
+	}
+
+	consent, err := readPoolConsent(ctx, commitmentID)
+	if err != nil {
+		return err
+	}
+	if consent == nil {
+		return fmt.Errorf("no consent to pool commitment %v exists", commitmentID)
+	}
+
+	clientID, err := s.submittingClientIdentity(ctx)
+	if err != nil {
+		return err
+	}
+	if clientID != consent.Owner {
+		return fmt.Errorf("error: only the owner who consented can withdraw the consent")
+	}
+
+	err = s.recordAudit(ctx, commitmentID, nil)
+	if err != nil {
+		return err
+	}
+	return deletePoolConsent(ctx, commitmentID)
+}
+
+// PoolCommitments creates a lot from commitments of the same crop owned by the submitting
+// client, or whose owners consented with ConsentToPool to have them pooled in this lot by the
+// client. The lot is created as a commitment owned by the client, with its production and
+// size the totals of its members, and its terms are stored in the owner's org collection
+// like those of any other commitment. The members can no longer be traded on their own, and
+// are transferred to the buyer of the lot when it is sold. CommitmentCreated is emitted for the lot.
+func (s *SmartContract) PoolCommitments(ctx contractapi.TransactionContextInterface) error {
+
+	transientMap, err := ctx.GetStub().GetTransient()
+	if err != nil {
+		return fmt.Errorf("error getting transient: %v", err)
+	}
+
+	// Lot properties are private, therefore they get passed in transient field
+	transientLotJSON, ok := transientMap["lot_properties"]
+	if !ok {
+		return fmt.Errorf("lot_properties key not found in the transient map")
+	}
+
+	type lotTransientInput struct {
+		ID               string   `json:"lotID"`
+		Location         string   `json:"location"`
+		CommitmentIDs    []string `json:"commitmentIDs"`
+		Rate             int      `json:"rate"`
+		DeliveryStart    string   `json:"deliveryStart"`
+		DeliveryEnd      string   `json:"deliveryEnd"`
+		Currency         string   `json:"currency"`
+		Salt             string   `json:"salt"`
+		DeliveryDeadline string   `json:"deliveryDeadline"`
+	}
+
+	var lotInput lotTransientInput
+	err = json.Unmarshal(transientLotJSON, &lotInput)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal JSON: %v", err)
+	}
+
+	if len(lotInput.ID) == 0 {
+		return fmt.Errorf("lotID field must be a non-empty string")
+	}
+	if len(lotInput.Location) == 0 {
+		return fmt.Errorf("location field must be a non-empty string")
+	}
+	if len(lotInput.CommitmentIDs) < 2 {
+		return fmt.Errorf("commitmentIDs field must list at least two commitments")
+	}
+	if len(lotInput.DeliveryDeadline) != 0 {
+		if _, err := time.Parse(time.RFC3339, lotInput.DeliveryDeadline); err != nil {
+			return fmt.Errorf("deliveryDeadline field must be an RFC3339 time: %v", err)
+		}
+	}
+
+	// Verify that the client is submitting request to peer in their organization
+	err = s.verifyClientOrgMatchesPeerOrg(ctx)
+	if err != nil {
+		return fmt.Errorf("PoolCommitments cannot be performed: Error %v", err)
+	}
+
+	clientID, err := s.submittingClientIdentity(ctx)
+	if err != nil {
+		return err
+	}
+
+	existing, err := s.ReadCommitment(ctx, lotInput.ID)
+	if err != nil {
+		return fmt.Errorf("error reading commitment: %v", err)
+	}
+	if existing != nil {
+		return fmt.Errorf("this commitment already exists: %v", lotInput.ID)
+	}
+
+	members := []*Commitment{}
+	seen := map[string]bool{}
+	production := 0
+	size := 0
+	for _, commitmentID := range lotInput.CommitmentIDs {
+		if seen[commitmentID] {
+			return fmt.Errorf("commitment %v is listed more than once", commitmentID)
+		}
+		seen[commitmentID] = true
+
+		member, err := s.ReadCommitment(ctx, commitmentID)
+		if err != nil {
+			return fmt.Errorf("error reading commitment: %v", err)
+		}
+		if member == nil {
+			return fmt.Errorf("%v does not exist", commitmentID)
+		}
+		if member.Owner != clientID {
+			consent, err := readPoolConsent(ctx, commitmentID)
+			if err != nil {
+				return err
+			}
+			if consent == nil || consent.Owner != member.Owner || consent.Pooler != clientID || consent.LotID != lotInput.ID {
+				return fmt.Errorf("error: submitting client identity does not own commitment %v and its owner has not consented to pool it in lot %v", commitmentID, lotInput.ID)
+			}
+		}
+		if len(members) > 0 && member.Crop != members[0].Crop {
+			return fmt.Errorf("commitment %v is for %v, the lot is for %v", commitmentID, member.Crop, members[0].Crop)
+		}
+		if !isTradeable(member) {
+			return fmt.Errorf("commitment %v is %v and cannot be pooled", commitmentID, commitmentStatus(member))
+		}
+
+		auction, err := readAuction(ctx, commitmentID)
+		if err != nil {
+			return err
+		}
+		if auction != nil {
+			return fmt.Errorf("commitment %v is being auctioned and cannot be pooled", commitmentID)
+		}
+		memberLot, err := readLot(ctx, commitmentID)
+		if err != nil {
+			return err
+		}
+		if memberLot != nil {
+			return fmt.Errorf("%v is a lot and cannot be pooled", commitmentID)
+		}
+
+		members = append(members, member)
+		production += member.Production
+		size += member.Size
+	}
+
+	lot := Lot{
+		ID:      lotInput.ID,
+		Crop:    members[0].Crop,
+		Members: []*LotMember{},
+	}
+	for _, member := range members {
+		lot.Members = append(lot.Members, &LotMember{
+			CommitmentID: member.ID,
+			Production:   member.Production,
+			Share:        float64(member.Production) / float64(production),
+		})
+
+		member.LotID = lotInput.ID
+		err = transitionCommitment(member, StatusPooled)
+		if err != nil {
+			return err
+		}
+		err = deletePoolConsent(ctx, member.ID)
+		if err != nil {
+			return err
+		}
+		err = s.putCommitment(ctx, member)
+		if err != nil {
+			return err
+		}
+	}
+
+	lotJSON, err := json.Marshal(lot)
+	if err != nil {
+		return fmt.Errorf("failed to marshal lot: %v", err)
+	}
+	lotKey, err := objectKey(ctx, lotObjectType, lotInput.ID)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("PoolCommitments Put: collection %v, ID %v, members %v", commitmentCollection, lotInput.ID, len(lot.Members))
+	err = ctx.GetStub().PutPrivateData(commitmentCollection, lotKey, lotJSON)
+	if err != nil {
+		return fmt.Errorf("failed to put lot: %v", err)
+	}
+
+	// The pooling client reports the yields of the lot, which are shared out to the members
+	lotCommitment := Commitment{
+		Type:             commitmentObjectType,
+		ID:               lotInput.ID,
+		Location:         lotInput.Location,
+		Production:       production,
+		Crop:             lot.Crop,
+		Size:             size,
+		Owner:            clientID,
+		Producer:         clientID,
+		DeliveryDeadline: lotInput.DeliveryDeadline,
+		Status:           StatusOpen,
+	}
+	err = s.putCommitment(ctx, &lotCommitment)
+	if err != nil {
+		return err
+	}
+
+	orgCollection, err := s.getCollectionName(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to infer private collection name for the org: %v", err)
+	}
+
+	err = putOwnerDetails(ctx, orgCollection, clientID, &CommitmentPrivateDetails{
+		ID:            lotInput.ID,
+		Rate:          lotInput.Rate,
+		Quantity:      production,
+		DeliveryStart: lotInput.DeliveryStart,
+		DeliveryEnd:   lotInput.DeliveryEnd,
+		Currency:      lotInput.Currency,
+		Salt:          lotInput.Salt,
+	})
+	if err != nil {
+		return err
+	}
+
+	ownerMSP, err := clientMSP(ctx)
+	if err != nil {
+		return err
+	}
+
+	header, err := eventHeader(ctx)
+	if err != nil {
+		return err
+	}
+	return emitEvent(ctx, events.CommitmentCreatedEvent, events.CommitmentCreated{
+		Header:       header,
+		CommitmentID: lotCommitment.ID,
+		Status:       lotCommitment.Status,
+		OwnerMSP:     ownerMSP,
+	})
+}
+
+// ReadLot returns the member commitments of a lot
+func (s *SmartContract) ReadLot(ctx contractapi.TransactionContextInterface, lotID string) (*Lot, error) {
+	log.Printf("ReadLot: collection %v, ID %v", commitmentCollection, lotID)
+	return readLot(ctx, lotID)
+}
+
+// memberTerms derives the terms of a member commitment from the terms of its lot: the member's
+// share of the lot rate, its production as the quantity and a salt derived from the lot's.
+// It returns nil if the commitment is not a member of the lot.
+func memberTerms(lot *Lot, lotTerms *CommitmentPrivateDetails, commitmentID string) *CommitmentPrivateDetails {
+	production := 0
+	var found *LotMember
+	for _, member := range lot.Members {
+		production += member.Production
+		if member.CommitmentID == commitmentID {
+			found = member
+		}
+	}
+	if found == nil || production == 0 {
+		return nil
+	}
+
+	return &CommitmentPrivateDetails{
+		ID:            commitmentID,
+		Rate:          lotTerms.Rate * found.Production / production,
+		Quantity:      found.Production,
+		DeliveryStart: lotTerms.DeliveryStart,
+		DeliveryEnd:   lotTerms.DeliveryEnd,
+		Currency:      lotTerms.Currency,
+		Salt:          derivedSalt(lotTerms.Salt, commitmentID),
+	}
+}
+
+// transferLotMembers gives the member commitments of a lot to the new owner of the lot. The
+// terms the previous owners held for the members are deleted from the org collection of the
+// seller, the new owner's terms for the members are derived from the terms of the lot. Members
+// pooled with the consent of an owner in another org keep that owner's terms in its own org
+// collection until they are purged.
+func (s *SmartContract) transferLotMembers(ctx contractapi.TransactionContextInterface, lot *Lot, owner string) error {
+	orgCollection, err := s.getCollectionName(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to infer private collection name for the org: %v", err)
+	}
+
+	for _, member := range lot.Members {
+		commitment, err := s.ReadCommitment(ctx, member.CommitmentID)
+		if err != nil {
+			return fmt.Errorf("error reading commitment: %v", err)
+		}
+		if commitment == nil {
+			return fmt.Errorf("member commitment %v of lot %v does not exist", member.CommitmentID, lot.ID)
+		}
+
+		previousDetailsKey, err := privateDetailsKey(ctx, member.CommitmentID, commitment.Owner)
+		if err != nil {
+			return err
+		}
+		err = ctx.GetStub().DelPrivateData(orgCollection, previousDetailsKey)
+		if err != nil {
+			return fmt.Errorf("failed to delete terms of member commitment %v: %v", member.CommitmentID, err)
+		}
+
+		commitment.Owner = owner
+		err = s.putCommitment(ctx, commitment)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// releaseLotMembers returns the member commitments of a cancelled lot to the market. Members
+// pooled with the consent of their owners return to them. Members the lot owner holds no terms
+// for, because they were bought with the lot, are given terms derived from the terms of the lot
+// so that they can be traded on their own.
+func (s *SmartContract) releaseLotMembers(ctx contractapi.TransactionContextInterface, lot *Lot) error {
+	orgCollection, err := s.getCollectionName(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to infer private collection name for the org: %v", err)
+	}
+	clientID, err := s.submittingClientIdentity(ctx)
+	if err != nil {
+		return err
+	}
+	lotTerms, err := s.ReadCommitmentPrivateDetails(ctx, orgCollection, lot.ID)
+	if err != nil {
+		return err
+	}
+
+	for _, member := range lot.Members {
+		commitment, err := s.ReadCommitment(ctx, member.CommitmentID)
+		if err != nil {
+			return fmt.Errorf("error reading commitment: %v", err)
+		}
+		if commitment == nil {
+			return fmt.Errorf("member commitment %v of lot %v does not exist", member.CommitmentID, lot.ID)
+		}
+
+		commitment.LotID = ""
+		err = transitionCommitment(commitment, availableStatus(commitment))
+		if err != nil {
+			return err
+		}
+		err = s.putCommitment(ctx, commitment)
+		if err != nil {
+			return err
+		}
+
+		if commitment.Owner != clientID {
+			continue
+		}
+		details, err := s.ReadCommitmentPrivateDetails(ctx, orgCollection, member.CommitmentID)
+		if err != nil {
+			return err
+		}
+		if details == nil && lotTerms != nil {
+			err = putOwnerDetails(ctx, orgCollection, commitment.Owner, memberTerms(lot, lotTerms, member.CommitmentID))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// defaultLotMembers defaults the member commitments of a defaulted lot that are not yet
+// closed and records the defaults against the reputation of their producers
+func (s *SmartContract) defaultLotMembers(ctx contractapi.TransactionContextInterface, lot *Lot) error {
+	updates := &reputationUpdates{}
+	for _, member := range lot.Members {
+		commitment, err := s.ReadCommitment(ctx, member.CommitmentID)
+		if err != nil {
+			return fmt.Errorf("error reading commitment: %v", err)
+		}
+		if commitment == nil {
+			return fmt.Errorf("member commitment %v of lot %v does not exist", member.CommitmentID, lot.ID)
+		}
+		if commitmentStatus(commitment) == StatusFulfilled {
+			continue
+		}
+
+		err = transitionCommitment(commitment, StatusDefaulted)
+		if err != nil {
+			return err
+		}
+		err = s.putCommitment(ctx, commitment)
+		if err != nil {
+			return err
+		}
+
+		update, err := defaultUpdate(ctx, commitment)
+		if err != nil {
+			return err
+		}
+		updates.add(commitment.Producer, update)
+	}
+	return updates.apply(ctx, s)
+}
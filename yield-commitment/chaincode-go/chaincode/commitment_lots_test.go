@@ -0,0 +1,383 @@
+package chaincode
+
+import (
+	"testing"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/hyperledger/fabric-samples/yield-commitment/chaincode-go/events"
+	"github.com/stretchr/testify/require"
+)
+
+func lotInput(id string, commitmentIDs ...string) map[string]interface{} {
+	return map[string]interface{}{
+		"lotID":         id,
+		"location":      "Iowa",
+		"commitmentIDs": commitmentIDs,
+		"rate":          5000,
+		"currency":      "USD",
+		"salt":          "9d02b4",
+	}
+}
+
+// pool creates commitments c1 and c2 and pools them in lot l1
+func (n *testNetwork) pool() {
+	n.createCommitment("c1")
+	n.createCommitment("c2")
+	n.mustSubmit(n.producer, "PoolCommitments", transient{"lot_properties": lotInput("l1", "c1", "c2")})
+}
+
+// sellLot transfers lot l1 to the buyer at a rate of 3000
+func (n *testNetwork) sellLot() {
+	terms := with(termsInput("l1"), "quantity", 200)
+	n.mustSubmit(n.producer, "AgreeToSell", transient{"commitment_value": terms})
+	n.mustSubmit(n.buyer, "AgreeToTransfer", transient{"commitment_value": terms})
+	n.mustSubmit(n.producer, "TransferCommitment", transient{"commitment_owner": map[string]string{"commitmentID": "l1", "buyerMSP": "Org2MSP", "buyerID": n.buyer.ID()}})
+}
+
+func readLotRecord(n *testNetwork, id string) *Lot {
+	var lot *Lot
+	require.NoError(n.t, n.evaluate(n.producer, func(ctx contractapi.TransactionContextInterface) error {
+		var err error
+		lot, err = n.contract.ReadLot(ctx, id)
+		return err
+	}))
+	return lot
+}
+
+func TestPoolCommitments(t *testing.T) {
+	setup := func(n *testNetwork) {
+		n.createCommitment("c1")
+		n.createCommitment("c2")
+	}
+
+	runTransactionCases(t, "PoolCommitments", setup, []transactionCase{
+		{
+			name:  "missing transient input",
+			input: transient{},
+			err:   "lot_properties key not found in the transient map",
+		},
+		{
+			name:  "missing lotID",
+			input: transient{"lot_properties": lotInput("", "c1", "c2")},
+			err:   "lotID field must be a non-empty string",
+		},
+		{
+			name:  "single commitment",
+			input: transient{"lot_properties": lotInput("l1", "c1")},
+			err:   "commitmentIDs field must list at least two commitments",
+		},
+		{
+			name:  "missing salt",
+			input: transient{"lot_properties": with(lotInput("l1", "c1", "c2"), "salt", nil)},
+			err:   "salt field must be a non-empty string",
+			check: func(t *testing.T, n *testNetwork) {
+				require.Nil(t, n.readCommitment("l1"))
+				require.Equal(t, StatusOpen, n.readCommitment("c1").Status)
+			},
+		},
+		{
+			name:    "client of another org",
+			peerMSP: "Org2MSP",
+			input:   transient{"lot_properties": lotInput("l1", "c1", "c2")},
+			err:     crossOrgError,
+		},
+		{
+			name:  "commitment listed twice",
+			input: transient{"lot_properties": lotInput("l1", "c1", "c1")},
+			err:   "commitment c1 is listed more than once",
+		},
+		{
+			name:  "unknown commitment",
+			input: transient{"lot_properties": lotInput("l1", "c1", "c9")},
+			err:   "c9 does not exist",
+		},
+		{
+			name:   "not the owner",
+			client: otherOrg1,
+			input:  transient{"lot_properties": lotInput("l1", "c1", "c2")},
+			err:    "submitting client identity does not own commitment c1",
+		},
+		{
+			name: "different crops",
+			setup: func(n *testNetwork) {
+				n.mustSubmit(n.producer, "CreateCommitment", transient{"commitment_properties": with(commitmentInput("c3"), "crop", "wheat")})
+			},
+			input: transient{"lot_properties": lotInput("l1", "c1", "c3")},
+			err:   "commitment c3 is for wheat, the lot is for corn",
+		},
+		{
+			name:  "commitment under agreement",
+			setup: func(n *testNetwork) { n.agree("c2", n.buyer) },
+			input: transient{"lot_properties": lotInput("l1", "c1", "c2")},
+			err:   "commitment c2 is UnderAgreement and cannot be pooled",
+		},
+		{
+			name: "commitment already pooled",
+			setup: func(n *testNetwork) {
+				n.createCommitment("c3")
+				n.mustSubmit(n.producer, "PoolCommitments", transient{"lot_properties": lotInput("l1", "c1", "c2")})
+			},
+			input: transient{"lot_properties": lotInput("l2", "c2", "c3")},
+			err:   "commitment c2 is Pooled and cannot be pooled",
+		},
+		{
+			name: "pool two commitments",
+			setup: func(n *testNetwork) {
+				n.mustSubmit(n.producer, "CreateCommitment", transient{"commitment_properties": with(commitmentInput("c3"), "production", 300)})
+			},
+			input: transient{"lot_properties": lotInput("l1", "c1", "c3")},
+			check: func(t *testing.T, n *testNetwork) {
+				lot := readLotRecord(n, "l1")
+				require.Equal(t, &Lot{ID: "l1", Crop: "corn", Members: []*LotMember{
+					{CommitmentID: "c1", Production: 100, Share: 0.25},
+					{CommitmentID: "c3", Production: 300, Share: 0.75},
+				}}, lot)
+
+				lotCommitment := n.readCommitment("l1")
+				require.Equal(t, 400, lotCommitment.Production)
+				require.Equal(t, 80, lotCommitment.Size)
+				require.Equal(t, n.producer.ID(), lotCommitment.Owner)
+				require.Equal(t, StatusOpen, lotCommitment.Status)
+
+				for _, id := range []string{"c1", "c3"} {
+					member := n.readCommitment(id)
+					require.Equal(t, StatusPooled, member.Status)
+					require.Equal(t, "l1", member.LotID)
+				}
+				require.Equal(t, StatusOpen, n.readCommitment("c2").Status)
+
+				details := n.readDetails(n.producer, "l1")
+				require.Equal(t, 5000, details.Rate)
+				require.Equal(t, 400, details.Quantity)
+				require.Equal(t, "9d02b4", details.Salt)
+
+				require.Equal(t, events.CommitmentCreatedEvent, n.lastEvent())
+				var payload events.CommitmentCreated
+				n.lastEventPayload(&payload)
+				require.Equal(t, "l1", payload.CommitmentID)
+				require.Empty(t, payload.CommitmentIDs)
+				require.Equal(t, StatusOpen, payload.Status)
+			},
+		},
+	})
+}
+
+func TestTransferLot(t *testing.T) {
+	n := newTestNetwork(t)
+	n.pool()
+	n.sellLot()
+
+	require.Equal(t, n.buyer.ID(), n.readCommitment("l1").Owner)
+	for _, id := range []string{"c1", "c2"} {
+		member := n.readCommitment(id)
+		require.Equal(t, n.buyer.ID(), member.Owner)
+		require.Equal(t, n.producer.ID(), member.Producer)
+		require.Equal(t, StatusPooled, member.Status)
+
+		// The seller no longer holds terms for the members it sold
+		require.Nil(t, n.readDetails(n.producer, id))
+	}
+
+	// The buyer's terms for the members are its share of the rate agreed for the lot
+	entries := map[string]*PortfolioEntry{}
+	for _, entry := range n.portfolio(n.buyer).Commitments {
+		entries[entry.Commitment.ID] = entry
+	}
+	require.Len(t, entries, 3)
+	require.Equal(t, 3000, entries["l1"].Rate)
+	for _, id := range []string{"c1", "c2"} {
+		require.Equal(t, 1500, entries[id].Rate, id)
+		require.Equal(t, 100, entries[id].Quantity, id)
+		require.Equal(t, "USD", entries[id].Currency, id)
+	}
+	require.Empty(t, n.portfolio(n.producer).Commitments)
+}
+
+func TestDefaultLot(t *testing.T) {
+	statusInput := func(id string, status string) transient {
+		return transient{"commitment_status": map[string]string{"commitmentID": id, "status": status}}
+	}
+
+	t.Run("before any yield", func(t *testing.T) {
+		n := newTestNetwork(t)
+		n.pool()
+		n.mustSubmit(n.producer, "SetCommitmentStatus", statusInput("l1", StatusDelivering))
+		n.mustSubmit(n.producer, "SetCommitmentStatus", statusInput("l1", StatusDefaulted))
+
+		require.Equal(t, StatusDefaulted, n.readCommitment("l1").Status)
+		require.Equal(t, StatusDefaulted, n.readCommitment("c1").Status)
+		require.Equal(t, StatusDefaulted, n.readCommitment("c2").Status)
+
+		// Both members count against their producer, the lot itself does not
+		data := n.readData(n.producer)
+		require.Equal(t, 2, data.ClosedCommitments)
+		require.Equal(t, 2, data.Defaults)
+		require.Equal(t, float64(200), data.Committed)
+		require.Equal(t, 0.0, data.Reputation)
+	})
+
+	t.Run("after a partial yield", func(t *testing.T) {
+		n := newTestNetwork(t)
+		n.pool()
+		n.recordYield("y1", "l1", 50)
+		require.Equal(t, StatusDelivering, n.readCommitment("c1").Status)
+		n.mustSubmit(n.producer, "SetCommitmentStatus", statusInput("l1", StatusDefaulted))
+
+		require.Equal(t, StatusDefaulted, n.readCommitment("c1").Status)
+		require.Equal(t, StatusDefaulted, n.readCommitment("c2").Status)
+
+		data := n.readData(n.producer)
+		require.Equal(t, 2, data.Defaults)
+		require.Equal(t, float64(200), data.Committed)
+		require.Equal(t, float64(50), data.Delivered)
+	})
+
+	t.Run("member set on its own", func(t *testing.T) {
+		n := newTestNetwork(t)
+		n.pool()
+		err := n.submit(n.producer, "SetCommitmentStatus", statusInput("c1", StatusDelivering))
+		require.EqualError(t, err, "commitment c1 is pooled in lot l1 and follows the status of the lot")
+	})
+}
+
+func TestReleaseLot(t *testing.T) {
+	deleteInput := transient{"commitment_delete": map[string]string{"commitmentID": "l1"}}
+
+	t.Run("cancelled by the producer", func(t *testing.T) {
+		n := newTestNetwork(t)
+		n.pool()
+		n.mustSubmit(n.producer, "DeleteCommitment", deleteInput)
+
+		require.Equal(t, StatusCancelled, n.readCommitment("l1").Status)
+		for _, id := range []string{"c1", "c2"} {
+			member := n.readCommitment(id)
+			require.Equal(t, StatusOpen, member.Status)
+			require.Empty(t, member.LotID)
+
+			// The producer keeps the terms it created the member with
+			details := n.readDetails(n.producer, id)
+			require.Equal(t, 2500, details.Rate)
+			require.Equal(t, "5e1f07", details.Salt)
+		}
+		require.Nil(t, n.readDetails(n.producer, "l1"))
+	})
+
+	t.Run("cancelled by the buyer", func(t *testing.T) {
+		n := newTestNetwork(t)
+		n.pool()
+		n.sellLot()
+		n.mustSubmit(n.buyer, "DeleteCommitment", deleteInput)
+
+		for _, id := range []string{"c1", "c2"} {
+			member := n.readCommitment(id)
+			require.Equal(t, StatusTransferred, member.Status)
+			require.Equal(t, n.buyer.ID(), member.Owner)
+			require.Empty(t, member.LotID)
+
+			// The buyer is given terms derived from the lot to trade the member on its own
+			details := n.readDetails(n.buyer, id)
+			require.Equal(t, 1500, details.Rate)
+			require.Equal(t, 100, details.Quantity)
+			require.Equal(t, derivedSalt("a3c9e1", id), details.Salt)
+		}
+
+		n.mustSubmit(n.buyer, "AgreeToSell", transient{"commitment_value": with(termsInput("c1"), "rate", 1800)})
+		require.Equal(t, 1800, n.readDetails(n.buyer, "c1").Rate)
+	})
+}
+
+func TestPoolCommitmentsWithConsent(t *testing.T) {
+	consent := func(n *testNetwork, lotID string) error {
+		return n.call(n.other, "ConsentToPool", func(ctx contractapi.TransactionContextInterface) error {
+			return n.contract.ConsentToPool(ctx, "c3", lotID, n.producer.ID())
+		})
+	}
+	// setup creates c1 owned by the producer and c3 owned by a farmer of the same org
+	setup := func(n *testNetwork) {
+		n.createCommitment("c1")
+		n.mustSubmit(n.other, "CreateCommitment", transient{"commitment_properties": commitmentInput("c3")})
+	}
+	poolInput := transient{"lot_properties": lotInput("l1", "c1", "c3")}
+
+	runTransactionCases(t, "PoolCommitments", setup, []transactionCase{
+		{
+			name:  "without consent",
+			input: poolInput,
+			err:   "error: submitting client identity does not own commitment c3 and its owner has not consented to pool it in lot l1",
+		},
+		{
+			name:  "consent to another lot",
+			setup: func(n *testNetwork) { require.NoError(n.t, consent(n, "l2")) },
+			input: poolInput,
+			err:   "its owner has not consented to pool it in lot l1",
+		},
+		{
+			name: "withdrawn consent",
+			setup: func(n *testNetwork) {
+				require.NoError(n.t, consent(n, "l1"))
+				require.NoError(n.t, n.call(n.other, "WithdrawPoolConsent", func(ctx contractapi.TransactionContextInterface) error {
+					return n.contract.WithdrawPoolConsent(ctx, "c3")
+				}))
+			},
+			input: poolInput,
+			err:   "its owner has not consented to pool it in lot l1",
+		},
+		{
+			name:  "consent",
+			setup: func(n *testNetwork) { require.NoError(n.t, consent(n, "l1")) },
+			input: poolInput,
+			check: func(t *testing.T, n *testNetwork) {
+				member := n.readCommitment("c3")
+				require.Equal(t, StatusPooled, member.Status)
+				require.Equal(t, "l1", member.LotID)
+				require.Equal(t, n.other.ID(), member.Owner)
+
+				// The consent is used up
+				err := n.evaluate(n.other, func(ctx contractapi.TransactionContextInterface) error {
+					consent, err := readPoolConsent(ctx, "c3")
+					require.Nil(t, consent)
+					return err
+				})
+				require.NoError(t, err)
+			},
+		},
+	})
+
+	t.Run("consent by another client than the owner", func(t *testing.T) {
+		n := newTestNetwork(t)
+		setup(n)
+		err := n.call(n.producer, "ConsentToPool", func(ctx contractapi.TransactionContextInterface) error {
+			return n.contract.ConsentToPool(ctx, "c3", "l1", n.producer.ID())
+		})
+		require.EqualError(t, err, "error: submitting client identity does not own commitment")
+	})
+
+	t.Run("lot sold", func(t *testing.T) {
+		n := newTestNetwork(t)
+		setup(n)
+		require.NoError(t, consent(n, "l1"))
+		n.mustSubmit(n.producer, "PoolCommitments", poolInput)
+		n.sellLot()
+
+		member := n.readCommitment("c3")
+		require.Equal(t, n.buyer.ID(), member.Owner)
+		require.Equal(t, n.other.ID(), member.Producer)
+		require.Nil(t, n.readDetails(n.other, "c3"))
+		require.Empty(t, n.portfolio(n.other).Commitments)
+	})
+
+	t.Run("lot cancelled", func(t *testing.T) {
+		n := newTestNetwork(t)
+		setup(n)
+		require.NoError(t, consent(n, "l1"))
+		n.mustSubmit(n.producer, "PoolCommitments", poolInput)
+		n.mustSubmit(n.producer, "DeleteCommitment", transient{"commitment_delete": map[string]string{"commitmentID": "l1"}})
+
+		// The member returns to its owner with the terms it was created with
+		member := n.readCommitment("c3")
+		require.Equal(t, StatusOpen, member.Status)
+		require.Equal(t, n.other.ID(), member.Owner)
+		require.Equal(t, 2500, n.readDetails(n.other, "c3").Rate)
+		require.Nil(t, n.readDetails(n.producer, "c3"))
+	})
+}
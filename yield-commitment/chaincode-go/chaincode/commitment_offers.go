@@ -0,0 +1,283 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// offerIndexObjectType is the key under which the buyers with an open offer on a commitment are
+// listed. Queries on private data cannot be combined with writes in the same transaction, so the
+// transactions that close offers use the index instead of a partial composite key query.
+const offerIndexObjectType = "offerIndex"
+
+// agreementByBuyerObjectType is the key under which the offers of a buyer are indexed by buyer
+// identity and commitment ID, as transfer agreements are keyed by commitment first
+const agreementByBuyerObjectType = "agreementByBuyer"
+
+// transferAgreementKey is the key of the offer made by a buyer on a commitment
+func transferAgreementKey(ctx contractapi.TransactionContextInterface, commitmentID string, buyerID string) (string, error) {
+	return objectKey(ctx, transferAgreementObjectType, commitmentID, buyerID)
+}
+
+// putAgreement stores the offer of a buyer on a commitment together with its buyer index entry
+func putAgreement(ctx contractapi.TransactionContextInterface, agreement *TransferAgreement) error {
+	agreementJSON, err := json.Marshal(agreement)
+	if err != nil {
+		return fmt.Errorf("failed to marshal transfer agreement: %v", err)
+	}
+
+	offerKey, err := transferAgreementKey(ctx, agreement.ID, agreement.BuyerID)
+	if err != nil {
+		return err
+	}
+	log.Printf("putAgreement Put: collection %v, ID %v, Key %v", commitmentCollection, agreement.ID, offerKey)
+	err = ctx.GetStub().PutPrivateData(commitmentCollection, offerKey, agreementJSON)
+	if err != nil {
+		return fmt.Errorf("failed to put transfer agreement: %v", err)
+	}
+
+	// The index entry only marks the offer, the agreement is read from its own key
+	buyerKey, err := objectKey(ctx, agreementByBuyerObjectType, agreement.BuyerID, agreement.ID)
+	if err != nil {
+		return err
+	}
+	err = ctx.GetStub().PutPrivateData(commitmentCollection, buyerKey, []byte{0x00})
+	if err != nil {
+		return fmt.Errorf("failed to put buyer index of transfer agreement: %v", err)
+	}
+	return nil
+}
+
+// deleteAgreement deletes the offer of a buyer on a commitment together with its buyer index entry
+func deleteAgreement(ctx contractapi.TransactionContextInterface, commitmentID string, buyerID string) error {
+	offerKey, err := transferAgreementKey(ctx, commitmentID, buyerID)
+	if err != nil {
+		return err
+	}
+	log.Printf("deleteAgreement Delete: collection %v, ID %v, buyer %v", commitmentCollection, commitmentID, buyerID)
+	err = ctx.GetStub().DelPrivateData(commitmentCollection, offerKey)
+	if err != nil {
+		return fmt.Errorf("failed to delete transfer agreement: %v", err)
+	}
+
+	buyerKey, err := objectKey(ctx, agreementByBuyerObjectType, buyerID, commitmentID)
+	if err != nil {
+		return err
+	}
+	err = ctx.GetStub().DelPrivateData(commitmentCollection, buyerKey)
+	if err != nil {
+		return fmt.Errorf("failed to delete buyer index of transfer agreement: %v", err)
+	}
+	return nil
+}
+
+// readOfferIndex returns the identities of the buyers with an open offer on the commitment
+func readOfferIndex(ctx contractapi.TransactionContextInterface, commitmentID string) ([]string, error) {
+	indexKey, err := objectKey(ctx, offerIndexObjectType, commitmentID)
+	if err != nil {
+		return nil, err
+	}
+
+	indexJSON, err := ctx.GetStub().GetPrivateData(commitmentCollection, indexKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read offer index: %v", err)
+	}
+
+	buyers := []string{}
+	if indexJSON == nil {
+		return buyers, nil
+	}
+
+	err = json.Unmarshal(indexJSON, &buyers)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal JSON: %v", err)
+	}
+	return buyers, nil
+}
+
+// putOfferIndex stores the buyers with an open offer on the commitment, deleting the index once empty
+func putOfferIndex(ctx contractapi.TransactionContextInterface, commitmentID string, buyers []string) error {
+	indexKey, err := objectKey(ctx, offerIndexObjectType, commitmentID)
+	if err != nil {
+		return err
+	}
+
+	if len(buyers) == 0 {
+		return ctx.GetStub().DelPrivateData(commitmentCollection, indexKey)
+	}
+
+	indexJSON, err := json.Marshal(buyers)
+	if err != nil {
+		return fmt.Errorf("failed to marshal offer index: %v", err)
+	}
+	return ctx.GetStub().PutPrivateData(commitmentCollection, indexKey, indexJSON)
+}
+
+// removeOffer returns the buyers without the given buyer
+func removeOffer(buyers []string, buyerID string) []string {
+	remaining := []string{}
+	for _, buyer := range buyers {
+		if buyer != buyerID {
+			remaining = append(remaining, buyer)
+		}
+	}
+	return remaining
+}
+
+// closeOffers deletes the offers of the given buyers on a commitment together with the offer index
+func closeOffers(ctx contractapi.TransactionContextInterface, commitmentID string, buyers []string) error {
+	for _, buyerID := range buyers {
+		err := deleteAgreement(ctx, commitmentID, buyerID)
+		if err != nil {
+			return err
+		}
+	}
+	return putOfferIndex(ctx, commitmentID, []string{})
+}
+
+// ListOffers returns the open offers on a commitment. Only the owner of the commitment can list its offers.
+func (s *SmartContract) ListOffers(ctx contractapi.TransactionContextInterface, commitmentID string) ([]*TransferAgreement, error) {
+
+	commitment, err := s.ReadCommitment(ctx, commitmentID)
+	if err != nil {
+		return nil, fmt.Errorf("error reading commitment: %v", err)
+	}
+	if commitment == nil {
+		return nil, fmt.Errorf("%v does not exist", commitmentID)
+	}
+
+	clientID, err := s.submittingClientIdentity(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if clientID != commitment.Owner {
+		return nil, fmt.Errorf("error: submitting client identity does not own commitment")
+	}
+
+	return listOffers(ctx, commitmentID)
+}
+
+// listOffers returns the open offers on a commitment
+func listOffers(ctx contractapi.TransactionContextInterface, commitmentID string) ([]*TransferAgreement, error) {
+	return readAgreements(ctx, []string{commitmentID})
+}
+
+// readAgreements returns the transfer agreements whose keys start with the given attributes,
+// ordered by commitment ID and buyer identity
+func readAgreements(ctx contractapi.TransactionContextInterface, attributes []string) ([]*TransferAgreement, error) {
+	resultsIterator, err := ctx.GetStub().GetPrivateDataByPartialCompositeKey(commitmentCollection, transferAgreementObjectType, attributes)
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	results := []*TransferAgreement{}
+
+	for resultsIterator.HasNext() {
+		response, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var agreement *TransferAgreement
+		err = json.Unmarshal(response.Value, &agreement)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal JSON: %v", err)
+		}
+
+		results = append(results, agreement)
+	}
+
+	return results, nil
+}
+
+// GetOpenTransferAgreements returns every open transfer agreement in the commitmentCollection
+func (s *SmartContract) GetOpenTransferAgreements(ctx contractapi.TransactionContextInterface) ([]*TransferAgreement, error) {
+	return readAgreements(ctx, []string{})
+}
+
+// GetTransferAgreementsByCommitment returns the open transfer agreements on a commitment
+func (s *SmartContract) GetTransferAgreementsByCommitment(ctx contractapi.TransactionContextInterface, commitmentID string) ([]*TransferAgreement, error) {
+	if len(commitmentID) == 0 {
+		return nil, fmt.Errorf("commitmentID must be a non-empty string")
+	}
+	return readAgreements(ctx, []string{commitmentID})
+}
+
+// GetTransferAgreementsByBuyer returns the open transfer agreements made by a buyer identity,
+// ordered by commitment ID. Agreements are keyed by commitment first, so they are found through
+// the buyer index written with each agreement.
+func (s *SmartContract) GetTransferAgreementsByBuyer(ctx contractapi.TransactionContextInterface, buyerID string) ([]*TransferAgreement, error) {
+	if len(buyerID) == 0 {
+		return nil, fmt.Errorf("buyerID must be a non-empty string")
+	}
+
+	resultsIterator, err := ctx.GetStub().GetPrivateDataByPartialCompositeKey(commitmentCollection, agreementByBuyerObjectType, []string{buyerID})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	results := []*TransferAgreement{}
+
+	for resultsIterator.HasNext() {
+		response, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		_, keyParts, err := ctx.GetStub().SplitCompositeKey(response.Key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to split composite key: %v", err)
+		}
+		if len(keyParts) != 2 {
+			return nil, fmt.Errorf("invalid buyer index key %v", response.Key)
+		}
+
+		agreement, err := s.ReadTransferAgreement(ctx, keyParts[1], buyerID)
+		if err != nil {
+			return nil, err
+		}
+		if agreement == nil {
+			return nil, fmt.Errorf("transfer agreement of buyer index key %v does not exist", response.Key)
+		}
+		results = append(results, agreement)
+	}
+	return results, nil
+}
+
+// GetTransferAgreementsOnMyCommitments returns the open transfer agreements on the commitments
+// owned by the submitting client
+func (s *SmartContract) GetTransferAgreementsOnMyCommitments(ctx contractapi.TransactionContextInterface) ([]*TransferAgreement, error) {
+	clientID, err := s.submittingClientIdentity(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	agreements, err := readAgreements(ctx, []string{})
+	if err != nil {
+		return nil, err
+	}
+
+	// Agreements are ordered by commitment, so each commitment is read once
+	results := []*TransferAgreement{}
+	var commitment *Commitment
+	for _, agreement := range agreements {
+		if commitment == nil || commitment.ID != agreement.ID {
+			commitment, err = s.ReadCommitment(ctx, agreement.ID)
+			if err != nil {
+				return nil, fmt.Errorf("error reading commitment: %v", err)
+			}
+			if commitment == nil {
+				return nil, fmt.Errorf("commitment %v of an open agreement does not exist", agreement.ID)
+			}
+		}
+		if commitment.Owner == clientID {
+			results = append(results, agreement)
+		}
+	}
+	return results, nil
+}
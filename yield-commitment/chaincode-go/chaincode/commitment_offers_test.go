@@ -0,0 +1,166 @@
+package chaincode
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/hyperledger/fabric-samples/yield-commitment/chaincode-go/simulator"
+	"github.com/stretchr/testify/require"
+)
+
+// listOffers returns the offers on a commitment as listed by the client
+func (n *testNetwork) listOffers(client *simulator.Client, id string) ([]*TransferAgreement, error) {
+	var offers []*TransferAgreement
+	err := n.evaluate(client, func(ctx contractapi.TransactionContextInterface) error {
+		var err error
+		offers, err = n.contract.ListOffers(ctx, id)
+		return err
+	})
+	return offers, err
+}
+
+func TestListOffers(t *testing.T) {
+	n := newTestNetwork(t)
+	n.createCommitment("c1")
+
+	_, err := n.listOffers(n.producer, "c2")
+	require.EqualError(t, err, "c2 does not exist")
+
+	offers, err := n.listOffers(n.producer, "c1")
+	require.NoError(t, err)
+	require.Empty(t, offers)
+
+	n.agree("c1", n.buyer)
+	n.mustSubmit(n.rival, "AgreeToTransfer", transient{"commitment_value": with(termsInput("c1"), "rate", 2800)})
+
+	// Only the owner sees the offers
+	_, err = n.listOffers(n.buyer, "c1")
+	require.EqualError(t, err, "error: submitting client identity does not own commitment")
+
+	offers, err = n.listOffers(n.producer, "c1")
+	require.NoError(t, err)
+	require.ElementsMatch(t, []*TransferAgreement{
+		{ID: "c1", BuyerID: n.buyer.ID(), BuyerMSP: "Org2MSP"},
+		{ID: "c1", BuyerID: n.rival.ID(), BuyerMSP: "Org2MSP"},
+	}, offers)
+
+	// A repeated offer replaces the buyer's earlier offer
+	n.mustSubmit(n.rival, "AgreeToTransfer", transient{"commitment_value": with(termsInput("c1"), "rate", 2900)})
+	offers, err = n.listOffers(n.producer, "c1")
+	require.NoError(t, err)
+	require.Len(t, offers, 2)
+
+	// Accepting one offer closes out the others
+	n.mustSubmit(n.producer, "TransferCommitment", transient{"commitment_owner": map[string]string{"commitmentID": "c1", "buyerMSP": "Org2MSP", "buyerID": n.buyer.ID()}})
+	offers, err = n.listOffers(n.buyer, "c1")
+	require.NoError(t, err)
+	require.Empty(t, offers)
+}
+
+func TestOfferIndex(t *testing.T) {
+	n := newTestNetwork(t)
+	n.createCommitment("c1")
+	n.agree("c1", n.buyer)
+	n.mustSubmit(n.rival, "AgreeToTransfer", transient{"commitment_value": termsInput("c1")})
+
+	err := n.evaluate(n.producer, func(ctx contractapi.TransactionContextInterface) error {
+		buyers, err := readOfferIndex(ctx, "c1")
+		require.Equal(t, []string{n.buyer.ID(), n.rival.ID()}, buyers)
+		return err
+	})
+	require.NoError(t, err)
+
+	n.mustSubmit(n.buyer, "DeleteTranferAgreement", transient{"agreement_delete": map[string]string{"commitmentID": "c1"}})
+	err = n.evaluate(n.producer, func(ctx contractapi.TransactionContextInterface) error {
+		buyers, err := readOfferIndex(ctx, "c1")
+		require.Equal(t, []string{n.rival.ID()}, buyers)
+		return err
+	})
+	require.NoError(t, err)
+
+	require.Equal(t, []string{"b"}, removeOffer([]string{"a", "b", "a"}, "a"))
+	require.Empty(t, removeOffer([]string{}, "a"))
+}
+
+// agreementIDs returns the commitment and buyer of each agreement
+func agreementIDs(n *testNetwork, agreements []*TransferAgreement) []string {
+	names := map[string]string{n.buyer.ID(): "buyer", n.rival.ID(): "rival"}
+	ids := []string{}
+	for _, agreement := range agreements {
+		ids = append(ids, agreement.ID+" "+names[agreement.BuyerID])
+	}
+	return ids
+}
+
+func TestTransferAgreementQueries(t *testing.T) {
+	n := newTestNetwork(t)
+	n.createCommitment("c1")
+	n.createCommitment("c2")
+	n.mustSubmit(n.other, "CreateCommitment", transient{"commitment_properties": commitmentInput("c3")})
+	n.agree("c1", n.buyer)
+	n.mustSubmit(n.rival, "AgreeToTransfer", transient{"commitment_value": termsInput("c1")})
+	n.mustSubmit(n.buyer, "AgreeToTransfer", transient{"commitment_value": termsInput("c2")})
+	n.mustSubmit(n.buyer, "AgreeToTransfer", transient{"commitment_value": termsInput("c3")})
+
+	// query evaluates a query for agreements as the client and returns the agreements it finds
+	query := func(client *simulator.Client, run func(ctx contractapi.TransactionContextInterface) ([]*TransferAgreement, error)) []string {
+		var agreements []*TransferAgreement
+		err := n.evaluate(client, func(ctx contractapi.TransactionContextInterface) error {
+			var err error
+			agreements, err = run(ctx)
+			return err
+		})
+		require.NoError(t, err)
+		return agreementIDs(n, agreements)
+	}
+	byBuyer := func(buyer *simulator.Client) []string {
+		return query(n.producer, func(ctx contractapi.TransactionContextInterface) ([]*TransferAgreement, error) {
+			return n.contract.GetTransferAgreementsByBuyer(ctx, buyer.ID())
+		})
+	}
+	onMyCommitments := func(owner *simulator.Client) []string {
+		return query(owner, func(ctx contractapi.TransactionContextInterface) ([]*TransferAgreement, error) {
+			return n.contract.GetTransferAgreementsOnMyCommitments(ctx)
+		})
+	}
+
+	require.Equal(t, []string{"c1 buyer", "c1 rival", "c2 buyer", "c3 buyer"}, query(n.rival, func(ctx contractapi.TransactionContextInterface) ([]*TransferAgreement, error) {
+		return n.contract.GetOpenTransferAgreements(ctx)
+	}))
+	require.Equal(t, []string{"c1 buyer", "c1 rival"}, query(n.producer, func(ctx contractapi.TransactionContextInterface) ([]*TransferAgreement, error) {
+		return n.contract.GetTransferAgreementsByCommitment(ctx, "c1")
+	}))
+	require.Equal(t, []string{"c1 buyer", "c2 buyer", "c3 buyer"}, byBuyer(n.buyer))
+	require.Equal(t, []string{"c1 rival"}, byBuyer(n.rival))
+	require.Equal(t, []string{}, byBuyer(n.producer))
+	require.Equal(t, []string{"c1 buyer", "c1 rival", "c2 buyer"}, onMyCommitments(n.producer))
+	require.Equal(t, []string{"c3 buyer"}, onMyCommitments(n.other))
+	require.Equal(t, []string{}, onMyCommitments(n.buyer))
+
+	err := n.evaluate(n.producer, func(ctx contractapi.TransactionContextInterface) error {
+		_, err := n.contract.GetTransferAgreementsByBuyer(ctx, "")
+		return err
+	})
+	require.EqualError(t, err, "buyerID must be a non-empty string")
+	err = n.evaluate(n.producer, func(ctx contractapi.TransactionContextInterface) error {
+		_, err := n.contract.GetTransferAgreementsByCommitment(ctx, "")
+		return err
+	})
+	require.EqualError(t, err, "commitmentID must be a non-empty string")
+
+	// The buyer index follows the offers closed by a transfer and withdrawn by the buyer
+	n.mustSubmit(n.producer, "TransferCommitment", transient{"commitment_owner": map[string]string{"commitmentID": "c1", "buyerMSP": "Org2MSP", "buyerID": n.buyer.ID()}})
+	n.mustSubmit(n.buyer, "DeleteTranferAgreement", transient{"agreement_delete": map[string]string{"commitmentID": "c2"}})
+	require.Equal(t, []string{"c3 buyer"}, byBuyer(n.buyer))
+	require.Equal(t, []string{}, byBuyer(n.rival))
+	require.Equal(t, []string{}, onMyCommitments(n.producer))
+
+	indexed := 0
+	for _, key := range n.ledger.PrivateDataKeys(commitmentCollection) {
+		if strings.HasPrefix(key, "\x00"+agreementByBuyerObjectType+"\x00") {
+			indexed++
+		}
+	}
+	require.Equal(t, 1, indexed)
+}
@@ -0,0 +1,165 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// PaginatedQueryResult is a page of commitments. Bookmark is passed to the next call to
+// fetch the following page, and is empty once there are no more commitments.
+type PaginatedQueryResult struct {
+	Records             []*Commitment `json:"records"`
+	FetchedRecordsCount int32         `json:"fetchedRecordsCount"`
+	Bookmark            string        `json:"bookmark"`
+}
+
+// GetCommitmentByRangeWithPagination performs a range query based on the start and end commitment IDs
+// provided, returning at most pageSize commitments. The paginated query APIs of Fabric are not available
+// for private data, so the bookmark is the ID of the last commitment returned and the next page continues
+// after it in key order, seeking through the commitment ID index. Pass an empty bookmark to fetch the
+// first page.
+func (s *SmartContract) GetCommitmentByRangeWithPagination(ctx contractapi.TransactionContextInterface, startKey string, endKey string, pageSize int, bookmark string) (*PaginatedQueryResult, error) {
+	if pageSize <= 0 {
+		return nil, fmt.Errorf("pageSize must be a positive integer")
+	}
+
+	// The smallest ID after the bookmark is the bookmark followed by a null character
+	rangeStart := commitmentRangeIndexKey(startKey)
+	if bookmark != "" && bookmark >= startKey {
+		rangeStart = commitmentRangeIndexKey(bookmark + "\x00")
+	}
+	rangeEnd := commitmentRangeIndexKey(endKey)
+	if endKey == "" {
+		rangeEnd = commitmentRangeIndexKey(string(utf8.MaxRune))
+	}
+
+	resultsIterator, err := ctx.GetStub().GetPrivateDataByRange(commitmentCollection, rangeStart, rangeEnd)
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	result := &PaginatedQueryResult{Records: []*Commitment{}}
+
+	for resultsIterator.HasNext() {
+		response, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		// A further commitment in range means there is another page
+		if len(result.Records) == pageSize {
+			result.Bookmark = result.Records[pageSize-1].ID
+			break
+		}
+
+		commitment, err := s.ReadCommitment(ctx, strings.TrimPrefix(response.Key, commitmentRangeIndexPrefix))
+		if err != nil {
+			return nil, err
+		}
+		if commitment == nil {
+			continue
+		}
+
+		result.Records = append(result.Records, commitment)
+	}
+
+	result.FetchedRecordsCount = int32(len(result.Records))
+	return result, nil
+}
+
+// QueryCommitmentsWithPagination uses a query string to perform a query for commitments, returning
+// at most pageSize commitments. The bookmark is the number of matching commitments to skip, passed to
+// the state database as the skip option of the selector. Pass an empty bookmark to fetch the first page.
+// The query only matches commitments, whatever its selector, see pinQueryToType.
+// Only available on state databases that support rich query (e.g. CouchDB)
+func (s *SmartContract) QueryCommitmentsWithPagination(ctx contractapi.TransactionContextInterface, queryString string, pageSize int, bookmark string) (*PaginatedQueryResult, error) {
+	err := validateQueryString(queryString, commitmentQueryFields)
+	if err != nil {
+		return nil, err
+	}
+	queryString, err = pinQueryToType(queryString, commitmentCollection, commitmentObjectType)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.getQueryResultForQueryStringWithPagination(ctx, queryString, pageSize, bookmark)
+}
+
+// getQueryResultForQueryStringWithPagination executes the passed in query string from the offset in the bookmark.
+func (s *SmartContract) getQueryResultForQueryStringWithPagination(ctx contractapi.TransactionContextInterface, queryString string, pageSize int, bookmark string) (*PaginatedQueryResult, error) {
+	if pageSize <= 0 {
+		return nil, fmt.Errorf("pageSize must be a positive integer")
+	}
+
+	skip := 0
+	if bookmark != "" {
+		var err error
+		skip, err = strconv.Atoi(bookmark)
+		if err != nil || skip < 0 {
+			return nil, fmt.Errorf("invalid bookmark %v", bookmark)
+		}
+	}
+
+	var query map[string]json.RawMessage
+	err := json.Unmarshal([]byte(queryString), &query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse query string: %v", err)
+	}
+	// The peer replaces any limit with its own and pages through the state database
+	// internally, so the page size is applied while iterating the results
+	delete(query, "limit")
+	query["skip"] = json.RawMessage(strconv.Itoa(skip))
+
+	pagedQuery, err := json.Marshal(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal query: %v", err)
+	}
+
+	resultsIterator, err := ctx.GetStub().GetPrivateDataQueryResult(commitmentCollection, string(pagedQuery))
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	records, err := readCommitmentPage(resultsIterator, pageSize)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &PaginatedQueryResult{
+		Records:             records,
+		FetchedRecordsCount: int32(len(records)),
+	}
+	if resultsIterator.HasNext() {
+		result.Bookmark = strconv.Itoa(skip + len(records))
+	}
+	return result, nil
+}
+
+// readCommitmentPage reads at most pageSize commitments from the iterator
+func readCommitmentPage(resultsIterator shim.StateQueryIteratorInterface, pageSize int) ([]*Commitment, error) {
+	results := []*Commitment{}
+
+	for len(results) < pageSize && resultsIterator.HasNext() {
+		response, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var commitment *Commitment
+		err = json.Unmarshal(response.Value, &commitment)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal JSON: %v", err)
+		}
+
+		results = append(results, commitment)
+	}
+	return results, nil
+}
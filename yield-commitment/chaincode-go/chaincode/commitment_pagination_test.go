@@ -0,0 +1,168 @@
+package chaincode
+
+import (
+	"testing"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/stretchr/testify/require"
+)
+
+// page is the IDs and bookmark of a page of commitments
+type page struct {
+	ids      []string
+	bookmark string
+}
+
+func TestGetCommitmentByRangeWithPagination(t *testing.T) {
+	n := newQueryNetwork(t)
+
+	cases := []struct {
+		name       string
+		start, end string
+		pageSize   int
+		bookmark   string
+		pages      []page
+	}{
+		{name: "single page", pageSize: 4, pages: []page{{ids: []string{"c1", "c2", "c3", "c4"}}}},
+		{name: "two pages", pageSize: 3, pages: []page{{[]string{"c1", "c2", "c3"}, "c3"}, {ids: []string{"c4"}}}},
+		{name: "bounded range", start: "c2", end: "c4", pageSize: 1, pages: []page{{[]string{"c2"}, "c2"}, {ids: []string{"c3"}}}},
+		{name: "open end", start: "c3", pageSize: 1, pages: []page{{[]string{"c3"}, "c3"}, {ids: []string{"c4"}}}},
+		{name: "empty range", start: "d", pageSize: 2, pages: []page{{ids: []string{}}}},
+		{name: "bookmark before the range", start: "c3", pageSize: 4, bookmark: "c1", pages: []page{{ids: []string{"c3", "c4"}}}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := n.evaluate(n.buyer, func(ctx contractapi.TransactionContextInterface) error {
+				bookmark := tc.bookmark
+				for _, expected := range tc.pages {
+					result, err := n.contract.GetCommitmentByRangeWithPagination(ctx, tc.start, tc.end, tc.pageSize, bookmark)
+					if err != nil {
+						return err
+					}
+					require.Equal(t, expected.ids, commitmentIDs(result.Records))
+					require.Equal(t, int32(len(expected.ids)), result.FetchedRecordsCount)
+					require.Equal(t, expected.bookmark, result.Bookmark)
+					bookmark = result.Bookmark
+				}
+				return nil
+			})
+			require.NoError(t, err)
+		})
+	}
+
+	err := n.evaluate(n.buyer, func(ctx contractapi.TransactionContextInterface) error {
+		_, err := n.contract.GetCommitmentByRangeWithPagination(ctx, "", "", 0, "")
+		return err
+	})
+	require.EqualError(t, err, "pageSize must be a positive integer")
+}
+
+func TestGetCommitmentByRangeWithPaginationAfterMigration(t *testing.T) {
+	n := newTestNetwork(t)
+	n.seedLegacyKeys()
+	require.NoError(t, n.migrate(commitmentCollection, "c1"))
+	n.createCommitment("c2")
+
+	err := n.evaluate(n.producer, func(ctx contractapi.TransactionContextInterface) error {
+		result, err := n.contract.GetCommitmentByRangeWithPagination(ctx, "", "", 1, "")
+		require.Equal(t, []string{"c1"}, commitmentIDs(result.Records))
+		require.Equal(t, "c1", result.Bookmark)
+		return err
+	})
+	require.NoError(t, err)
+}
+
+func TestQueryCommitmentsWithPagination(t *testing.T) {
+	n := newQueryNetwork(t)
+
+	cases := []struct {
+		name     string
+		query    string
+		pageSize int
+		bookmark string
+		pages    []page
+		err      string
+	}{
+		{
+			name:     "two pages",
+			query:    `{"selector":{"crop":"corn"}}`,
+			pageSize: 2,
+			pages:    []page{{[]string{"c1", "c3"}, "2"}, {ids: []string{"c4"}}},
+		},
+		{
+			name:     "sorted",
+			query:    `{"selector":{"objectType":"commitment"},"sort":[{"production":"desc"}]}`,
+			pageSize: 3,
+			pages:    []page{{[]string{"c2", "c1", "c4"}, "3"}, {ids: []string{"c3"}}},
+		},
+		{
+			name:     "limit of the query is replaced by the page size",
+			query:    `{"selector":{"crop":"corn"},"limit":1}`,
+			pageSize: 3,
+			pages:    []page{{ids: []string{"c1", "c3", "c4"}}},
+		},
+		{
+			name:     "bookmark past the last match",
+			query:    `{"selector":{"crop":"corn"}}`,
+			pageSize: 2,
+			bookmark: "5",
+			pages:    []page{{ids: []string{}}},
+		},
+		{
+			name:     "page size",
+			query:    `{"selector":{"crop":"corn"}}`,
+			pageSize: 0,
+			err:      "pageSize must be a positive integer",
+		},
+		{
+			name:     "malformed bookmark",
+			query:    `{"selector":{"crop":"corn"}}`,
+			pageSize: 2,
+			bookmark: "c3",
+			err:      "invalid bookmark c3",
+		},
+		{
+			name:     "negative bookmark",
+			query:    `{"selector":{"crop":"corn"}}`,
+			pageSize: 2,
+			bookmark: "-1",
+			err:      "invalid bookmark -1",
+		},
+		{
+			name:     "field that is not allowed",
+			query:    `{"selector":{"salt":"a3c9e1"}}`,
+			pageSize: 2,
+			err:      "salt",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := n.evaluate(n.producer, func(ctx contractapi.TransactionContextInterface) error {
+				bookmark := tc.bookmark
+				result, err := n.contract.QueryCommitmentsWithPagination(ctx, tc.query, tc.pageSize, bookmark)
+				if err != nil {
+					return err
+				}
+				for i, expected := range tc.pages {
+					if i > 0 {
+						result, err = n.contract.QueryCommitmentsWithPagination(ctx, tc.query, tc.pageSize, bookmark)
+						require.NoError(t, err)
+					}
+					require.Equal(t, expected.ids, commitmentIDs(result.Records))
+					require.Equal(t, int32(len(expected.ids)), result.FetchedRecordsCount)
+					require.Equal(t, expected.bookmark, result.Bookmark)
+					bookmark = result.Bookmark
+				}
+				return nil
+			})
+			if tc.err != "" {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), tc.err)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
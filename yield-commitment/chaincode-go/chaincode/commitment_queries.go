@@ -12,7 +12,11 @@ import (
 func (s *SmartContract) ReadCommitment(ctx contractapi.TransactionContextInterface, commitmentID string) (*Commitment, error) {
 
 	log.Printf("ReadCommitment: collection %v, ID %v", commitmentCollection, commitmentID)
-	commitmentJSON, err := ctx.GetStub().GetPrivateData(commitmentCollection, commitmentID) //get the commitment from chaincode state
+	commitmentKey, err := objectKey(ctx, commitmentObjectType, commitmentID)
+	if err != nil {
+		return nil, err
+	}
+	commitmentJSON, err := ctx.GetStub().GetPrivateData(commitmentCollection, commitmentKey) //get the commitment from chaincode state
 	if err != nil {
 		return nil, fmt.Errorf("failed to read commitment: %v", err)
 	}
@@ -36,7 +40,11 @@ func (s *SmartContract) ReadCommitment(ctx contractapi.TransactionContextInterfa
 func (s *SmartContract) ReadProduced(ctx contractapi.TransactionContextInterface, yieldID string) (*Yield, error){
 
 	log.Printf("ReadYield: collection %v, ID %v", yieldCollection, yieldID)
-	yieldJSON, err := ctx.GetStub().GetPrivateData(yieldCollection, yieldID) //get the commitment from chaincode state
+	yieldKey, err := objectKey(ctx, yieldObjectType, yieldID)
+	if err != nil {
+		return nil, err
+	}
+	yieldJSON, err := ctx.GetStub().GetPrivateData(yieldCollection, yieldKey) //get the commitment from chaincode state
 	if err != nil {
 		return nil, fmt.Errorf("failed to read yield: %v", err)
 	}
@@ -56,10 +64,16 @@ func (s *SmartContract) ReadProduced(ctx contractapi.TransactionContextInterface
 	return yield, nil
 }
 
+// ReadData returns the reputation computed for a producer together with the fulfillment
+// history it was derived from. The dataID is the producer's client identity.
 func (s *SmartContract) ReadData(ctx contractapi.TransactionContextInterface, dataID string) (*Data, error) {
 	
 	log.Printf("ReadData: collection %v, ID %v", dataCollection, dataID)
-	dataJSON, err := ctx.GetStub().GetPrivateData(dataCollection, dataID) //get the commitment from chaincode state
+	dataKey, err := objectKey(ctx, dataObjectType, dataID)
+	if err != nil {
+		return nil, err
+	}
+	dataJSON, err := ctx.GetStub().GetPrivateData(dataCollection, dataKey) //get the commitment from chaincode state
 	if err != nil {
 		return nil, fmt.Errorf("failed to read data: %v", err)
 	}
@@ -80,10 +94,19 @@ func (s *SmartContract) ReadData(ctx contractapi.TransactionContextInterface, da
 }
 
 
-// ReadCommitmentPrivateDetails reads the commitment private details in organization specific collection
+// ReadCommitmentPrivateDetails reads the commitment private details in organization specific collection.
+// The details returned are the ones held by the submitting client, either as owner or as buyer.
 func (s *SmartContract) ReadCommitmentPrivateDetails(ctx contractapi.TransactionContextInterface, collection string, commitmentID string) (*CommitmentPrivateDetails, error) {
 	log.Printf("ReadCommitmentPrivateDetails: collection %v, ID %v", collection, commitmentID)
-	commitmentDetailsJSON, err := ctx.GetStub().GetPrivateData(collection, commitmentID) // Get the commitment from chaincode state
+	clientID, err := s.submittingClientIdentity(ctx)
+	if err != nil {
+		return nil, err
+	}
+	detailsKey, err := privateDetailsKey(ctx, commitmentID, clientID)
+	if err != nil {
+		return nil, err
+	}
+	commitmentDetailsJSON, err := ctx.GetStub().GetPrivateData(collection, detailsKey) // Get the commitment from chaincode state
 	if err != nil {
 		return nil, fmt.Errorf("failed to read commitment details: %v", err)
 	}
@@ -101,60 +124,55 @@ func (s *SmartContract) ReadCommitmentPrivateDetails(ctx contractapi.Transaction
 	return commitmentDetails, nil
 }
 
-// ReadTransferAgreement gets the buyer's identity from the transfer agreement from collection
-func (s *SmartContract) ReadTransferAgreement(ctx contractapi.TransactionContextInterface, commitmentID string) (*TransferAgreement, error) {
-	log.Printf("ReadTransferAgreement: collection %v, ID %v", commitmentCollection, commitmentID)
-	// composite key for TransferAgreement of this commitment
-	transferAgreeKey, err := ctx.GetStub().CreateCompositeKey(transferAgreementObjectType, []string{commitmentID})
+// ReadTransferAgreement gets the offer a buyer made on a commitment from collection
+func (s *SmartContract) ReadTransferAgreement(ctx contractapi.TransactionContextInterface, commitmentID string, buyerID string) (*TransferAgreement, error) {
+	log.Printf("ReadTransferAgreement: collection %v, ID %v, buyer %v", commitmentCollection, commitmentID, buyerID)
+	// composite key for TransferAgreement of this commitment and buyer
+	transferAgreeKey, err := transferAgreementKey(ctx, commitmentID, buyerID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create composite key: %v", err)
+		return nil, err
 	}
 
-	buyerIdentity, err := ctx.GetStub().GetPrivateData(commitmentCollection, transferAgreeKey) // Get the identity from collection
+	agreementJSON, err := ctx.GetStub().GetPrivateData(commitmentCollection, transferAgreeKey) // Get the agreement from collection
 	if err != nil {
 		return nil, fmt.Errorf("failed to read TransferAgreement: %v", err)
 	}
-	if buyerIdentity == nil {
-		log.Printf("TransferAgreement for %v does not exist", commitmentID)
+	if agreementJSON == nil {
+		log.Printf("TransferAgreement for %v from %v does not exist", commitmentID, buyerID)
 		return nil, nil
 	}
-	agreement := &TransferAgreement{
-		ID:      commitmentID,
-		BuyerID: string(buyerIdentity),
+
+	var agreement *TransferAgreement
+	err = json.Unmarshal(agreementJSON, &agreement)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal JSON: %v", err)
 	}
 	return agreement, nil
 }
 
-// GetCommitmentByRange performs a range query based on the start and end keys provided. Range
-// queries can be used to read data from private data collections, but can not be used in
-// a transaction that also writes to private data.
+// GetCommitmentByRange performs a range query based on the start and end commitment IDs provided.
+// The start ID is inclusive and the end ID exclusive, an empty string leaves that end of the range open.
+// Commitments are stored under composite keys, which cannot be used with GetPrivateDataByRange, so the
+// commitment keys are iterated in key order and filtered on the ID. Range queries can be used to read
+// data from private data collections, but can not be used in a transaction that also writes to private data.
+// The whole range is loaded into memory, use GetCommitmentByRangeWithPagination for large ranges.
 func (s *SmartContract) GetCommitmentByRange(ctx contractapi.TransactionContextInterface, startKey string, endKey string) ([]*Commitment, error) {
-
-	resultsIterator, err := ctx.GetStub().GetPrivateDataByRange(commitmentCollection, startKey, endKey)
-	if err != nil {
-		return nil, err
-	}
-	defer resultsIterator.Close()
-
 	results := []*Commitment{}
-
-	for resultsIterator.HasNext() {
-		response, err := resultsIterator.Next()
-		if err != nil {
-			return nil, err
-		}
-
+	err := iterateRange(ctx, commitmentCollection, commitmentObjectType, startKey, endKey, func(value []byte) error {
 		var commitment *Commitment
-		err = json.Unmarshal(response.Value, &commitment)
+		err := json.Unmarshal(value, &commitment)
 		if err != nil {
-			return nil, fmt.Errorf("failed to unmarshal JSON: %v", err)
+			return fmt.Errorf("failed to unmarshal JSON: %v", err)
 		}
 
 		results = append(results, commitment)
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	return results, nil
-
 }
 
 // =======Rich queries =========================================================================
@@ -172,14 +190,18 @@ func (s *SmartContract) GetCommitmentByRange(ctx contractapi.TransactionContextI
 
 // ===== Example: Parameterized rich query =================================================
 
-// QueryCommitmentByOwner queries for commitments based on commitmentType, owner.
+// QueryCommitmentByOwner queries for commitments based on commitmentType, owner. Only
+// commitments are returned, commitmentType can be empty or commitment.
 // This is an example of a parameterized query where the query logic is baked into the chaincode,
 // and accepting a single query parameter (owner).
 // Only available on state databases that support rich query (e.g. CouchDB)
 // =========================================================================================
 func (s *SmartContract) QueryCommitmentByOwner(ctx contractapi.TransactionContextInterface, commitmentType string, owner string) ([]*Commitment, error) {
 
-	queryString := fmt.Sprintf("{\"selector\":{\"objectType\":\"%v\",\"owner\":\"%v\"}}", commitmentType, owner)
+	queryString, err := buildCommitmentSelector(CommitmentFilter{ObjectType: commitmentType, Owner: owner})
+	if err != nil {
+		return nil, err
+	}
 
 	queryResults, err := s.getQueryResultForQueryString(ctx, queryString)
 	if err != nil {
@@ -188,13 +210,38 @@ func (s *SmartContract) QueryCommitmentByOwner(ctx contractapi.TransactionContex
 	return queryResults, nil
 }
 
+// QueryCommitmentsByFilter queries for commitments matching the filter. The selector is built
+// by the chaincode from the typed filter, see query_builder.go.
+// Only available on state databases that support rich query (e.g. CouchDB)
+func (s *SmartContract) QueryCommitmentsByFilter(ctx contractapi.TransactionContextInterface, filter CommitmentFilter) ([]*Commitment, error) {
+
+	queryString, err := buildCommitmentSelector(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.getQueryResultForQueryString(ctx, queryString)
+}
+
 // QueryCommitments uses a query string to perform a query for commitments.
-// Query string matching state database syntax is passed in and executed as is.
+// Query string matching state database syntax is passed in and executed once it has been
+// checked against the allowed fields and operators, see validateQueryString. The query only
+// matches commitments, whatever its selector, see pinQueryToType.
 // Supports ad hoc queries that can be defined at runtime by the client.
 // If this is not desired, follow the QueryCommitmentByOwner example for parameterized queries.
+// Use QueryCommitmentsWithPagination to browse large result sets.
 // Only available on state databases that support rich query (e.g. CouchDB)
 func (s *SmartContract) QueryCommitments(ctx contractapi.TransactionContextInterface, queryString string) ([]*Commitment, error) {
 
+	err := validateQueryString(queryString, commitmentQueryFields)
+	if err != nil {
+		return nil, err
+	}
+	queryString, err = pinQueryToType(queryString, commitmentCollection, commitmentObjectType)
+	if err != nil {
+		return nil, err
+	}
+
 	queryResults, err := s.getQueryResultForQueryString(ctx, queryString)
 	if err != nil {
 		return nil, err
@@ -0,0 +1,391 @@
+package chaincode
+
+import (
+	"testing"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/hyperledger/fabric-samples/yield-commitment/chaincode-go/simulator"
+	"github.com/stretchr/testify/require"
+)
+
+// newQueryNetwork returns a network with four commitments:
+//
+//	c1  corn   Iowa    production 100  size 40   producer, Delivering
+//	c2  wheat  Kansas  production 300  size 120  producer, Open
+//	c3  corn   Iowa    production 50   size 20   other, Open
+//	c4  corn   Kansas  production 100  size 40   buyer, Transferred from the producer
+//
+// The producer has reported a yield y1 of 40 on c1.
+func newQueryNetwork(t *testing.T) *testNetwork {
+	n := newTestNetwork(t)
+	n.createCommitment("c1")
+	n.mustSubmit(n.producer, "CreateCommitment", transient{"commitment_properties": with(with(with(with(commitmentInput("c2"),
+		"crop", "wheat"), "location", "Kansas"), "production", 300), "size", 120)})
+	n.mustSubmit(n.other, "CreateCommitment", transient{"commitment_properties": with(with(commitmentInput("c3"), "production", 50), "size", 20)})
+	n.mustSubmit(n.producer, "CreateCommitment", transient{"commitment_properties": with(commitmentInput("c4"), "location", "Kansas")})
+	n.agree("c4", n.buyer)
+	n.mustSubmit(n.producer, "TransferCommitment", transient{"commitment_owner": map[string]string{"commitmentID": "c4", "buyerMSP": "Org2MSP", "buyerID": n.buyer.ID()}})
+	n.mustSubmit(n.producer, "CreateYield", transient{"yield_properties": map[string]interface{}{"objectType": "yield", "yieldID": "y1", "commitmentID": "c1", "produced": 40}})
+	return n
+}
+
+func commitmentIDs(commitments []*Commitment) []string {
+	ids := []string{}
+	for _, commitment := range commitments {
+		ids = append(ids, commitment.ID)
+	}
+	return ids
+}
+
+func TestReadCommitment(t *testing.T) {
+	n := newQueryNetwork(t)
+
+	cases := []struct {
+		id     string
+		client *simulator.Client
+		owner  *simulator.Client
+		status string
+	}{
+		{id: "c1", client: n.producer, owner: n.producer, status: StatusDelivering},
+		{id: "c3", client: n.buyer, owner: n.other, status: StatusOpen},
+		{id: "c4", client: n.buyer, owner: n.buyer, status: StatusTransferred},
+		{id: "missing", client: n.producer},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.id, func(t *testing.T) {
+			err := n.evaluate(tc.client, func(ctx contractapi.TransactionContextInterface) error {
+				commitment, err := n.contract.ReadCommitment(ctx, tc.id)
+				if tc.owner == nil {
+					require.Nil(t, commitment)
+					return err
+				}
+				require.NotNil(t, commitment)
+				require.Equal(t, tc.owner.ID(), commitment.Owner)
+				require.Equal(t, tc.status, commitment.Status)
+				return err
+			})
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestReadProducedAndData(t *testing.T) {
+	n := newQueryNetwork(t)
+
+	err := n.evaluate(n.buyer, func(ctx contractapi.TransactionContextInterface) error {
+		yield, err := n.contract.ReadProduced(ctx, "y1")
+		require.NoError(t, err)
+		require.Equal(t, "c1", yield.CommitmentID)
+		require.Equal(t, 40.0, yield.Produced)
+
+		yield, err = n.contract.ReadProduced(ctx, "y2")
+		require.NoError(t, err)
+		require.Nil(t, yield)
+
+		// Reputation data is kept under the producer's identity
+		data, err := n.contract.ReadData(ctx, n.producer.ID())
+		require.NoError(t, err)
+		require.NotNil(t, data)
+		require.Equal(t, n.producer.ID(), data.Owner)
+		require.Equal(t, 40.0, data.Delivered)
+
+		data, err = n.contract.ReadData(ctx, n.buyer.ID())
+		require.NoError(t, err)
+		require.Nil(t, data)
+		return nil
+	})
+	require.NoError(t, err)
+}
+
+func TestReadCommitmentPrivateDetails(t *testing.T) {
+	n := newQueryNetwork(t)
+
+	cases := []struct {
+		name       string
+		client     *simulator.Client
+		peerMSP    string
+		collection string
+		id         string
+		rate       int // zero if no details are expected
+		err        string
+	}{
+		{name: "owner", client: n.producer, collection: "Org1MSPPrivateCollection", id: "c1", rate: 2500},
+		{name: "other client of the owner org", client: n.other, collection: "Org1MSPPrivateCollection", id: "c1"},
+		{name: "new owner after a transfer", client: n.buyer, collection: "Org2MSPPrivateCollection", id: "c4", rate: 3000},
+		{name: "previous owner after a transfer", client: n.producer, collection: "Org1MSPPrivateCollection", id: "c4"},
+		{name: "unknown commitment", client: n.producer, collection: "Org1MSPPrivateCollection", id: "c9"},
+		{name: "collection of another org", client: n.buyer, collection: "Org1MSPPrivateCollection", id: "c1", err: "not a member of collection"},
+		{name: "collection of another org on its peer", client: n.buyer, peerMSP: "Org1MSP", collection: "Org1MSPPrivateCollection", id: "c1", err: "does not have read access"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			tx := n.ledger.NewTransaction(tc.client, "ReadCommitmentPrivateDetails")
+			if tc.peerMSP != "" {
+				tx.OnPeer(tc.peerMSP)
+			}
+			err := n.ledger.Evaluate(tx, func(ctx contractapi.TransactionContextInterface) error {
+				details, err := n.contract.ReadCommitmentPrivateDetails(ctx, tc.collection, tc.id)
+				if err != nil {
+					return err
+				}
+				if tc.rate == 0 {
+					require.Nil(t, details)
+				} else {
+					require.NotNil(t, details)
+					require.Equal(t, tc.rate, details.Rate)
+				}
+				return nil
+			})
+			if tc.err != "" {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), tc.err)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestReadTransferAgreement(t *testing.T) {
+	n := newQueryNetwork(t)
+	n.mustSubmit(n.buyer, "AgreeToTransfer", transient{"commitment_value": with(termsInput("c2"), "quantity", 300)})
+
+	cases := []struct {
+		name  string
+		id    string
+		buyer *simulator.Client
+		found bool
+	}{
+		{name: "open offer", id: "c2", buyer: n.buyer, found: true},
+		{name: "buyer without an offer", id: "c2", buyer: n.rival},
+		{name: "offer accepted by a transfer", id: "c4", buyer: n.buyer},
+		{name: "unknown commitment", id: "c9", buyer: n.buyer},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := n.evaluate(n.producer, func(ctx contractapi.TransactionContextInterface) error {
+				agreement, err := n.contract.ReadTransferAgreement(ctx, tc.id, tc.buyer.ID())
+				if tc.found {
+					require.Equal(t, &TransferAgreement{ID: tc.id, BuyerID: tc.buyer.ID(), BuyerMSP: tc.buyer.MSPID()}, agreement)
+				} else {
+					require.Nil(t, agreement)
+				}
+				return err
+			})
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestGetCommitmentByRange(t *testing.T) {
+	n := newQueryNetwork(t)
+
+	cases := []struct {
+		name       string
+		start, end string
+		ids        []string
+	}{
+		{name: "open range", ids: []string{"c1", "c2", "c3", "c4"}},
+		{name: "bounded range", start: "c2", end: "c4", ids: []string{"c2", "c3"}},
+		{name: "open end", start: "c3", ids: []string{"c3", "c4"}},
+		{name: "open start", end: "c2", ids: []string{"c1"}},
+		{name: "empty range", start: "d", ids: []string{}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := n.evaluate(n.buyer, func(ctx contractapi.TransactionContextInterface) error {
+				commitments, err := n.contract.GetCommitmentByRange(ctx, tc.start, tc.end)
+				require.Equal(t, tc.ids, commitmentIDs(commitments))
+				return err
+			})
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestQueryCommitmentByOwner(t *testing.T) {
+	n := newQueryNetwork(t)
+
+	cases := []struct {
+		name           string
+		commitmentType string
+		owner          string
+		ids            []string
+		err            string
+	}{
+		{name: "producer", commitmentType: "commitment", owner: n.producer.ID(), ids: []string{"c1", "c2"}},
+		{name: "any object type", owner: n.producer.ID(), ids: []string{"c1", "c2"}},
+		{name: "buyer", commitmentType: "commitment", owner: n.buyer.ID(), ids: []string{"c4"}},
+		{name: "owner without commitments", commitmentType: "commitment", owner: n.rival.ID(), ids: []string{}},
+		{name: "other object type", commitmentType: "yield", owner: n.producer.ID(), err: "objectType must be commitment"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := n.evaluate(n.producer, func(ctx contractapi.TransactionContextInterface) error {
+				commitments, err := n.contract.QueryCommitmentByOwner(ctx, tc.commitmentType, tc.owner)
+				if err == nil {
+					require.Equal(t, tc.ids, commitmentIDs(commitments))
+				}
+				return err
+			})
+			if tc.err != "" {
+				require.EqualError(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestQueryCommitmentsByFilter(t *testing.T) {
+	n := newQueryNetwork(t)
+
+	cases := []struct {
+		name   string
+		filter CommitmentFilter
+		ids    []string
+		err    string
+	}{
+		{name: "every commitment", filter: CommitmentFilter{ObjectType: "commitment"}, ids: []string{"c1", "c2", "c3", "c4"}},
+		{name: "crop", filter: CommitmentFilter{Crop: "corn"}, ids: []string{"c1", "c3", "c4"}},
+		{name: "crop and location", filter: CommitmentFilter{Crop: "corn", Location: "Iowa"}, ids: []string{"c1", "c3"}},
+		{name: "status", filter: CommitmentFilter{Status: StatusTransferred}, ids: []string{"c4"}},
+		{name: "production range", filter: CommitmentFilter{MinProduction: 60, MaxProduction: 200}, ids: []string{"c1", "c4"}},
+		{name: "minimum size", filter: CommitmentFilter{MinSize: 100}, ids: []string{"c2"}},
+		{name: "no match", filter: CommitmentFilter{Crop: "rice"}, ids: []string{}},
+		{name: "inverted production range", filter: CommitmentFilter{MinProduction: 200, MaxProduction: 100}, err: "minimum production 200 is greater than maximum 100"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := n.evaluate(n.producer, func(ctx contractapi.TransactionContextInterface) error {
+				commitments, err := n.contract.QueryCommitmentsByFilter(ctx, tc.filter)
+				if err != nil {
+					return err
+				}
+				require.Equal(t, tc.ids, commitmentIDs(commitments))
+				return nil
+			})
+			if tc.err != "" {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), tc.err)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestQueryCommitmentsLeavesOutLots(t *testing.T) {
+	n := newTestNetwork(t)
+	n.pool()
+
+	err := n.evaluate(n.producer, func(ctx contractapi.TransactionContextInterface) error {
+		// The lot record of l1 has a crop too, only the lot commitment is returned
+		commitments, err := n.contract.QueryCommitmentsByFilter(ctx, CommitmentFilter{Crop: "corn"})
+		require.NoError(t, err)
+		require.Equal(t, []string{"c1", "c2", "l1"}, commitmentIDs(commitments))
+
+		commitments, err = n.contract.QueryCommitmentByOwner(ctx, "", n.producer.ID())
+		require.NoError(t, err)
+		require.Equal(t, []string{"c1", "c2", "l1"}, commitmentIDs(commitments))
+		return nil
+	})
+	require.NoError(t, err)
+}
+
+func TestQueryCommitments(t *testing.T) {
+	n := newQueryNetwork(t)
+
+	cases := []struct {
+		name  string
+		query string
+		ids   []string
+		err   string
+	}{
+		{
+			name:  "selector on an allowed field",
+			query: `{"selector":{"objectType":"commitment","crop":"wheat"}}`,
+			ids:   []string{"c2"},
+		},
+		{
+			name:  "combination and sort",
+			query: `{"selector":{"$or":[{"location":"Kansas"},{"production":{"$lt":60}}]},"sort":[{"production":"desc"}]}`,
+			ids:   []string{"c2", "c4", "c3"},
+		},
+		{
+			name:  "skip",
+			query: `{"selector":{"crop":"corn"},"skip":1}`,
+			ids:   []string{"c3", "c4"},
+		},
+		{
+			name:  "records that are not commitments",
+			query: `{"selector":{"commitmentID":{"$exists":true}}}`,
+			ids:   []string{"c1", "c2", "c3", "c4"},
+		},
+		{
+			name:  "selector on another object type",
+			query: `{"selector":{"objectType":"audit"}}`,
+			ids:   []string{},
+		},
+		{
+			name:  "empty selector",
+			query: `{"selector":{}}`,
+			ids:   []string{"c1", "c2", "c3", "c4"},
+		},
+		{
+			name:  "malformed query",
+			query: `{"selector":`,
+			err:   "query",
+		},
+		{
+			name:  "null selector",
+			query: `{"selector":null}`,
+			err:   "selector must be a JSON object, not null",
+		},
+		{
+			name:  "null nested selector",
+			query: `{"selector":{"$or":[{"crop":"corn"},null]}}`,
+			err:   "selector must be a JSON object, not null",
+		},
+		{
+			name:  "field that is not allowed",
+			query: `{"selector":{"salt":"a3c9e1"}}`,
+			err:   "salt",
+		},
+		{
+			name:  "operator that is not allowed",
+			query: `{"selector":{"crop":{"$regex":"^c"}}}`,
+			err:   "$regex",
+		},
+		{
+			name:  "option that is not allowed",
+			query: `{"selector":{"crop":"corn"},"execution_stats":true}`,
+			err:   "execution_stats",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := n.evaluate(n.producer, func(ctx contractapi.TransactionContextInterface) error {
+				commitments, err := n.contract.QueryCommitments(ctx, tc.query)
+				if err != nil {
+					return err
+				}
+				require.Equal(t, tc.ids, commitmentIDs(commitments))
+				return nil
+			})
+			if tc.err != "" {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), tc.err)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,234 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/hyperledger/fabric-samples/yield-commitment/chaincode-go/events"
+)
+
+// CommitmentPart describes a child commitment to be split off a commitment
+type CommitmentPart struct {
+	ID         string `json:"commitmentID"`
+	Production int    `json:"production"`
+	Size       int    `json:"size"`
+}
+
+// SplitCommitment divides a commitment into child commitments so that part of the production
+// can be sold while the owner retains the rest. Each child records the parent ID and receives
+// a share of the owner's rate proportional to its production, the parent keeps the remainder.
+// The terms of each child are salted with a salt derived from the parent's. The children are
+// ordinary commitments and can be agreed to and transferred on their own. A single
+// CommitmentCreated event lists all of them.
+func (s *SmartContract) SplitCommitment(ctx contractapi.TransactionContextInterface) error {
+
+	transientMap, err := ctx.GetStub().GetTransient()
+	if err != nil {
+		return fmt.Errorf("error getting transient: %v", err)
+	}
+
+	// Production and rates are private, therefore they get passed in transient field
+	transientSplitJSON, ok := transientMap["commitment_split"]
+	if !ok {
+		return fmt.Errorf("commitment_split key not found in the transient map")
+	}
+
+	type commitmentSplitTransientInput struct {
+		ID    string           `json:"commitmentID"`
+		Parts []CommitmentPart `json:"parts"`
+	}
+
+	var splitInput commitmentSplitTransientInput
+	err = json.Unmarshal(transientSplitJSON, &splitInput)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal JSON: %v", err)
+	}
+
+	if len(splitInput.ID) == 0 {
+		return fmt.Errorf("commitmentID field must be a non-empty string")
+	}
+	if len(splitInput.Parts) == 0 {
+		return fmt.Errorf("parts field must list at least one child commitment")
+	}
+
+	// Verify that the client is submitting request to peer in their organization
+	err = s.verifyClientOrgMatchesPeerOrg(ctx)
+	if err != nil {
+		return fmt.Errorf("SplitCommitment cannot be performed: Error %v", err)
+	}
+
+	parent, err := s.ReadCommitment(ctx, splitInput.ID)
+	if err != nil {
+		return fmt.Errorf("error reading commitment: %v", err)
+	}
+	if parent == nil {
+		return fmt.Errorf("%v does not exist", splitInput.ID)
+	}
+
+	clientID, err := s.submittingClientIdentity(ctx)
+	if err != nil {
+		return err
+	}
+	if clientID != parent.Owner {
+		return fmt.Errorf("error: submitting client identity does not own commitment")
+	}
+
+	// Only commitments with no pending offer, auction or delivery can be split
+	if !isTradeable(parent) {
+		return fmt.Errorf("commitment %v is %v and cannot be split", parent.ID, commitmentStatus(parent))
+	}
+	auction, err := readAuction(ctx, parent.ID)
+	if err != nil {
+		return err
+	}
+	if auction != nil {
+		return fmt.Errorf("commitment %v is being auctioned and cannot be split", parent.ID)
+	}
+	lot, err := readLot(ctx, parent.ID)
+	if err != nil {
+		return err
+	}
+	if lot != nil {
+		return fmt.Errorf("%v is a lot and cannot be split", parent.ID)
+	}
+
+	orgCollection, err := s.getCollectionName(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to infer private collection name for the org: %v", err)
+	}
+
+	parentDetails, err := s.ReadCommitmentPrivateDetails(ctx, orgCollection, parent.ID)
+	if err != nil {
+		return err
+	}
+	if parentDetails == nil {
+		return fmt.Errorf("private details of commitment %v do not exist in collection %v", parent.ID, orgCollection)
+	}
+	if parentDetails.Quantity == 0 {
+		parentDetails.Quantity = parent.Production
+	}
+	// The salts of the children are derived from the parent's, which must not be guessable
+	if len(parentDetails.Salt) == 0 {
+		return fmt.Errorf("terms of commitment %v are not salted, set salted terms with AgreeToSell before splitting it", parent.ID)
+	}
+
+	remaining := *parent
+	remainingDetails := *parentDetails
+	seen := map[string]bool{parent.ID: true}
+	for _, part := range splitInput.Parts {
+		if len(part.ID) == 0 {
+			return fmt.Errorf("commitmentID of each part must be a non-empty string")
+		}
+		if seen[part.ID] {
+			return fmt.Errorf("commitment %v is listed more than once", part.ID)
+		}
+		seen[part.ID] = true
+		if part.Production <= 0 {
+			return fmt.Errorf("production of part %v must be a positive integer", part.ID)
+		}
+		if part.Size <= 0 {
+			return fmt.Errorf("size of part %v must be a positive integer", part.ID)
+		}
+
+		existing, err := s.ReadCommitment(ctx, part.ID)
+		if err != nil {
+			return fmt.Errorf("error reading commitment: %v", err)
+		}
+		if existing != nil {
+			return fmt.Errorf("this commitment already exists: %v", part.ID)
+		}
+
+		remaining.Production -= part.Production
+		remaining.Size -= part.Size
+		if remaining.Production <= 0 || remaining.Size <= 0 {
+			return fmt.Errorf("parts must leave part of the production and size of %v with the owner", parent.ID)
+		}
+
+		child := *parent
+		child.ID = part.ID
+		child.Production = part.Production
+		child.Size = part.Size
+		child.ParentID = parent.ID
+
+		// The child's rate is the share of the parent's rate for its production
+		childDetails := CommitmentPrivateDetails{
+			ID:            part.ID,
+			Rate:          parentDetails.Rate * part.Production / parent.Production,
+			Quantity:      part.Production,
+			DeliveryStart: parentDetails.DeliveryStart,
+			DeliveryEnd:   parentDetails.DeliveryEnd,
+			Currency:      parentDetails.Currency,
+			Salt:          derivedSalt(parentDetails.Salt, part.ID),
+		}
+		if childDetails.Rate <= 0 {
+			return fmt.Errorf("production of part %v is too small to carry a share of the rate", part.ID)
+		}
+		remainingDetails.Rate -= childDetails.Rate
+
+		err = s.putCommitment(ctx, &child)
+		if err != nil {
+			return err
+		}
+		err = putOwnerDetails(ctx, orgCollection, clientID, &childDetails)
+		if err != nil {
+			return err
+		}
+	}
+
+	remainingDetails.Quantity = remaining.Production
+	err = putOwnerDetails(ctx, orgCollection, clientID, &remainingDetails)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("SplitCommitment: ID %v split into %v parts, %v production retained", parent.ID, len(splitInput.Parts), remaining.Production)
+	err = s.putCommitment(ctx, &remaining)
+	if err != nil {
+		return err
+	}
+
+	ownerMSP, err := clientMSP(ctx)
+	if err != nil {
+		return err
+	}
+
+	partIDs := []string{}
+	for _, part := range splitInput.Parts {
+		partIDs = append(partIDs, part.ID)
+	}
+
+	header, err := eventHeader(ctx)
+	if err != nil {
+		return err
+	}
+	return emitEvent(ctx, events.CommitmentCreatedEvent, events.CommitmentCreated{
+		Header:        header,
+		CommitmentID:  partIDs[0],
+		CommitmentIDs: partIDs,
+		ParentID:      parent.ID,
+		Status:        commitmentStatus(parent),
+		OwnerMSP:      ownerMSP,
+	})
+}
+
+// putOwnerDetails stores the canonical terms of a commitment under the owner's identity in the org collection
+func putOwnerDetails(ctx contractapi.TransactionContextInterface, orgCollection string, owner string, details *CommitmentPrivateDetails) error {
+	detailsJSON, err := canonicalTerms(details)
+	if err != nil {
+		return err
+	}
+
+	ownerDetailsKey, err := privateDetailsKey(ctx, details.ID, owner)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Put: collection %v, ID %v", orgCollection, details.ID)
+	err = ctx.GetStub().PutPrivateData(orgCollection, ownerDetailsKey, detailsJSON)
+	if err != nil {
+		return fmt.Errorf("failed to put commitment private details: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,203 @@
+package chaincode
+
+import (
+	"testing"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/hyperledger/fabric-samples/yield-commitment/chaincode-go/events"
+	"github.com/stretchr/testify/require"
+)
+
+func splitInput(id string, parts ...CommitmentPart) transient {
+	return transient{"commitment_split": map[string]interface{}{"commitmentID": id, "parts": parts}}
+}
+
+func TestSplitCommitmentSaltsParts(t *testing.T) {
+	n := newTestNetwork(t)
+	n.createCommitment("c1")
+	n.mustSubmit(n.producer, "SplitCommitment", splitInput("c1", CommitmentPart{ID: "c2", Production: 25, Size: 10}, CommitmentPart{ID: "c3", Production: 25, Size: 10}))
+
+	parent := n.readDetails(n.producer, "c1")
+	require.Equal(t, "5e1f07", parent.Salt)
+
+	// Each part has its own salt, which cannot be guessed without the parent's
+	c2 := n.readDetails(n.producer, "c2")
+	c3 := n.readDetails(n.producer, "c3")
+	require.Equal(t, derivedSalt("5e1f07", "c2"), c2.Salt)
+	require.Equal(t, derivedSalt("5e1f07", "c3"), c3.Salt)
+	require.NotEqual(t, c2.Salt, c3.Salt)
+	require.Len(t, c2.Salt, 64)
+}
+
+func TestSplitCommitmentRejectsUnsaltedTerms(t *testing.T) {
+	n := newTestNetwork(t)
+	n.createCommitment("c1")
+
+	// Terms written before salts were required
+	require.NoError(t, n.call(n.producer, "seed", func(ctx contractapi.TransactionContextInterface) error {
+		ownerKey, err := privateDetailsKey(ctx, "c1", n.producer.ID())
+		require.NoError(t, err)
+		return ctx.GetStub().PutPrivateData("Org1MSPPrivateCollection", ownerKey, []byte(`{"commitmentID":"c1","rate":2500,"quantity":100,"currency":"USD"}`))
+	}))
+
+	err := n.submit(n.producer, "SplitCommitment", splitInput("c1", CommitmentPart{ID: "c2", Production: 25, Size: 10}))
+	require.EqualError(t, err, "terms of commitment c1 are not salted, set salted terms with AgreeToSell before splitting it")
+	require.Nil(t, n.readCommitment("c2"))
+
+	// Once salted terms are set the commitment can be split
+	n.mustSubmit(n.producer, "AgreeToSell", transient{"commitment_value": termsInput("c1")})
+	n.mustSubmit(n.producer, "SplitCommitment", splitInput("c1", CommitmentPart{ID: "c2", Production: 25, Size: 10}))
+	require.Equal(t, derivedSalt("a3c9e1", "c2"), n.readDetails(n.producer, "c2").Salt)
+}
+
+func TestSplitCommitment(t *testing.T) {
+	setup := func(n *testNetwork) { n.createCommitment("c1") }
+	part := func(id string, production int, size int) CommitmentPart {
+		return CommitmentPart{ID: id, Production: production, Size: size}
+	}
+
+	runTransactionCases(t, "SplitCommitment", setup, []transactionCase{
+		{
+			name:  "missing transient input",
+			input: transient{},
+			err:   "commitment_split key not found in the transient map",
+		},
+		{
+			name:  "missing commitmentID",
+			input: splitInput("", part("c2", 30, 10)),
+			err:   "commitmentID field must be a non-empty string",
+		},
+		{
+			name:  "no parts",
+			input: splitInput("c1"),
+			err:   "parts field must list at least one child commitment",
+		},
+		{
+			name:    "client of another org",
+			peerMSP: "Org2MSP",
+			input:   splitInput("c1", part("c2", 30, 10)),
+			err:     crossOrgError,
+		},
+		{
+			name:  "unknown commitment",
+			input: splitInput("c9", part("c2", 30, 10)),
+			err:   "c9 does not exist",
+		},
+		{
+			name:   "not the owner",
+			client: otherOrg1,
+			input:  splitInput("c1", part("c2", 30, 10)),
+			err:    "submitting client identity does not own commitment",
+		},
+		{
+			name:  "commitment under agreement",
+			setup: func(n *testNetwork) { n.agree("c1", n.buyer) },
+			input: splitInput("c1", part("c2", 30, 10)),
+			err:   "commitment c1 is UnderAgreement and cannot be split",
+		},
+		{
+			name:  "part without an ID",
+			input: splitInput("c1", part("", 30, 10)),
+			err:   "commitmentID of each part must be a non-empty string",
+		},
+		{
+			name:  "part listed twice",
+			input: splitInput("c1", part("c2", 30, 10), part("c2", 30, 10)),
+			err:   "commitment c2 is listed more than once",
+		},
+		{
+			name:  "part named after the parent",
+			input: splitInput("c1", part("c1", 30, 10)),
+			err:   "commitment c1 is listed more than once",
+		},
+		{
+			name:  "part without production",
+			input: splitInput("c1", part("c2", 0, 10)),
+			err:   "production of part c2 must be a positive integer",
+		},
+		{
+			name:  "part without size",
+			input: splitInput("c1", part("c2", 30, 0)),
+			err:   "size of part c2 must be a positive integer",
+		},
+		{
+			name:  "existing part",
+			setup: func(n *testNetwork) { n.createCommitment("c2") },
+			input: splitInput("c1", part("c2", 30, 10)),
+			err:   "this commitment already exists: c2",
+		},
+		{
+			name:  "parts take the whole production",
+			input: splitInput("c1", part("c2", 60, 10), part("c3", 40, 10)),
+			err:   "parts must leave part of the production and size of c1 with the owner",
+			check: func(t *testing.T, n *testNetwork) {
+				require.Nil(t, n.readCommitment("c2"))
+			},
+		},
+		{
+			name: "part too small for a share of the rate",
+			setup: func(n *testNetwork) {
+				n.mustSubmit(n.producer, "AgreeToSell", transient{"commitment_value": with(termsInput("c1"), "rate", 50)})
+			},
+			input: splitInput("c1", part("c2", 1, 1)),
+			err:   "production of part c2 is too small to carry a share of the rate",
+		},
+		{
+			name:  "split into two parts",
+			input: splitInput("c1", part("c2", 30, 10), part("c3", 20, 5)),
+			check: func(t *testing.T, n *testNetwork) {
+				parent := n.readCommitment("c1")
+				require.Equal(t, 50, parent.Production)
+				require.Equal(t, 25, parent.Size)
+				require.Empty(t, parent.ParentID)
+				parentDetails := n.readDetails(n.producer, "c1")
+				require.Equal(t, 1250, parentDetails.Rate)
+				require.Equal(t, 50, parentDetails.Quantity)
+
+				for _, expected := range []struct {
+					id         string
+					production int
+					size       int
+					rate       int
+				}{{"c2", 30, 10, 750}, {"c3", 20, 5, 500}} {
+					child := n.readCommitment(expected.id)
+					require.NotNil(t, child, expected.id)
+					require.Equal(t, "c1", child.ParentID)
+					require.Equal(t, n.producer.ID(), child.Owner)
+					require.Equal(t, n.producer.ID(), child.Producer)
+					require.Equal(t, StatusOpen, child.Status)
+					require.Equal(t, expected.production, child.Production)
+					require.Equal(t, expected.size, child.Size)
+					require.Equal(t, "corn", child.Crop)
+
+					details := n.readDetails(n.producer, expected.id)
+					require.Equal(t, expected.rate, details.Rate)
+					require.Equal(t, expected.production, details.Quantity)
+					require.Equal(t, "USD", details.Currency)
+				}
+
+				// One event announces all the parts
+				require.Equal(t, events.CommitmentCreatedEvent, n.lastEvent())
+				var payload events.CommitmentCreated
+				n.lastEventPayload(&payload)
+				require.Equal(t, "c2", payload.CommitmentID)
+				require.Equal(t, []string{"c2", "c3"}, payload.CommitmentIDs)
+				require.Equal(t, "c1", payload.ParentID)
+				require.Equal(t, StatusOpen, payload.Status)
+				require.Equal(t, "Org1MSP", payload.OwnerMSP)
+			},
+		},
+		{
+			name: "part of a split part",
+			setup: func(n *testNetwork) {
+				n.mustSubmit(n.producer, "SplitCommitment", splitInput("c1", part("c2", 50, 20)))
+			},
+			input: splitInput("c2", part("c3", 10, 4)),
+			check: func(t *testing.T, n *testNetwork) {
+				require.Equal(t, "c2", n.readCommitment("c3").ParentID)
+				require.Equal(t, 250, n.readDetails(n.producer, "c3").Rate)
+				require.Equal(t, 1000, n.readDetails(n.producer, "c2").Rate)
+			},
+		},
+	})
+}
@@ -3,13 +3,13 @@ package chaincode
 
 import (
 	"bytes"
-	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"log"
+	"time"
 
-	"github.com/hyperledger/fabric-chaincode-go/shim"
 	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/hyperledger/fabric-samples/yield-commitment/chaincode-go/events"
 )
 
 const commitmentCollection = "commitmentCollection"
@@ -20,6 +20,10 @@ const transferAgreementObjectType = "transferAgreement"
 // SmartContract of this fabric sample
 type SmartContract struct {
 	contractapi.Contract
+
+	// Topology maps peers and clients to their organizations and collections, see topology.go.
+	// DefaultTopology is used when it is not set.
+	Topology Topology
 }
 
 // Commitment describes main commitment details that are visible to all organizations
@@ -31,41 +35,55 @@ type Commitment struct {
 	Crop string   `json:"crop"`
 	Size  int    `json:"size"`
 	Owner string `json:"owner"` 
-
+	Producer string `json:"producer"` // Producer is the identity that created the commitment and reports its yields
+	DeliveryDeadline string `json:"deliveryDeadline"` // RFC3339 time by which the production should be delivered, used for reputation
+	Status string `json:"status"` // Status is the lifecycle state of the commitment, see commitment_lifecycle.go
+	ParentID string `json:"parentID"` // ParentID is the commitment this one was split from with SplitCommitment, if any
+	LotID string `json:"lotID"` // LotID is the lot the commitment is pooled in with PoolCommitments, if any
 }
 
-// CommitmentPrivateDetails describes details that are private to owners
+// CommitmentPrivateDetails describes the terms of a commitment that are private to owners. The
+// salt is required whenever terms are written and is agreed again between the owner and the buyer
+// for each transfer, so that the hash of the terms that is visible to every channel member cannot
+// be matched against guessed rates. The terms are always stored in the canonical form produced by
+// canonicalTerms, see terms.go.
 type CommitmentPrivateDetails struct {
-	ID             string `json:"commitmentID"`
-	Rate int    `json:"rate"`
+	ID            string `json:"commitmentID"`
+	Rate          int    `json:"rate"`
+	Quantity      int    `json:"quantity"`
+	DeliveryStart string `json:"deliveryStart"` // RFC3339 start of the delivery window, optional
+	DeliveryEnd   string `json:"deliveryEnd"`   // RFC3339 end of the delivery window, optional
+	Currency      string `json:"currency"`      // ISO 4217 code of the currency the rate is quoted in, USD if not given
+	Salt          string `json:"salt"`
 }
 
-// TransferAgreement describes the buyer agreement returned by ReadTransferAgreement
+// TransferAgreement describes the buyer agreement returned by ReadTransferAgreement.
+// A commitment can carry several agreements at once, one per buyer identity.
 type TransferAgreement struct {
 	ID      string `json:"commitmentID"`
 	BuyerID string `json:"buyerID"`
+	BuyerMSP string `json:"buyerMSP"`
 }
 
-type Data struct {
-	ID             string `json:"ID"`
-	Reputation     float64 `json:"Reputation"`
-}
-
-type DataPrivateDetails struct {
-	ID             string `json:"ID"`
-	Reputation     float64 `json:"Reputation"`
-}
-
+// Yield describes a quantity delivered against a commitment. The owner is the producer
+// that reported the yield.
 type Yield struct {
+	Type    string `json:"objectType"` //Type is used to distinguish the various types of objects in state database
 	ID      string `json:"ID"`
+	CommitmentID string `json:"commitmentID"`
 	Produced    float64 `json:"Produced"`
+	Owner   string `json:"owner"`
 }
 
 type YieldPrivateDetails struct { 
 	ID      string `json:"ID"`
+	CommitmentID string `json:"commitmentID"`
 	Produced    float64 `json:"Produced"`
 }
 
+// CreateYield records a quantity produced against a commitment. Only the producer of the
+// commitment can report yields, and the delivered quantity is accumulated on the
+// commitment's fulfillment record, moving the commitment to Delivering and then Fulfilled.
 func (s *SmartContract) CreateYield(ctx contractapi.TransactionContextInterface) error {
 
 	transientMap, err := ctx.GetStub().GetTransient()
@@ -83,6 +101,7 @@ func (s *SmartContract) CreateYield(ctx contractapi.TransactionContextInterface)
 	type yieldTransientInput struct {
 		Type           string `json:"objectType"` //Type is used to distinguish the various types of objects in state database
 		ID             string `json:"yieldID"`
+		CommitmentID   string `json:"commitmentID"`
 		Produced float64    `json:"produced"`
 	}
 
@@ -94,24 +113,44 @@ func (s *SmartContract) CreateYield(ctx contractapi.TransactionContextInterface)
 	if len(yieldInput.Type) == 0 {
 		return fmt.Errorf("objectType field must be a non-empty string")
 	}
+	if yieldInput.Type != yieldObjectType {
+		return fmt.Errorf("objectType field must be %v", yieldObjectType)
+	}
 	if len(yieldInput.ID) == 0 {
+		return fmt.Errorf("yieldID field must be a non-empty string")
+	}
+	if len(yieldInput.CommitmentID) == 0 {
 		return fmt.Errorf("commitmentID field must be a non-empty string")
 	}
 	if yieldInput.Produced <= 0 {
-		return fmt.Errorf("rate field must be a positive integer")
+		return fmt.Errorf("produced field must be a positive number")
 	}
 
-	// Check if commitment already exists
-	yieldAsBytes, err := ctx.GetStub().GetPrivateData(yieldCollection, yieldInput.ID)
+	yieldKey, err := objectKey(ctx, yieldObjectType, yieldInput.ID)
 	if err != nil {
-		return fmt.Errorf("failed to get commitment: %v", err)
+		return err
+	}
+
+	// Check if yield already exists
+	yieldAsBytes, err := ctx.GetStub().GetPrivateData(yieldCollection, yieldKey)
+	if err != nil {
+		return fmt.Errorf("failed to get yield: %v", err)
 	} else if yieldAsBytes != nil {
-		fmt.Println("Commitment already exists: " + yieldInput.ID)
-		return fmt.Errorf("this commitment already exists: " + yieldInput.ID)
+		fmt.Println("Yield already exists: " + yieldInput.ID)
+		return fmt.Errorf("this yield already exists: " + yieldInput.ID)
+	}
+
+	// The yield must be reported against an existing commitment
+	commitment, err := s.ReadCommitment(ctx, yieldInput.CommitmentID)
+	if err != nil {
+		return fmt.Errorf("error reading commitment: %v", err)
+	}
+	if commitment == nil {
+		return fmt.Errorf("%v does not exist", yieldInput.CommitmentID)
 	}
 
 	// Get ID of submitting client identity
-	clientID, err := submittingClientIdentity(ctx)
+	clientID, err := s.submittingClientIdentity(ctx)
 	if err != nil {
 	return err
 	}
@@ -119,15 +158,30 @@ func (s *SmartContract) CreateYield(ctx contractapi.TransactionContextInterface)
 	// Verify that the client is submitting request to peer in their organization
 	// This is to ensure that a client from another org doesn't attempt to read or
 	// write private data from this peer.
-	err = verifyClientOrgMatchesPeerOrg(ctx)
+	err = s.verifyClientOrgMatchesPeerOrg(ctx)
 	if err != nil {
-		return fmt.Errorf("CreateCommitment cannot be performed: Error %v", err)
+		return fmt.Errorf("CreateYield cannot be performed: Error %v", err)
+	}
+
+	if clientID != commitment.Producer {
+		return fmt.Errorf("error: submitting client identity is not the producer of commitment %v", yieldInput.CommitmentID)
+	}
+
+	// Accumulate the delivered quantity and advance the commitment lifecycle
+	if len(commitment.LotID) != 0 {
+		return fmt.Errorf("commitment %v is pooled in lot %v, yields are reported on the lot", commitment.ID, commitment.LotID)
+	}
+	err = s.recordDelivery(ctx, commitment, yieldInput.Produced)
+	if err != nil {
+		return err
 	}
 
-	// Make submitting client the owner
 	yield := Yield{
+		Type:  yieldObjectType,
 		ID:    yieldInput.ID,
+		CommitmentID: yieldInput.CommitmentID,
 		Produced: yieldInput.Produced,
+		Owner: clientID,
 	}
 	yieldJSONasBytes, err := json.Marshal(yield)
 	if err != nil {
@@ -139,7 +193,7 @@ func (s *SmartContract) CreateYield(ctx contractapi.TransactionContextInterface)
 	// Look for container name like dev-peer0.org1.example.com-{chaincodename_version}-xyz
 	log.Printf("CreateYield Put: collection %v, ID %v, owner %v", yieldCollection, yieldInput.ID, clientID)
 
-	err = ctx.GetStub().PutPrivateData(yieldCollection, yieldInput.ID, yieldJSONasBytes)
+	err = ctx.GetStub().PutPrivateData(yieldCollection, yieldKey, yieldJSONasBytes)
 	if err != nil {
 		return fmt.Errorf("failed to put commitment into private yield collecton: %v", err)
 	}
@@ -147,6 +201,7 @@ func (s *SmartContract) CreateYield(ctx contractapi.TransactionContextInterface)
 	// Save commitment details to collection visible to owning organization
 	yieldPrivateDetails := YieldPrivateDetails{
 		ID:             yieldInput.ID,
+		CommitmentID:   yieldInput.CommitmentID,
 		Produced: yieldInput.Produced,
 	}
 
@@ -156,120 +211,35 @@ func (s *SmartContract) CreateYield(ctx contractapi.TransactionContextInterface)
 	}
 
 	// Get collection name for this organization.
-	orgCollection, err := getCollectionName(ctx)
+	orgCollection, err := s.getCollectionName(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to infer private collection name for the org: %v", err)
 	}
 
-	// Put commitment rate value into owners org specific private data collection
-	log.Printf("Put: collection %v, ID %v", orgCollection, yieldInput.ID)
-	err = ctx.GetStub().PutPrivateData(orgCollection, yieldInput.ID, yieldPrivateDetailsAsBytes)
-	if err != nil {
-		return fmt.Errorf("failed to put commitment private details: %v", err)
-	}
-	return nil
-}
-
-func (s *SmartContract) CreateData(ctx contractapi.TransactionContextInterface) error {
-
-	transientMap, err := ctx.GetStub().GetTransient()
+	yieldPrivateDetailsKey, err := objectKey(ctx, yieldPrivateDetailsObjectType, yieldInput.ID)
 	if err != nil {
-		return fmt.Errorf("error getting transient: %v", err)
-	}
-
-	// Commitment properties are private, therefore they get passed in transient field, instead of func args
-	transientDataJSON, ok := transientMap["data_properties"]
-	if !ok {
-		//log error to stdout
-		return fmt.Errorf("data not found in the transient map input")
-	}
-
-	type dataTransientInput struct {
-		Type           string `json:"objectType"` //Type is used to distinguish the various types of objects in state database
-		ID             string `json:"dataID"`
-		Reputation float64    `json:"reputation"`
-	}
-
-	var dataInput dataTransientInput
-	err = json.Unmarshal(transientDataJSON, &dataInput)
-	if err != nil {
-		return fmt.Errorf("failed to unmarshal JSON: %v", err)
-	}
-	if len(dataInput.Type) == 0 {
-		return fmt.Errorf("objectType field must be a non-empty string")
-	}
-	if len(dataInput.ID) == 0 {
-		return fmt.Errorf("commitmentID field must be a non-empty string")
-	}
-	if dataInput.Reputation <= 0 {
-		return fmt.Errorf("rate field must be a positive integer")
-	}
-
-	// Check if commitment already exists
-	dataAsBytes, err := ctx.GetStub().GetPrivateData(dataCollection, dataInput.ID)
-	if err != nil {
-		return fmt.Errorf("failed to get commitment: %v", err)
-	} else if dataAsBytes != nil {
-		fmt.Println("Commitment already exists: " + dataInput.ID)
-		return fmt.Errorf("this commitment already exists: " + dataInput.ID)
-	}
-
-	// Get ID of submitting client identity
-	clientID, err := submittingClientIdentity(ctx)
-	if err != nil {
-	return err
-	}
-
-	// Verify that the client is submitting request to peer in their organization
-	// This is to ensure that a client from another org doesn't attempt to read or
-	// write private data from this peer.
-	err = verifyClientOrgMatchesPeerOrg(ctx)
-	if err != nil {
-		return fmt.Errorf("CreateCommitment cannot be performed: Error %v", err)
-	}
-
-	// Make submitting client the owner
-	data := Data{
-		ID:    dataInput.ID,
-		Reputation: dataInput.Reputation,
-	}
-	dataJSONasBytes, err := json.Marshal(data)
-	if err != nil {
-		return fmt.Errorf("failed to marshal commitment into JSON: %v", err)
-	}
-
-	// Save commitment to private data collection
-	// Typical logger, logs to stdout/file in the fabric managed docker container, running this chaincode
-	// Look for container name like dev-peer0.org1.example.com-{chaincodename_version}-xyz
-	log.Printf("CreateData Put: collection %v, ID %v, owner %v", dataCollection, dataInput.ID, clientID)
-
-	err = ctx.GetStub().PutPrivateData(dataCollection, dataInput.ID, dataJSONasBytes)
-	if err != nil {
-		return fmt.Errorf("failed to put commitment into private data collecton: %v", err)
-	}
-
-	// Save commitment details to collection visible to owning organization
-	dataPrivateDetails := DataPrivateDetails{
-		ID:             dataInput.ID,
-		Reputation: dataInput.Reputation,
+		return err
 	}
 
-	dataPrivateDetailsAsBytes, err := json.Marshal(dataPrivateDetails) // marshal commitment details to JSON
+	// Put yield details into owners org specific private data collection
+	log.Printf("Put: collection %v, ID %v", orgCollection, yieldInput.ID)
+	err = ctx.GetStub().PutPrivateData(orgCollection, yieldPrivateDetailsKey, yieldPrivateDetailsAsBytes)
 	if err != nil {
-		return fmt.Errorf("failed to marshal into JSON: %v", err)
+		return fmt.Errorf("failed to put commitment private details: %v", err)
 	}
 
-	// Get collection name for this organization.
-	orgCollection, err := getCollectionName(ctx)
+	header, err := eventHeader(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to infer private collection name for the org: %v", err)
+		return err
 	}
-
-	// Put commitment rate value into owners org specific private data collection
-	log.Printf("Put: collection %v, ID %v", orgCollection, dataInput.ID)
-	err = ctx.GetStub().PutPrivateData(orgCollection, dataInput.ID, dataPrivateDetailsAsBytes)
+	err = emitEvent(ctx, events.YieldRecordedEvent, events.YieldRecorded{
+		Header:       header,
+		CommitmentID: commitment.ID,
+		YieldID:      yieldInput.ID,
+		Status:       commitmentStatus(commitment),
+	})
 	if err != nil {
-		return fmt.Errorf("failed to put commitment private details: %v", err)
+		return err
 	}
 	return nil
 }
@@ -299,6 +269,13 @@ func (s *SmartContract) CreateCommitment(ctx contractapi.TransactionContextInter
 		Size           int    `json:"size"`
 		Crop          string `json:"crop"`
 		Rate int    `json:"rate"`
+		Quantity       int    `json:"quantity"` // defaults to the production
+		DeliveryStart  string `json:"deliveryStart"`
+		DeliveryEnd    string `json:"deliveryEnd"`
+		Currency       string `json:"currency"`
+		Salt           string `json:"salt"`
+		Draft          bool   `json:"draft"` // Draft commitments are not tradeable until published with SetCommitmentStatus
+		DeliveryDeadline string `json:"deliveryDeadline"`
 	}
 
 	var commitmentInput commitmentTransientInput
@@ -310,6 +287,9 @@ func (s *SmartContract) CreateCommitment(ctx contractapi.TransactionContextInter
 	if len(commitmentInput.Type) == 0 {
 		return fmt.Errorf("objectType field must be a non-empty string")
 	}
+	if commitmentInput.Type != commitmentObjectType {
+		return fmt.Errorf("objectType field must be %v", commitmentObjectType)
+	}
 	if len(commitmentInput.ID) == 0 {
 		return fmt.Errorf("commitmentID field must be a non-empty string")
 	}
@@ -325,12 +305,19 @@ func (s *SmartContract) CreateCommitment(ctx contractapi.TransactionContextInter
 	if len(commitmentInput.Crop) == 0 {
 		return fmt.Errorf("crop field must be a non-empty string")
 	}
-	if commitmentInput.Rate <= 0 {
-		return fmt.Errorf("rate field must be a positive integer")
+	if len(commitmentInput.DeliveryDeadline) != 0 {
+		if _, err := time.Parse(time.RFC3339, commitmentInput.DeliveryDeadline); err != nil {
+			return fmt.Errorf("deliveryDeadline field must be an RFC3339 time: %v", err)
+		}
+	}
+
+	commitmentKey, err := objectKey(ctx, commitmentObjectType, commitmentInput.ID)
+	if err != nil {
+		return err
 	}
 
 	// Check if commitment already exists
-	commitmentAsBytes, err := ctx.GetStub().GetPrivateData(commitmentCollection, commitmentInput.ID)
+	commitmentAsBytes, err := ctx.GetStub().GetPrivateData(commitmentCollection, commitmentKey)
 	if err != nil {
 		return fmt.Errorf("failed to get commitment: %v", err)
 	} else if commitmentAsBytes != nil {
@@ -339,7 +326,7 @@ func (s *SmartContract) CreateCommitment(ctx contractapi.TransactionContextInter
 	}
 
 	// Get ID of submitting client identity
-	clientID, err := submittingClientIdentity(ctx)
+	clientID, err := s.submittingClientIdentity(ctx)
 	if err != nil {
 		return err
 	}
@@ -347,24 +334,28 @@ func (s *SmartContract) CreateCommitment(ctx contractapi.TransactionContextInter
 	// Verify that the client is submitting request to peer in their organization
 	// This is to ensure that a client from another org doesn't attempt to read or
 	// write private data from this peer.
-	err = verifyClientOrgMatchesPeerOrg(ctx)
+	err = s.verifyClientOrgMatchesPeerOrg(ctx)
 	if err != nil {
 		return fmt.Errorf("CreateCommitment cannot be performed: Error %v", err)
 	}
 
+	status := StatusOpen
+	if commitmentInput.Draft {
+		status = StatusDraft
+	}
+
 	// Make submitting client the owner
 	commitment := Commitment{
-		Type:  commitmentInput.Type,
+		Type:  commitmentObjectType,
 		ID:    commitmentInput.ID,
 		Location: commitmentInput.Location,
 		Production: commitmentInput.Production,
 		Size:  commitmentInput.Size,
 		Crop: commitmentInput.Crop,
 		Owner: clientID,
-	}
-	commitmentJSONasBytes, err := json.Marshal(commitment)
-	if err != nil {
-		return fmt.Errorf("failed to marshal commitment into JSON: %v", err)
+		Producer: clientID,
+		DeliveryDeadline: commitmentInput.DeliveryDeadline,
+		Status: status,
 	}
 
 	// Save commitment to private data collection
@@ -372,74 +363,158 @@ func (s *SmartContract) CreateCommitment(ctx contractapi.TransactionContextInter
 	// Look for container name like dev-peer0.org1.example.com-{chaincodename_version}-xyz
 	log.Printf("CreateCommitment Put: collection %v, ID %v, owner %v", commitmentCollection, commitmentInput.ID, clientID)
 
-	err = ctx.GetStub().PutPrivateData(commitmentCollection, commitmentInput.ID, commitmentJSONasBytes)
+	err = s.putCommitment(ctx, &commitment)
 	if err != nil {
-		return fmt.Errorf("failed to put commitment into private data collecton: %v", err)
+		return err
 	}
 
 	// Save commitment details to collection visible to owning organization
 	commitmentPrivateDetails := CommitmentPrivateDetails{
-		ID:             commitmentInput.ID,
-		Rate: commitmentInput.Rate,
+		ID:            commitmentInput.ID,
+		Rate:          commitmentInput.Rate,
+		Quantity:      commitmentInput.Quantity,
+		DeliveryStart: commitmentInput.DeliveryStart,
+		DeliveryEnd:   commitmentInput.DeliveryEnd,
+		Currency:      commitmentInput.Currency,
+		Salt:          commitmentInput.Salt,
+	}
+	if commitmentPrivateDetails.Quantity == 0 {
+		commitmentPrivateDetails.Quantity = commitmentInput.Production
 	}
 
-	commitmentPrivateDetailsAsBytes, err := json.Marshal(commitmentPrivateDetails) // marshal commitment details to JSON
+	commitmentPrivateDetailsAsBytes, err := canonicalTerms(&commitmentPrivateDetails)
 	if err != nil {
-		return fmt.Errorf("failed to marshal into JSON: %v", err)
+		return err
 	}
 
 	// Get collection name for this organization.
-	orgCollection, err := getCollectionName(ctx)
+	orgCollection, err := s.getCollectionName(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to infer private collection name for the org: %v", err)
 	}
 
+	ownerDetailsKey, err := privateDetailsKey(ctx, commitmentInput.ID, clientID)
+	if err != nil {
+		return err
+	}
+
 	// Put commitment rate value into owners org specific private data collection
 	log.Printf("Put: collection %v, ID %v", orgCollection, commitmentInput.ID)
-	err = ctx.GetStub().PutPrivateData(orgCollection, commitmentInput.ID, commitmentPrivateDetailsAsBytes)
+	err = ctx.GetStub().PutPrivateData(orgCollection, ownerDetailsKey, commitmentPrivateDetailsAsBytes)
 	if err != nil {
 		return fmt.Errorf("failed to put commitment private details: %v", err)
 	}
+
+	ownerMSP, err := clientMSP(ctx)
+	if err != nil {
+		return err
+	}
+
+	header, err := eventHeader(ctx)
+	if err != nil {
+		return err
+	}
+	err = emitEvent(ctx, events.CommitmentCreatedEvent, events.CommitmentCreated{
+		Header:       header,
+		CommitmentID: commitment.ID,
+		Status:       commitment.Status,
+		OwnerMSP:     ownerMSP,
+	})
+	if err != nil {
+		return err
+	}
 	return nil
 }
 
-// AgreeToTransfer is used by the potential buyer of the commitment to agree to the
-// commitment value. The agreed to appraisal value is stored in the buying orgs
-// org specifc collection, while the the buyer client ID is stored in the commitment collection
-// using a composite key
-func (s *SmartContract) AgreeToTransfer(ctx contractapi.TransactionContextInterface) error {
+// AgreeToSell is used by the owner of the commitment to set the terms of a transfer. The
+// rate and a random salt, shared with the buyer outside of the channel, replace the owner's
+// private details. The buyer passes the same terms to AgreeToTransfer.
+func (s *SmartContract) AgreeToSell(ctx contractapi.TransactionContextInterface) error {
 
-	// Get ID of submitting client identity
-	clientID, err := submittingClientIdentity(ctx)
+	// Terms are private, therefore they get passed in transient field
+	valueJSON, commitmentPrivateDetailsAsBytes, err := readTermsInput(ctx)
 	if err != nil {
 		return err
 	}
 
-	// Value is private, therefore it gets passed in transient field
-	transientMap, err := ctx.GetStub().GetTransient()
+	// Verify that the client is submitting request to peer in their organization
+	err = s.verifyClientOrgMatchesPeerOrg(ctx)
 	if err != nil {
-		return fmt.Errorf("error getting transient: %v", err)
+		return fmt.Errorf("AgreeToSell cannot be performed: Error %v", err)
 	}
 
-	// Persist the JSON bytes as-is so that there is no risk of nondeterministic marshaling.
-	valueJSONasBytes, ok := transientMap["commitment_value"]
-	if !ok {
-		return fmt.Errorf("commitment_value key not found in the transient map")
+	commitment, err := s.ReadCommitment(ctx, valueJSON.ID)
+	if err != nil {
+		return fmt.Errorf("error reading commitment: %v", err)
+	}
+	if commitment == nil {
+		return fmt.Errorf("%v does not exist", valueJSON.ID)
+	}
+	if !isTradeable(commitment) && commitmentStatus(commitment) != StatusUnderAgreement {
+		return fmt.Errorf("commitment %v is %v and cannot be sold", valueJSON.ID, commitmentStatus(commitment))
+	}
+	if valueJSON.Quantity != commitment.Production {
+		return fmt.Errorf("quantity %v does not match the production %v of commitment %v", valueJSON.Quantity, commitment.Production, valueJSON.ID)
 	}
 
-	// Unmarshal the tranisent map to get the commitment ID.
-	var valueJSON CommitmentPrivateDetails
-	err = json.Unmarshal(valueJSONasBytes, &valueJSON)
+	clientID, err := s.submittingClientIdentity(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to unmarshal JSON: %v", err)
+		return err
+	}
+	if clientID != commitment.Owner {
+		return fmt.Errorf("error: submitting client identity does not own commitment")
 	}
 
-	// Do some error checking since we get the chance
-	if len(valueJSON.ID) == 0 {
-		return fmt.Errorf("commitmentID field must be a non-empty string")
+	// A commitment sold by auction can only be sold at the winning rate
+	auction, err := readAuction(ctx, valueJSON.ID)
+	if err != nil {
+		return err
+	}
+	if auction != nil {
+		if auction.Status != AuctionEnded {
+			return fmt.Errorf("an auction is in progress on commitment %v", valueJSON.ID)
+		}
+		if auction.WinningRate != valueJSON.Rate {
+			return fmt.Errorf("rate %v does not match the winning bid of %v", valueJSON.Rate, auction.WinningRate)
+		}
 	}
-	if valueJSON.Rate <= 0 {
-		return fmt.Errorf("rate field must be a positive integer")
+
+	orgCollection, err := s.getCollectionName(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to infer private collection name for the org: %v", err)
+	}
+
+	ownerDetailsKey, err := privateDetailsKey(ctx, valueJSON.ID, clientID)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("AgreeToSell Put: collection %v, ID %v", orgCollection, valueJSON.ID)
+	err = ctx.GetStub().PutPrivateData(orgCollection, ownerDetailsKey, commitmentPrivateDetailsAsBytes)
+	if err != nil {
+		return fmt.Errorf("failed to put commitment private details: %v", err)
+	}
+	return s.recordAudit(ctx, valueJSON.ID, nil)
+}
+
+// AgreeToTransfer is used by the potential buyer of the commitment to agree to the
+// commitment value. The agreed to appraisal value is stored in the buying orgs
+// org specifc collection, while the the buyer client ID is stored in the commitment collection
+// using a composite key. Several buyers can make competing offers on the same commitment,
+// calling AgreeToTransfer again replaces the buyer's own offer.
+func (s *SmartContract) AgreeToTransfer(ctx contractapi.TransactionContextInterface) error {
+
+	// Get ID of submitting client identity
+	clientID, err := s.submittingClientIdentity(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Terms are private, therefore they get passed in transient field. The canonical form is
+	// persisted so that it hashes identically to the owner's terms.
+	valueJSON, valueJSONasBytes, err := readTermsInput(ctx)
+	if err != nil {
+		return err
 	}
 
 	// Read commitment from the private data collection
@@ -450,43 +525,111 @@ func (s *SmartContract) AgreeToTransfer(ctx contractapi.TransactionContextInterf
 	if commitment == nil {
 		return fmt.Errorf("%v does not exist", valueJSON.ID)
 	}
+	// Offers can be made on tradeable commitments and alongside other pending offers
+	if !isTradeable(commitment) && commitmentStatus(commitment) != StatusUnderAgreement {
+		return fmt.Errorf("commitment %v is %v and cannot be agreed to", valueJSON.ID, commitmentStatus(commitment))
+	}
+	if clientID == commitment.Owner {
+		return fmt.Errorf("error: submitting client identity already owns commitment %v", valueJSON.ID)
+	}
+	if valueJSON.Quantity != commitment.Production {
+		return fmt.Errorf("quantity %v does not match the production %v of commitment %v", valueJSON.Quantity, commitment.Production, valueJSON.ID)
+	}
+
+	// A commitment under auction can only be agreed to by the winner, at the winning rate
+	auction, err := readAuction(ctx, valueJSON.ID)
+	if err != nil {
+		return err
+	}
+	if auction != nil {
+		if auction.Status != AuctionEnded {
+			return fmt.Errorf("an auction is in progress on commitment %v", valueJSON.ID)
+		}
+		if auction.Winner != clientID {
+			return fmt.Errorf("error: only the auction winner can agree to transfer %v", valueJSON.ID)
+		}
+		if auction.WinningRate != valueJSON.Rate {
+			return fmt.Errorf("rate %v does not match the winning bid of %v", valueJSON.Rate, auction.WinningRate)
+		}
+	}
 	// Verify that the client is submitting request to peer in their organization
-	err = verifyClientOrgMatchesPeerOrg(ctx)
+	err = s.verifyClientOrgMatchesPeerOrg(ctx)
 	if err != nil {
 		return fmt.Errorf("AgreeToTransfer cannot be performed: Error %v", err)
 	}
 
 	// Get collection name for this organization. Needs to be read by a member of the organization.
-	orgCollection, err := getCollectionName(ctx)
+	orgCollection, err := s.getCollectionName(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to infer private collection name for the org: %v", err)
 	}
 
+	buyerDetailsKey, err := privateDetailsKey(ctx, valueJSON.ID, clientID)
+	if err != nil {
+		return err
+	}
+
 	log.Printf("AgreeToTransfer Put: collection %v, ID %v", orgCollection, valueJSON.ID)
 	// Put agreed value in the org specifc private data collection
-	err = ctx.GetStub().PutPrivateData(orgCollection, valueJSON.ID, valueJSONasBytes)
+	err = ctx.GetStub().PutPrivateData(orgCollection, buyerDetailsKey, valueJSONasBytes)
 	if err != nil {
 		return fmt.Errorf("failed to put commitment bid: %v", err)
 	}
 
-	// Create agreeement that indicates which identity has agreed to purchase
-	// In a more realistic transfer scenario, a transfer agreement would be secured to ensure that it cannot
-	// be overwritten by another channel member
-	transferAgreeKey, err := ctx.GetStub().CreateCompositeKey(transferAgreementObjectType, []string{valueJSON.ID})
+	buyerMSP, err := ctx.GetClientIdentity().GetMSPID()
 	if err != nil {
-		return fmt.Errorf("failed to create composite key: %v", err)
+		return fmt.Errorf("failed to get verified MSPID: %v", err)
 	}
 
-	log.Printf("AgreeToTransfer Put: collection %v, ID %v, Key %v", commitmentCollection, valueJSON.ID, transferAgreeKey)
-	err = ctx.GetStub().PutPrivateData(commitmentCollection, transferAgreeKey, []byte(clientID))
+	// Create agreeement that indicates which identity has agreed to purchase. The agreement is keyed
+	// by the buyer identity so that competing offers do not overwrite each other.
+	transferAgreement := TransferAgreement{
+		ID:       valueJSON.ID,
+		BuyerID:  clientID,
+		BuyerMSP: buyerMSP,
+	}
+	err = putAgreement(ctx, &transferAgreement)
 	if err != nil {
-		return fmt.Errorf("failed to put commitment bid: %v", err)
+		return err
 	}
 
-	return nil
+	buyers, err := readOfferIndex(ctx, valueJSON.ID)
+	if err != nil {
+		return err
+	}
+	err = putOfferIndex(ctx, valueJSON.ID, append(removeOffer(buyers, clientID), clientID))
+	if err != nil {
+		return err
+	}
+
+	header, err := eventHeader(ctx)
+	if err != nil {
+		return err
+	}
+	err = emitEvent(ctx, events.OfferMadeEvent, events.OfferMade{
+		Header:       header,
+		CommitmentID: valueJSON.ID,
+		BuyerMSP:     buyerMSP,
+	})
+	if err != nil {
+		return err
+	}
+
+	if commitmentStatus(commitment) == StatusUnderAgreement {
+		return s.recordAudit(ctx, valueJSON.ID, nil)
+	}
+
+	// Mark the commitment as under agreement so other buyers can see an offer is pending
+	err = transitionCommitment(commitment, StatusUnderAgreement)
+	if err != nil {
+		return err
+	}
+
+	return s.putCommitment(ctx, commitment)
 }
 
-// TransferCommitment transfers the commitment to the new owner by setting a new owner ID
+// TransferCommitment transfers the commitment to the new owner by setting a new owner ID.
+// The owner accepts the offer of the chosen buyer, the competing offers are closed out.
 func (s *SmartContract) TransferCommitment(ctx contractapi.TransactionContextInterface) error {
 
 	transientMap, err := ctx.GetStub().GetTransient()
@@ -503,6 +646,10 @@ func (s *SmartContract) TransferCommitment(ctx contractapi.TransactionContextInt
 	type commitmentTransferTransientInput struct {
 		ID       string `json:"commitmentID"`
 		BuyerMSP string `json:"buyerMSP"`
+		BuyerID  string `json:"buyerID"`
+		// The owner may opt in to contribute the agreed unit price to the price index of the season
+		ContributeToPriceIndex bool   `json:"contributeToPriceIndex"`
+		Season                 string `json:"season"`
 	}
 
 	var commitmentTransferInput commitmentTransferTransientInput
@@ -517,6 +664,12 @@ func (s *SmartContract) TransferCommitment(ctx contractapi.TransactionContextInt
 	if len(commitmentTransferInput.BuyerMSP) == 0 {
 		return fmt.Errorf("buyerMSP field must be a non-empty string")
 	}
+	if len(commitmentTransferInput.BuyerID) == 0 {
+		return fmt.Errorf("buyerID field must be a non-empty string")
+	}
+	if commitmentTransferInput.ContributeToPriceIndex && len(commitmentTransferInput.Season) == 0 {
+		return fmt.Errorf("season field must be a non-empty string to contribute to the price index")
+	}
 	log.Printf("TransferCommitment: verify commitment exists ID %v", commitmentTransferInput.ID)
 	// Read commitment from the private data collection
 	commitment, err := s.ReadCommitment(ctx, commitmentTransferInput.ID)
@@ -526,63 +679,136 @@ func (s *SmartContract) TransferCommitment(ctx contractapi.TransactionContextInt
 	if commitment == nil {
 		return fmt.Errorf("%v does not exist", commitmentTransferInput.ID)
 	}
+	if commitmentStatus(commitment) != StatusUnderAgreement {
+		return fmt.Errorf("commitment %v is %v, a buyer must agree to the transfer first", commitmentTransferInput.ID, commitmentStatus(commitment))
+	}
 	// Verify that the client is submitting request to peer in their organization
-	err = verifyClientOrgMatchesPeerOrg(ctx)
+	err = s.verifyClientOrgMatchesPeerOrg(ctx)
 	if err != nil {
 		return fmt.Errorf("TransferCommitment cannot be performed: Error %v", err)
 	}
 
-	// Verify transfer details and transfer owner
-	err = s.verifyAgreement(ctx, commitmentTransferInput.ID, commitment.Owner, commitmentTransferInput.BuyerMSP)
+	transferAgreement, err := s.ReadTransferAgreement(ctx, commitmentTransferInput.ID, commitmentTransferInput.BuyerID)
 	if err != nil {
-		return fmt.Errorf("failed transfer verification: %v", err)
+		return fmt.Errorf("failed ReadTransferAgreement to find buyerID: %v", err)
+	}
+	if transferAgreement == nil {
+		return fmt.Errorf("%v has no offer from buyer %v", commitmentTransferInput.ID, commitmentTransferInput.BuyerID)
+	}
+	if transferAgreement.BuyerMSP != commitmentTransferInput.BuyerMSP {
+		return fmt.Errorf("offer on %v was made by a member of %v, not %v", commitmentTransferInput.ID, transferAgreement.BuyerMSP, commitmentTransferInput.BuyerMSP)
 	}
 
-	transferAgreement, err := s.ReadTransferAgreement(ctx, commitmentTransferInput.ID)
+	// Verify transfer details and transfer owner
+	previousOwner := commitment.Owner
+	err = s.verifyAgreement(ctx, commitmentTransferInput.ID, previousOwner, commitmentTransferInput.BuyerMSP, transferAgreement.BuyerID)
 	if err != nil {
-		return fmt.Errorf("failed ReadTransferAgreement to find buyerID: %v", err)
+		return fmt.Errorf("failed transfer verification: %v", err)
 	}
-	if transferAgreement.BuyerID == "" {
-		return fmt.Errorf("BuyerID not found in TransferAgreement for %v", commitmentTransferInput.ID)
+
+	// The agreed terms are read before the owner's details are deleted below
+	if commitmentTransferInput.ContributeToPriceIndex {
+		ownersCollection, err := s.getCollectionName(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to infer private collection name for the org: %v", err)
+		}
+		terms, err := s.ReadCommitmentPrivateDetails(ctx, ownersCollection, commitmentTransferInput.ID)
+		if err != nil {
+			return err
+		}
+		if terms == nil {
+			return fmt.Errorf("terms of %v do not exist in collection %v", commitmentTransferInput.ID, ownersCollection)
+		}
+		err = contributeToPriceIndex(ctx, commitment, terms, commitmentTransferInput.Season)
+		if err != nil {
+			return err
+		}
 	}
 
 	// Transfer commitment in private data collection to new owner
 	commitment.Owner = transferAgreement.BuyerID
-
-	commitmentJSONasBytes, err := json.Marshal(commitment)
+	err = transitionCommitment(commitment, StatusTransferred)
 	if err != nil {
-		return fmt.Errorf("failed marshalling commitment %v: %v", commitmentTransferInput.ID, err)
+		return err
 	}
 
 	log.Printf("TransferCommitment Put: collection %v, ID %v", commitmentCollection, commitmentTransferInput.ID)
-	err = ctx.GetStub().PutPrivateData(commitmentCollection, commitmentTransferInput.ID, commitmentJSONasBytes) //rewrite the commitment
+	err = s.putCommitment(ctx, commitment) //rewrite the commitment
+	if err != nil {
+		return err
+	}
+
+	// The member commitments of a lot change hands with the lot
+	lot, err := readLot(ctx, commitmentTransferInput.ID)
 	if err != nil {
 		return err
 	}
+	if lot != nil {
+		err = s.transferLotMembers(ctx, lot, commitment.Owner)
+		if err != nil {
+			return err
+		}
+	}
 
 	// Get collection name for this organization
-	ownersCollection, err := getCollectionName(ctx)
+	ownersCollection, err := s.getCollectionName(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to infer private collection name for the org: %v", err)
 	}
 
-	// Delete the commitment rate value from this organization's private data collection
-	err = ctx.GetStub().DelPrivateData(ownersCollection, commitmentTransferInput.ID)
+	ownerDetailsKey, err := privateDetailsKey(ctx, commitmentTransferInput.ID, previousOwner)
+	if err != nil {
+		return err
+	}
+
+	// Delete the commitment rate value from this organization's private data collection.
+	// The value the buyer agreed to remains in the buyer's collection as the new owner's details.
+	err = ctx.GetStub().DelPrivateData(ownersCollection, ownerDetailsKey)
+	if err != nil {
+		return err
+	}
+
+	// An auction on the commitment is complete once the winner has taken ownership
+	auction, err := readAuction(ctx, commitmentTransferInput.ID)
+	if err != nil {
+		return err
+	}
+	if auction != nil {
+		err = deleteAuction(ctx, auction)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Delete the accepted agreement and close out the competing offers in the commitment collection
+	buyers, err := readOfferIndex(ctx, commitmentTransferInput.ID)
 	if err != nil {
 		return err
 	}
 
-	// Delete the transfer agreement from the commitment collection
-	transferAgreeKey, err := ctx.GetStub().CreateCompositeKey(transferAgreementObjectType, []string{commitmentTransferInput.ID})
+	err = closeOffers(ctx, commitmentTransferInput.ID, append(removeOffer(buyers, transferAgreement.BuyerID), transferAgreement.BuyerID))
 	if err != nil {
-		return fmt.Errorf("failed to create composite key: %v", err)
+		return err
 	}
 
-	err = ctx.GetStub().DelPrivateData(commitmentCollection, transferAgreeKey)
+	sellerMSP, err := clientMSP(ctx)
 	if err != nil {
 		return err
 	}
 
+	header, err := eventHeader(ctx)
+	if err != nil {
+		return err
+	}
+	err = emitEvent(ctx, events.CommitmentTransferredEvent, events.CommitmentTransferred{
+		Header:       header,
+		CommitmentID: commitmentTransferInput.ID,
+		SellerMSP:    sellerMSP,
+		BuyerMSP:     transferAgreement.BuyerMSP,
+	})
+	if err != nil {
+		return err
+	}
 	return nil
 
 }
@@ -590,12 +816,12 @@ func (s *SmartContract) TransferCommitment(ctx contractapi.TransactionContextInt
 // verifyAgreement is an internal helper function used by TransferCommitment to verify
 // that the transfer is being initiated by the owner and that the buyer has agreed
 // to the same appraisal value as the owner
-func (s *SmartContract) verifyAgreement(ctx contractapi.TransactionContextInterface, commitmentID string, owner string, buyerMSP string) error {
+func (s *SmartContract) verifyAgreement(ctx contractapi.TransactionContextInterface, commitmentID string, owner string, buyerMSP string, buyerID string) error {
 
 	// Check 1: verify that the transfer is being initiatied by the owner
 
 	// Get ID of submitting client identity
-	clientID, err := submittingClientIdentity(ctx)
+	clientID, err := s.submittingClientIdentity(ctx)
 	if err != nil {
 		return err
 	}
@@ -604,18 +830,40 @@ func (s *SmartContract) verifyAgreement(ctx contractapi.TransactionContextInterf
 		return fmt.Errorf("error: submitting client identity does not own commitment")
 	}
 
-	// Check 2: verify that the buyer has agreed to the rate value
+	// Check 2: verify that the buyer has agreed to the same salted terms
 
 	// Get collection names
-	collectionOwner, err := getCollectionName(ctx) // get owner collection from caller identity
+	collectionOwner, err := s.getCollectionName(ctx) // get owner collection from caller identity
 	if err != nil {
 		return fmt.Errorf("failed to infer private collection name for the org: %v", err)
 	}
 
-	collectionBuyer := buyerMSP + "PrivateCollection" // get buyers collection
+	collectionBuyer := s.topology().OrgCollection(buyerMSP) // get buyers collection
+
+	// Unsalted terms could be recovered from their hash, the owner must set salted terms with AgreeToSell
+	ownerDetails, err := s.ReadCommitmentPrivateDetails(ctx, collectionOwner, commitmentID)
+	if err != nil {
+		return err
+	}
+	if ownerDetails == nil {
+		return fmt.Errorf("rate value for %v does not exist in collection %v", commitmentID, collectionOwner)
+	}
+	if len(ownerDetails.Salt) == 0 {
+		return fmt.Errorf("terms for %v are not salted, AgreeToSell must be called by the owner first", commitmentID)
+	}
+
+	// Get the keys of the owner's and the buyer's rate details
+	ownerDetailsKey, err := privateDetailsKey(ctx, commitmentID, owner)
+	if err != nil {
+		return err
+	}
+	buyerDetailsKey, err := privateDetailsKey(ctx, commitmentID, buyerID)
+	if err != nil {
+		return err
+	}
 
 	// Get hash of owners agreed to value
-	ownerRateHash, err := ctx.GetStub().GetPrivateDataHash(collectionOwner, commitmentID)
+	ownerRateHash, err := ctx.GetStub().GetPrivateDataHash(collectionOwner, ownerDetailsKey)
 	if err != nil {
 		return fmt.Errorf("failed to get hash of rate value from owners collection %v: %v", collectionOwner, err)
 	}
@@ -624,7 +872,7 @@ func (s *SmartContract) verifyAgreement(ctx contractapi.TransactionContextInterf
 	}
 
 	// Get hash of buyers agreed to value
-	buyerRateHash, err := ctx.GetStub().GetPrivateDataHash(collectionBuyer, commitmentID)
+	buyerRateHash, err := ctx.GetStub().GetPrivateDataHash(collectionBuyer, buyerDetailsKey)
 	if err != nil {
 		return fmt.Errorf("failed to get hash of rate value from buyer collection %v: %v", collectionBuyer, err)
 	}
@@ -634,13 +882,15 @@ func (s *SmartContract) verifyAgreement(ctx contractapi.TransactionContextInterf
 
 	// Verify that the two hashes match
 	if !bytes.Equal(ownerRateHash, buyerRateHash) {
-		return fmt.Errorf("hash for rate value for owner %x does not value for seller %x", ownerRateHash, buyerRateHash)
+		return fmt.Errorf("hash for terms of owner %x does not match terms of buyer %x, compare them with PreviewAgreementHash", ownerRateHash, buyerRateHash)
 	}
 
 	return nil
 }
 
-// DeleteCommitment can be used by the owner of the commitment to delete the commitment
+// DeleteCommitment can be used by the owner of the commitment to cancel the commitment. The
+// commitment record stays in the commitmentCollection with a Cancelled status while the
+// private details are removed from the owner's collection.
 func (s *SmartContract) DeleteCommitment(ctx contractapi.TransactionContextInterface) error {
 
 	transientMap, err := ctx.GetStub().GetTransient()
@@ -669,27 +919,41 @@ func (s *SmartContract) DeleteCommitment(ctx contractapi.TransactionContextInter
 	}
 
 	// Verify that the client is submitting request to peer in their organization
-	err = verifyClientOrgMatchesPeerOrg(ctx)
+	err = s.verifyClientOrgMatchesPeerOrg(ctx)
 	if err != nil {
 		return fmt.Errorf("DeleteCommitment cannot be performed: Error %v", err)
 	}
 
 	log.Printf("Deleting Commitment: %v", commitmentDeleteInput.ID)
-	valAsbytes, err := ctx.GetStub().GetPrivateData(commitmentCollection, commitmentDeleteInput.ID) //get the commitment from chaincode state
+	commitment, err := s.ReadCommitment(ctx, commitmentDeleteInput.ID) //get the commitment from chaincode state
 	if err != nil {
 		return fmt.Errorf("failed to read commitment: %v", err)
 	}
-	if valAsbytes == nil {
+	if commitment == nil {
 		return fmt.Errorf("commitment not found: %v", commitmentDeleteInput.ID)
 	}
+	status := commitmentStatus(commitment)
+
+	clientID, err := s.submittingClientIdentity(ctx)
+	if err != nil {
+		return err
+	}
+	if clientID != commitment.Owner {
+		return fmt.Errorf("error: submitting client identity does not own commitment")
+	}
 
-	ownerCollection, err := getCollectionName(ctx) // Get owners collection
+	ownerCollection, err := s.getCollectionName(ctx) // Get owners collection
 	if err != nil {
 		return fmt.Errorf("failed to infer private collection name for the org: %v", err)
 	}
 
+	ownerDetailsKey, err := privateDetailsKey(ctx, commitmentDeleteInput.ID, clientID)
+	if err != nil {
+		return err
+	}
+
 	//check the commitment is in the caller org's private collection
-	valAsbytes, err = ctx.GetStub().GetPrivateData(ownerCollection, commitmentDeleteInput.ID)
+	valAsbytes, err := ctx.GetStub().GetPrivateData(ownerCollection, ownerDetailsKey)
 	if err != nil {
 		return fmt.Errorf("failed to read commitment from owner's Collection: %v", err)
 	}
@@ -697,14 +961,70 @@ func (s *SmartContract) DeleteCommitment(ctx contractapi.TransactionContextInter
 		return fmt.Errorf("commitment not found in owner's private Collection %v: %v", ownerCollection, commitmentDeleteInput.ID)
 	}
 
-	// delete the commitment from state
-	err = ctx.GetStub().DelPrivateData(commitmentCollection, commitmentDeleteInput.ID)
+	// The commitment record is kept as Cancelled so that buyers can see it is no longer tradeable
+	err = transitionCommitment(commitment, StatusCancelled)
+	if err != nil {
+		return err
+	}
+	err = s.putCommitment(ctx, commitment)
+	if err != nil {
+		return err
+	}
+
+	// Cancelling a lot releases its member commitments
+	lot, err := readLot(ctx, commitmentDeleteInput.ID)
 	if err != nil {
-		return fmt.Errorf("failed to delete state: %v", err)
+		return err
+	}
+	if lot != nil {
+		err = s.releaseLotMembers(ctx, lot)
+		if err != nil {
+			return err
+		}
+	}
+
+	// A running auction and pending offers on a cancelled commitment can no longer be honoured
+	auction, err := readAuction(ctx, commitmentDeleteInput.ID)
+	if err != nil {
+		return err
+	}
+	if auction != nil {
+		err = deleteAuction(ctx, auction)
+		if err != nil {
+			return err
+		}
+	}
+	if status == StatusUnderAgreement {
+		buyers, err := readOfferIndex(ctx, commitmentDeleteInput.ID)
+		if err != nil {
+			return err
+		}
+		err = closeOffers(ctx, commitmentDeleteInput.ID, buyers)
+		if err != nil {
+			return err
+		}
 	}
 
 	// Finally, delete private details of commitment
-	err = ctx.GetStub().DelPrivateData(ownerCollection, commitmentDeleteInput.ID)
+	err = ctx.GetStub().DelPrivateData(ownerCollection, ownerDetailsKey)
+	if err != nil {
+		return err
+	}
+
+	ownerMSP, err := clientMSP(ctx)
+	if err != nil {
+		return err
+	}
+
+	header, err := eventHeader(ctx)
+	if err != nil {
+		return err
+	}
+	err = emitEvent(ctx, events.CommitmentDeletedEvent, events.CommitmentDeleted{
+		Header:       header,
+		CommitmentID: commitmentDeleteInput.ID,
+		OwnerMSP:     ownerMSP,
+	})
 	if err != nil {
 		return err
 	}
@@ -714,7 +1034,8 @@ func (s *SmartContract) DeleteCommitment(ctx contractapi.TransactionContextInter
 }
 
 // DeleteTranferAgreement can be used by the buyer to withdraw a proposal from
-// the commitment collection and from his own collection.
+// the commitment collection and from his own collection. A buyer whose offer was
+// closed out by a transfer to another buyer uses it to remove the agreed value.
 func (s *SmartContract) DeleteTranferAgreement(ctx contractapi.TransactionContextInterface) error {
 
 	transientMap, err := ctx.GetStub().GetTransient()
@@ -743,87 +1064,119 @@ func (s *SmartContract) DeleteTranferAgreement(ctx contractapi.TransactionContex
 	}
 
 	// Verify that the client is submitting request to peer in their organization
-	err = verifyClientOrgMatchesPeerOrg(ctx)
+	err = s.verifyClientOrgMatchesPeerOrg(ctx)
 	if err != nil {
 		return fmt.Errorf("DeleteTranferAgreement cannot be performed: Error %v", err)
 	}
 	// Delete private details of agreement
-	orgCollection, err := getCollectionName(ctx) // Get proposers collection.
+	orgCollection, err := s.getCollectionName(ctx) // Get proposers collection.
 	if err != nil {
 		return fmt.Errorf("failed to infer private collection name for the org: %v", err)
 	}
-	tranferAgreeKey, err := ctx.GetStub().CreateCompositeKey(transferAgreementObjectType, []string{commitmentDeleteInput.
-		ID}) // Create composite key
+	// Get ID of submitting client identity, the offer is keyed by the buyer identity
+	clientID, err := s.submittingClientIdentity(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to create composite key: %v", err)
+		return err
 	}
 
-	valAsbytes, err := ctx.GetStub().GetPrivateData(commitmentCollection, tranferAgreeKey) //get the transfer_agreement
+	commitment, err := s.ReadCommitment(ctx, commitmentDeleteInput.ID)
 	if err != nil {
-		return fmt.Errorf("failed to read transfer_agreement: %v", err)
+		return fmt.Errorf("error reading commitment: %v", err)
 	}
-	if valAsbytes == nil {
-		return fmt.Errorf("commitment's transfer_agreement does not exist: %v", commitmentDeleteInput.ID)
+	if commitment == nil {
+		return fmt.Errorf("%v does not exist", commitmentDeleteInput.ID)
+	}
+	// After an accepted offer the agreed value is the new owner's private details
+	if clientID == commitment.Owner {
+		return fmt.Errorf("error: submitting client identity owns commitment %v", commitmentDeleteInput.ID)
 	}
 
-	log.Printf("Deleting TranferAgreement: %v", commitmentDeleteInput.ID)
-	err = ctx.GetStub().DelPrivateData(orgCollection, commitmentDeleteInput.ID) // Delete the commitment
+	tranferAgreeKey, err := transferAgreementKey(ctx, commitmentDeleteInput.ID, clientID)
 	if err != nil {
 		return err
 	}
 
-	// Delete transfer agreement record
-	err = ctx.GetStub().DelPrivateData(commitmentCollection, tranferAgreeKey) // remove agreement from state
+	valAsbytes, err := ctx.GetStub().GetPrivateData(commitmentCollection, tranferAgreeKey) //get the transfer_agreement
 	if err != nil {
-		return err
+		return fmt.Errorf("failed to read transfer_agreement: %v", err)
 	}
 
-	return nil
-
-}
-
-// getCollectionName is an internal helper function to get collection of submitting client identity.
-func getCollectionName(ctx contractapi.TransactionContextInterface) (string, error) {
-
-	// Get the MSP ID of submitting client identity
-	clientMSPID, err := ctx.GetClientIdentity().GetMSPID()
+	buyerDetailsKey, err := privateDetailsKey(ctx, commitmentDeleteInput.ID, clientID)
 	if err != nil {
-		return "", fmt.Errorf("failed to get verified MSPID: %v", err)
+		return err
 	}
 
-	// Create the collection name
-	orgCollection := clientMSPID + "PrivateCollection"
+	// The offer may have been closed out when the owner accepted another buyer,
+	// in which case only the agreed value is left to remove
+	if valAsbytes == nil {
+		detailsAsBytes, err := ctx.GetStub().GetPrivateData(orgCollection, buyerDetailsKey)
+		if err != nil {
+			return fmt.Errorf("failed to read agreed value: %v", err)
+		}
+		if detailsAsBytes == nil {
+			return fmt.Errorf("commitment's transfer_agreement does not exist: %v", commitmentDeleteInput.ID)
+		}
+	}
 
-	return orgCollection, nil
-}
+	buyerMSP, err := clientMSP(ctx)
+	if err != nil {
+		return err
+	}
 
-// verifyClientOrgMatchesPeerOrg is an internal function used verify client org id and matches peer org id.
-func verifyClientOrgMatchesPeerOrg(ctx contractapi.TransactionContextInterface) error {
-	clientMSPID, err := ctx.GetClientIdentity().GetMSPID()
+	header, err := eventHeader(ctx)
 	if err != nil {
-		return fmt.Errorf("failed getting the client's MSPID: %v", err)
+		return err
 	}
-	peerMSPID, err := shim.GetMSPID()
+	err = emitEvent(ctx, events.AgreementWithdrawnEvent, events.AgreementWithdrawn{
+		Header:       header,
+		CommitmentID: commitmentDeleteInput.ID,
+		BuyerMSP:     buyerMSP,
+	})
 	if err != nil {
-		return fmt.Errorf("failed getting the peer's MSPID: %v", err)
+		return err
 	}
 
-	if clientMSPID != peerMSPID {
-		return fmt.Errorf("client from org %v is not authorized to read or write private data from an org %v peer", clientMSPID, peerMSPID)
+	if valAsbytes == nil {
+		log.Printf("Deleting closed out TranferAgreement: %v", commitmentDeleteInput.ID)
+		err = ctx.GetStub().DelPrivateData(orgCollection, buyerDetailsKey)
+		if err != nil {
+			return err
+		}
+		return s.recordAudit(ctx, commitmentDeleteInput.ID, nil)
 	}
 
-	return nil
-}
+	log.Printf("Deleting TranferAgreement: %v", commitmentDeleteInput.ID)
+	err = ctx.GetStub().DelPrivateData(orgCollection, buyerDetailsKey) // Delete the agreed value
+	if err != nil {
+		return err
+	}
+
+	// Delete transfer agreement record
+	err = deleteAgreement(ctx, commitmentDeleteInput.ID, clientID) // remove agreement from state
+	if err != nil {
+		return err
+	}
 
-func submittingClientIdentity(ctx contractapi.TransactionContextInterface) (string, error) {
-	b64ID, err := ctx.GetClientIdentity().GetID()
+	buyers, err := readOfferIndex(ctx, commitmentDeleteInput.ID)
 	if err != nil {
-		return "", fmt.Errorf("Failed to read clientID: %v", err)
+		return err
 	}
-	decodeID, err := base64.StdEncoding.DecodeString(b64ID)
+	buyers = removeOffer(buyers, clientID)
+	err = putOfferIndex(ctx, commitmentDeleteInput.ID, buyers)
 	if err != nil {
-		return "", fmt.Errorf("failed to base64 decode clientID: %v", err)
+		return err
+	}
+
+	// With the last offer withdrawn the commitment is available to other buyers again
+	if commitmentStatus(commitment) != StatusUnderAgreement || len(buyers) > 0 {
+		return s.recordAudit(ctx, commitmentDeleteInput.ID, nil)
 	}
-	return string(decodeID), nil
+	err = transitionCommitment(commitment, availableStatus(commitment))
+	if err != nil {
+		return err
+	}
+
+	return s.putCommitment(ctx, commitment)
+
 }
 
@@ -0,0 +1,977 @@
+package chaincode
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/hyperledger/fabric-samples/yield-commitment/chaincode-go/events"
+	"github.com/hyperledger/fabric-samples/yield-commitment/chaincode-go/simulator"
+	"github.com/stretchr/testify/require"
+)
+
+const crossOrgError = "is not authorized to read or write private data"
+
+// transactionCase is a transaction run against a network prepared by the setup of its table
+type transactionCase struct {
+	name     string
+	setup    func(n *testNetwork)                   // runs after the setup of the table
+	client   func(n *testNetwork) *simulator.Client // defaults to the producer
+	peerMSP  string                                 // defaults to the org of the client
+	input    transient
+	inputFor func(n *testNetwork) transient // replaces input when it depends on the identities of the network
+	err      string                         // expected error, empty if the transaction succeeds
+	check    func(t *testing.T, n *testNetwork)
+}
+
+func runTransactionCases(t *testing.T, function string, setup func(n *testNetwork), cases []transactionCase) {
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			n := newTestNetwork(t)
+			if setup != nil {
+				setup(n)
+			}
+			if tc.setup != nil {
+				tc.setup(n)
+			}
+
+			client := n.producer
+			if tc.client != nil {
+				client = tc.client(n)
+			}
+			peerMSP := tc.peerMSP
+			if peerMSP == "" {
+				peerMSP = client.MSPID()
+			}
+
+			input := tc.input
+			if tc.inputFor != nil {
+				input = tc.inputFor(n)
+			}
+
+			err := n.submitOnPeer(client, peerMSP, function, input)
+			if tc.err != "" {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), tc.err)
+			} else {
+				require.NoError(t, err)
+			}
+			if tc.check != nil {
+				tc.check(t, n)
+			}
+		})
+	}
+}
+
+func buyer(n *testNetwork) *simulator.Client     { return n.buyer }
+func rival(n *testNetwork) *simulator.Client     { return n.rival }
+func otherOrg1(n *testNetwork) *simulator.Client { return n.other }
+
+func TestCreateCommitment(t *testing.T) {
+	runTransactionCases(t, "CreateCommitment", nil, []transactionCase{
+		{
+			name:  "missing transient input",
+			input: transient{},
+			err:   "commitment not found in the transient map input",
+		},
+		{
+			name:  "malformed JSON",
+			input: transient{"commitment_properties": []byte("{")},
+			err:   "failed to unmarshal JSON",
+		},
+		{
+			name:  "missing objectType",
+			input: transient{"commitment_properties": with(commitmentInput("c1"), "objectType", nil)},
+			err:   "objectType field must be a non-empty string",
+		},
+		{
+			name:  "other objectType",
+			input: transient{"commitment_properties": with(commitmentInput("c1"), "objectType", "asset")},
+			err:   "objectType field must be commitment",
+		},
+		{
+			name:  "missing commitmentID",
+			input: transient{"commitment_properties": with(commitmentInput("c1"), "commitmentID", "")},
+			err:   "commitmentID field must be a non-empty string",
+		},
+		{
+			name:  "missing location",
+			input: transient{"commitment_properties": with(commitmentInput("c1"), "location", nil)},
+			err:   "location field must be a non-empty string",
+		},
+		{
+			name:  "zero production",
+			input: transient{"commitment_properties": with(commitmentInput("c1"), "production", 0)},
+			err:   "production field must be a positive integer",
+		},
+		{
+			name:  "negative size",
+			input: transient{"commitment_properties": with(commitmentInput("c1"), "size", -1)},
+			err:   "size field must be a positive integer",
+		},
+		{
+			name:  "missing crop",
+			input: transient{"commitment_properties": with(commitmentInput("c1"), "crop", nil)},
+			err:   "crop field must be a non-empty string",
+		},
+		{
+			name:  "malformed delivery deadline",
+			input: transient{"commitment_properties": with(commitmentInput("c1"), "deliveryDeadline", "next year")},
+			err:   "deliveryDeadline field must be an RFC3339 time",
+		},
+		{
+			name:  "zero rate",
+			input: transient{"commitment_properties": with(commitmentInput("c1"), "rate", 0)},
+			err:   "rate field must be a positive integer",
+		},
+		{
+			name:  "missing salt",
+			input: transient{"commitment_properties": with(commitmentInput("c1"), "salt", nil)},
+			err:   "salt field must be a non-empty string",
+		},
+		{
+			name:  "blank salt",
+			input: transient{"commitment_properties": with(commitmentInput("c1"), "salt", "  ")},
+			err:   "salt field must be a non-empty string",
+			check: func(t *testing.T, n *testNetwork) {
+				require.Nil(t, n.readCommitment("c1"))
+			},
+		},
+		{
+			name:  "malformed currency",
+			input: transient{"commitment_properties": with(commitmentInput("c1"), "currency", "dollars")},
+			err:   "currency field must be a three letter currency code",
+		},
+		{
+			name:  "inverted delivery window",
+			input: transient{"commitment_properties": with(with(commitmentInput("c1"), "deliveryStart", "2021-09-30T00:00:00Z"), "deliveryEnd", "2021-09-01T00:00:00Z")},
+			err:   "deliveryEnd must not be before deliveryStart",
+		},
+		{
+			name:  "existing commitment",
+			setup: func(n *testNetwork) { n.createCommitment("c1") },
+			input: transient{"commitment_properties": commitmentInput("c1")},
+			err:   "this commitment already exists: c1",
+		},
+		{
+			name:    "client of another org",
+			client:  buyer,
+			peerMSP: "Org1MSP",
+			input:   transient{"commitment_properties": commitmentInput("c1")},
+			err:     crossOrgError,
+		},
+		{
+			name:  "open commitment",
+			input: transient{"commitment_properties": commitmentInput("c1")},
+			check: func(t *testing.T, n *testNetwork) {
+				commitment := n.readCommitment("c1")
+				require.NotNil(t, commitment)
+				require.Equal(t, n.producer.ID(), commitment.Owner)
+				require.Equal(t, n.producer.ID(), commitment.Producer)
+				require.Equal(t, StatusOpen, commitment.Status)
+				require.Equal(t, 100, commitment.Production)
+
+				details := n.readDetails(n.producer, "c1")
+				require.NotNil(t, details)
+				require.Equal(t, 2500, details.Rate)
+				require.Equal(t, 100, details.Quantity, "quantity defaults to the production")
+				require.Equal(t, events.CommitmentCreatedEvent, n.lastEvent())
+			},
+		},
+		{
+			name:  "currency defaults to USD",
+			input: transient{"commitment_properties": with(commitmentInput("c1"), "currency", nil)},
+			check: func(t *testing.T, n *testNetwork) {
+				require.Equal(t, "USD", n.readDetails(n.producer, "c1").Currency)
+			},
+		},
+		{
+			name:  "draft commitment",
+			input: transient{"commitment_properties": with(commitmentInput("c1"), "draft", true)},
+			check: func(t *testing.T, n *testNetwork) {
+				require.Equal(t, StatusDraft, n.readCommitment("c1").Status)
+			},
+		},
+	})
+}
+
+func TestAgreeToSell(t *testing.T) {
+	setup := func(n *testNetwork) { n.createCommitment("c1") }
+
+	runTransactionCases(t, "AgreeToSell", setup, []transactionCase{
+		{
+			name:  "missing transient input",
+			input: transient{},
+			err:   "commitment_value key not found in the transient map",
+		},
+		{
+			name:  "unsalted terms",
+			input: transient{"commitment_value": with(termsInput("c1"), "salt", nil)},
+			err:   "salt field must be a non-empty string",
+		},
+		{
+			name:  "zero quantity",
+			input: transient{"commitment_value": with(termsInput("c1"), "quantity", 0)},
+			err:   "quantity field must be a positive integer",
+		},
+		{
+			name:    "client of another org",
+			peerMSP: "Org2MSP",
+			input:   transient{"commitment_value": termsInput("c1")},
+			err:     crossOrgError,
+		},
+		{
+			name:  "unknown commitment",
+			input: transient{"commitment_value": termsInput("c2")},
+			err:   "c2 does not exist",
+		},
+		{
+			name:  "quantity different from the production",
+			input: transient{"commitment_value": with(termsInput("c1"), "quantity", 90)},
+			err:   "quantity 90 does not match the production 100",
+		},
+		{
+			name:   "not the owner",
+			client: otherOrg1,
+			input:  transient{"commitment_value": termsInput("c1")},
+			err:    "submitting client identity does not own commitment",
+		},
+		{
+			name: "cancelled commitment",
+			setup: func(n *testNetwork) {
+				n.mustSubmit(n.producer, "DeleteCommitment", transient{"commitment_delete": map[string]string{"commitmentID": "c1"}})
+			},
+			input: transient{"commitment_value": termsInput("c1")},
+			err:   "commitment c1 is Cancelled and cannot be sold",
+		},
+		{
+			name:  "salted terms",
+			input: transient{"commitment_value": with(termsInput("c1"), "currency", " usd ")},
+			check: func(t *testing.T, n *testNetwork) {
+				details := n.readDetails(n.producer, "c1")
+				require.Equal(t, 3000, details.Rate)
+				require.Equal(t, "USD", details.Currency)
+				require.Equal(t, "a3c9e1", details.Salt)
+			},
+		},
+	})
+}
+
+func TestAgreeToTransfer(t *testing.T) {
+	setup := func(n *testNetwork) { n.createCommitment("c1") }
+
+	runTransactionCases(t, "AgreeToTransfer", setup, []transactionCase{
+		{
+			name:   "missing transient input",
+			client: buyer,
+			input:  transient{},
+			err:    "commitment_value key not found in the transient map",
+		},
+		{
+			name:   "unsalted terms",
+			client: buyer,
+			input:  transient{"commitment_value": with(termsInput("c1"), "salt", "")},
+			err:    "salt field must be a non-empty string",
+		},
+		{
+			name:   "unknown commitment",
+			client: buyer,
+			input:  transient{"commitment_value": termsInput("c2")},
+			err:    "c2 does not exist",
+		},
+		{
+			name:  "owner of the commitment",
+			input: transient{"commitment_value": termsInput("c1")},
+			err:   "submitting client identity already owns commitment c1",
+		},
+		{
+			name:   "quantity different from the production",
+			client: buyer,
+			input:  transient{"commitment_value": with(termsInput("c1"), "quantity", 200)},
+			err:    "quantity 200 does not match the production 100",
+		},
+		{
+			name:    "client of another org",
+			client:  buyer,
+			peerMSP: "Org1MSP",
+			input:   transient{"commitment_value": termsInput("c1")},
+			err:     crossOrgError,
+		},
+		{
+			name: "draft commitment",
+			setup: func(n *testNetwork) {
+				n.mustSubmit(n.producer, "CreateCommitment", transient{"commitment_properties": with(commitmentInput("c2"), "draft", true)})
+			},
+			client: buyer,
+			input:  transient{"commitment_value": termsInput("c2")},
+			err:    "commitment c2 is Draft and cannot be agreed to",
+		},
+		{
+			name:   "first offer",
+			client: buyer,
+			input:  transient{"commitment_value": termsInput("c1")},
+			check: func(t *testing.T, n *testNetwork) {
+				require.Equal(t, StatusUnderAgreement, n.readCommitment("c1").Status)
+				require.NotNil(t, n.readDetails(n.buyer, "c1"))
+				require.Equal(t, events.OfferMadeEvent, n.lastEvent())
+
+				var agreement *TransferAgreement
+				err := n.evaluate(n.producer, func(ctx contractapi.TransactionContextInterface) error {
+					var err error
+					agreement, err = n.contract.ReadTransferAgreement(ctx, "c1", n.buyer.ID())
+					return err
+				})
+				require.NoError(t, err)
+				require.Equal(t, &TransferAgreement{ID: "c1", BuyerID: n.buyer.ID(), BuyerMSP: "Org2MSP"}, agreement)
+			},
+		},
+		{
+			name: "competing offer",
+			setup: func(n *testNetwork) {
+				n.mustSubmit(n.rival, "AgreeToTransfer", transient{"commitment_value": termsInput("c1")})
+			},
+			client: buyer,
+			input:  transient{"commitment_value": with(termsInput("c1"), "rate", 3100)},
+			check: func(t *testing.T, n *testNetwork) {
+				require.Equal(t, StatusUnderAgreement, n.readCommitment("c1").Status)
+				require.Equal(t, 3100, n.readDetails(n.buyer, "c1").Rate)
+				require.Equal(t, 3000, n.readDetails(n.rival, "c1").Rate)
+			},
+		},
+	})
+}
+
+func TestTransferCommitment(t *testing.T) {
+	setup := func(n *testNetwork) {
+		n.createCommitment("c1")
+		n.agree("c1", n.buyer)
+	}
+	owner := func(n *testNetwork, buyer *simulator.Client) transient {
+		return transient{"commitment_owner": map[string]interface{}{"commitmentID": "c1", "buyerMSP": buyer.MSPID(), "buyerID": buyer.ID()}}
+	}
+
+	cases := []transactionCase{
+		{
+			name:  "missing transient input",
+			input: transient{},
+			err:   "commitment owner not found in the transient map",
+		},
+		{
+			name:  "malformed JSON",
+			input: transient{"commitment_owner": []byte("[]")},
+			err:   "failed to unmarshal JSON",
+		},
+		{
+			name:  "missing commitmentID",
+			input: transient{"commitment_owner": map[string]string{"buyerMSP": "Org2MSP", "buyerID": "buyer"}},
+			err:   "commitmentID field must be a non-empty string",
+		},
+		{
+			name:  "missing buyerMSP",
+			input: transient{"commitment_owner": map[string]string{"commitmentID": "c1", "buyerID": "buyer"}},
+			err:   "buyerMSP field must be a non-empty string",
+		},
+		{
+			name:  "missing buyerID",
+			input: transient{"commitment_owner": map[string]string{"commitmentID": "c1", "buyerMSP": "Org2MSP"}},
+			err:   "buyerID field must be a non-empty string",
+		},
+		{
+			name:  "price index contribution without a season",
+			input: transient{"commitment_owner": map[string]interface{}{"commitmentID": "c1", "buyerMSP": "Org2MSP", "buyerID": "buyer", "contributeToPriceIndex": true}},
+			err:   "season field must be a non-empty string",
+		},
+		{
+			name:  "unknown commitment",
+			input: transient{"commitment_owner": map[string]string{"commitmentID": "c2", "buyerMSP": "Org2MSP", "buyerID": "buyer"}},
+			err:   "c2 does not exist",
+		},
+		{
+			name:  "commitment without offers",
+			setup: func(n *testNetwork) { n.createCommitment("c2") },
+			input: transient{"commitment_owner": map[string]string{"commitmentID": "c2", "buyerMSP": "Org2MSP", "buyerID": "buyer"}},
+			err:   "commitment c2 is Open, a buyer must agree to the transfer first",
+		},
+		{
+			name:     "client of another org",
+			peerMSP:  "Org2MSP",
+			inputFor: func(n *testNetwork) transient { return owner(n, n.buyer) },
+			err:      crossOrgError,
+		},
+		{
+			name:     "buyer without an offer",
+			inputFor: func(n *testNetwork) transient { return owner(n, n.rival) },
+			err:      "has no offer from buyer",
+		},
+		{
+			name: "buyer of another org",
+			inputFor: func(n *testNetwork) transient {
+				return transient{"commitment_owner": with(owner(n, n.buyer)["commitment_owner"].(map[string]interface{}), "buyerMSP", "Org1MSP")}
+			},
+			err: "offer on c1 was made by a member of Org2MSP, not Org1MSP",
+		},
+		{
+			name:     "not the owner",
+			client:   otherOrg1,
+			inputFor: func(n *testNetwork) transient { return owner(n, n.buyer) },
+			err:      "submitting client identity does not own commitment",
+		},
+		{
+			name: "buyer agreed to different terms",
+			setup: func(n *testNetwork) {
+				n.mustSubmit(n.buyer, "AgreeToTransfer", transient{"commitment_value": with(termsInput("c1"), "rate", 2900)})
+			},
+			inputFor: func(n *testNetwork) transient { return owner(n, n.buyer) },
+			err:      "does not match terms of buyer",
+		},
+		{
+			name:   "owner terms are not salted",
+			client: otherOrg1,
+			setup: func(n *testNetwork) {
+				// A commitment created before salts were required, whose owner never called AgreeToSell
+				n.mustSubmit(n.other, "CreateCommitment", transient{"commitment_properties": commitmentInput("c2")})
+				require.NoError(n.t, n.call(n.other, "seed", func(ctx contractapi.TransactionContextInterface) error {
+					ownerKey, err := privateDetailsKey(ctx, "c2", n.other.ID())
+					require.NoError(n.t, err)
+					return ctx.GetStub().PutPrivateData("Org1MSPPrivateCollection", ownerKey, []byte(`{"commitmentID":"c2","rate":2500,"quantity":100}`))
+				}))
+				n.mustSubmit(n.buyer, "AgreeToTransfer", transient{"commitment_value": termsInput("c2")})
+			},
+			inputFor: func(n *testNetwork) transient {
+				return transient{"commitment_owner": with(owner(n, n.buyer)["commitment_owner"].(map[string]interface{}), "commitmentID", "c2")}
+			},
+			err: "terms for c2 are not salted",
+		},
+		{
+			name: "accepted offer",
+			setup: func(n *testNetwork) {
+				n.mustSubmit(n.rival, "AgreeToTransfer", transient{"commitment_value": termsInput("c1")})
+			},
+			inputFor: func(n *testNetwork) transient { return owner(n, n.buyer) },
+			check: func(t *testing.T, n *testNetwork) {
+				commitment := n.readCommitment("c1")
+				require.Equal(t, n.buyer.ID(), commitment.Owner)
+				require.Equal(t, n.producer.ID(), commitment.Producer)
+				require.Equal(t, StatusTransferred, commitment.Status)
+				require.Nil(t, n.readDetails(n.producer, "c1"))
+				require.NotNil(t, n.readDetails(n.buyer, "c1"))
+				require.Equal(t, events.CommitmentTransferredEvent, n.lastEvent())
+
+				// The competing offer is closed out with the accepted one
+				err := n.evaluate(n.producer, func(ctx contractapi.TransactionContextInterface) error {
+					offers, err := n.contract.GetTransferAgreementsByCommitment(ctx, "c1")
+					require.Empty(t, offers)
+					return err
+				})
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "accepted offer contributing to the price index",
+			inputFor: func(n *testNetwork) transient {
+				input := owner(n, n.buyer)["commitment_owner"].(map[string]interface{})
+				return transient{"commitment_owner": with(with(input, "contributeToPriceIndex", true), "season", "2021")}
+			},
+			check: func(t *testing.T, n *testNetwork) {
+				require.Equal(t, n.buyer.ID(), n.readCommitment("c1").Owner)
+			},
+		},
+	}
+
+	runTransactionCases(t, "TransferCommitment", setup, cases)
+}
+
+func TestVerifyAgreement(t *testing.T) {
+	cases := []struct {
+		name       string
+		ownerTerms map[string]interface{}
+		buyerTerms map[string]interface{}
+		err        string
+	}{
+		{
+			name:       "identical terms",
+			ownerTerms: termsInput("c1"),
+			buyerTerms: termsInput("c1"),
+		},
+		{
+			name:       "terms that only differ in form",
+			ownerTerms: termsInput("c1"),
+			buyerTerms: with(with(termsInput("c1"), "currency", "usd "), "commitmentID", " c1"),
+		},
+		{
+			name:       "different rate",
+			ownerTerms: termsInput("c1"),
+			buyerTerms: with(termsInput("c1"), "rate", 3001),
+			err:        "does not match terms of buyer",
+		},
+		{
+			name:       "different salt",
+			ownerTerms: termsInput("c1"),
+			buyerTerms: with(termsInput("c1"), "salt", "ffffff"),
+			err:        "does not match terms of buyer",
+		},
+		{
+			name:       "different currency",
+			ownerTerms: termsInput("c1"),
+			buyerTerms: with(termsInput("c1"), "currency", "EUR"),
+			err:        "does not match terms of buyer",
+		},
+		{
+			name:       "different delivery window",
+			ownerTerms: with(with(termsInput("c1"), "deliveryStart", "2021-09-01T00:00:00Z"), "deliveryEnd", "2021-09-30T00:00:00Z"),
+			buyerTerms: with(with(termsInput("c1"), "deliveryStart", "2021-09-01T00:00:00Z"), "deliveryEnd", "2021-10-30T00:00:00Z"),
+			err:        "does not match terms of buyer",
+		},
+		{
+			name:       "buyer has not agreed",
+			ownerTerms: termsInput("c1"),
+			err:        "AgreeToTransfer must be called by the buyer first",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			n := newTestNetwork(t)
+			n.createCommitment("c1")
+			n.mustSubmit(n.producer, "AgreeToSell", transient{"commitment_value": tc.ownerTerms})
+			if tc.buyerTerms != nil {
+				n.mustSubmit(n.buyer, "AgreeToTransfer", transient{"commitment_value": tc.buyerTerms})
+			}
+
+			err := n.evaluate(n.producer, func(ctx contractapi.TransactionContextInterface) error {
+				return n.contract.verifyAgreement(ctx, "c1", n.producer.ID(), n.buyer.MSPID(), n.buyer.ID())
+			})
+			if tc.err != "" {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), tc.err)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestDeleteCommitment(t *testing.T) {
+	setup := func(n *testNetwork) { n.createCommitment("c1") }
+	deleteInput := func(id string) transient {
+		return transient{"commitment_delete": map[string]string{"commitmentID": id}}
+	}
+
+	runTransactionCases(t, "DeleteCommitment", setup, []transactionCase{
+		{
+			name:  "missing transient input",
+			input: transient{},
+			err:   "commitment to delete not found in the transient map",
+		},
+		{
+			name:  "missing commitmentID",
+			input: deleteInput(""),
+			err:   "commitmentID field must be a non-empty string",
+		},
+		{
+			name:    "client of another org",
+			peerMSP: "Org2MSP",
+			input:   deleteInput("c1"),
+			err:     crossOrgError,
+		},
+		{
+			name:  "unknown commitment",
+			input: deleteInput("c2"),
+			err:   "commitment not found: c2",
+		},
+		{
+			name:   "not the owner",
+			client: otherOrg1,
+			input:  deleteInput("c1"),
+			err:    "submitting client identity does not own commitment",
+		},
+		{
+			name:  "cancelled commitment",
+			setup: func(n *testNetwork) { n.mustSubmit(n.producer, "DeleteCommitment", deleteInput("c1")) },
+			input: deleteInput("c1"),
+			err:   "commitment not found in owner's private Collection",
+		},
+		{
+			name:  "open commitment",
+			input: deleteInput("c1"),
+			check: func(t *testing.T, n *testNetwork) {
+				require.Equal(t, StatusCancelled, n.readCommitment("c1").Status)
+				require.Nil(t, n.readDetails(n.producer, "c1"))
+				require.Equal(t, events.CommitmentDeletedEvent, n.lastEvent())
+			},
+		},
+		{
+			name:  "commitment with pending offers",
+			setup: func(n *testNetwork) { n.agree("c1", n.buyer) },
+			input: deleteInput("c1"),
+			check: func(t *testing.T, n *testNetwork) {
+				require.Equal(t, StatusCancelled, n.readCommitment("c1").Status)
+				err := n.evaluate(n.producer, func(ctx contractapi.TransactionContextInterface) error {
+					offers, err := n.contract.GetTransferAgreementsByCommitment(ctx, "c1")
+					require.Empty(t, offers)
+					return err
+				})
+				require.NoError(t, err)
+			},
+		},
+	})
+}
+
+func TestDeleteTranferAgreement(t *testing.T) {
+	setup := func(n *testNetwork) {
+		n.createCommitment("c1")
+		n.agree("c1", n.buyer)
+	}
+	deleteInput := func(id string) transient {
+		return transient{"agreement_delete": map[string]string{"commitmentID": id}}
+	}
+
+	runTransactionCases(t, "DeleteTranferAgreement", setup, []transactionCase{
+		{
+			name:   "missing transient input",
+			client: buyer,
+			input:  transient{},
+			err:    "commitment to delete not found in the transient map",
+		},
+		{
+			name:   "missing commitmentID",
+			client: buyer,
+			input:  deleteInput(""),
+			err:    "transient input ID field must be a non-empty string",
+		},
+		{
+			name:    "client of another org",
+			client:  buyer,
+			peerMSP: "Org1MSP",
+			input:   deleteInput("c1"),
+			err:     crossOrgError,
+		},
+		{
+			name:   "unknown commitment",
+			client: buyer,
+			input:  deleteInput("c2"),
+			err:    "c2 does not exist",
+		},
+		{
+			name:  "owner of the commitment",
+			input: deleteInput("c1"),
+			err:   "submitting client identity owns commitment c1",
+		},
+		{
+			name:   "buyer without an offer",
+			client: rival,
+			input:  deleteInput("c1"),
+			err:    "commitment's transfer_agreement does not exist: c1",
+			check: func(t *testing.T, n *testNetwork) {
+				require.Equal(t, events.OfferMadeEvent, n.lastEvent())
+			},
+		},
+		{
+			name:   "last offer",
+			client: buyer,
+			input:  deleteInput("c1"),
+			check: func(t *testing.T, n *testNetwork) {
+				require.Equal(t, StatusOpen, n.readCommitment("c1").Status)
+				require.Nil(t, n.readDetails(n.buyer, "c1"))
+				require.Equal(t, events.AgreementWithdrawnEvent, n.lastEvent())
+			},
+		},
+		{
+			name: "last offer on a resold commitment",
+			setup: func(n *testNetwork) {
+				n.mustSubmit(n.producer, "TransferCommitment", transient{"commitment_owner": map[string]string{"commitmentID": "c1", "buyerMSP": "Org2MSP", "buyerID": n.buyer.ID()}})
+				n.mustSubmit(n.buyer, "AgreeToSell", transient{"commitment_value": termsInput("c1")})
+				n.mustSubmit(n.other, "AgreeToTransfer", transient{"commitment_value": termsInput("c1")})
+			},
+			client: otherOrg1,
+			input:  deleteInput("c1"),
+			check: func(t *testing.T, n *testNetwork) {
+				require.Equal(t, StatusTransferred, n.readCommitment("c1").Status)
+				require.Equal(t, n.buyer.ID(), n.readCommitment("c1").Owner)
+			},
+		},
+		{
+			name: "one of several offers",
+			setup: func(n *testNetwork) {
+				n.mustSubmit(n.rival, "AgreeToTransfer", transient{"commitment_value": termsInput("c1")})
+			},
+			client: buyer,
+			input:  deleteInput("c1"),
+			check: func(t *testing.T, n *testNetwork) {
+				require.Equal(t, StatusUnderAgreement, n.readCommitment("c1").Status)
+				require.NotNil(t, n.readDetails(n.rival, "c1"))
+			},
+		},
+		{
+			name: "offer closed out by a transfer to another buyer",
+			setup: func(n *testNetwork) {
+				n.mustSubmit(n.rival, "AgreeToTransfer", transient{"commitment_value": termsInput("c1")})
+				n.mustSubmit(n.producer, "TransferCommitment", transient{"commitment_owner": map[string]string{"commitmentID": "c1", "buyerMSP": "Org2MSP", "buyerID": n.rival.ID()}})
+			},
+			client: buyer,
+			input:  deleteInput("c1"),
+			check: func(t *testing.T, n *testNetwork) {
+				require.Equal(t, n.rival.ID(), n.readCommitment("c1").Owner)
+				require.Nil(t, n.readDetails(n.buyer, "c1"))
+			},
+		},
+	})
+}
+
+func TestCreateYield(t *testing.T) {
+	setup := func(n *testNetwork) { n.createCommitment("c1") }
+	yieldInput := func(id string, commitmentID string, produced float64) transient {
+		return transient{"yield_properties": map[string]interface{}{"objectType": "yield", "yieldID": id, "commitmentID": commitmentID, "produced": produced}}
+	}
+
+	runTransactionCases(t, "CreateYield", setup, []transactionCase{
+		{
+			name:  "missing transient input",
+			input: transient{},
+			err:   "yield not found in the transient map input",
+		},
+		{
+			name:  "missing objectType",
+			input: transient{"yield_properties": map[string]interface{}{"yieldID": "y1", "commitmentID": "c1", "produced": 10}},
+			err:   "objectType field must be a non-empty string",
+		},
+		{
+			name:  "other objectType",
+			input: transient{"yield_properties": map[string]interface{}{"objectType": "harvest", "yieldID": "y1", "commitmentID": "c1", "produced": 10}},
+			err:   "objectType field must be yield",
+		},
+		{
+			name:  "missing yieldID",
+			input: yieldInput("", "c1", 10),
+			err:   "yieldID field must be a non-empty string",
+		},
+		{
+			name:  "missing commitmentID",
+			input: yieldInput("y1", "", 10),
+			err:   "commitmentID field must be a non-empty string",
+		},
+		{
+			name:  "nothing produced",
+			input: yieldInput("y1", "c1", 0),
+			err:   "produced field must be a positive number",
+		},
+		{
+			name:  "unknown commitment",
+			input: yieldInput("y1", "c2", 10),
+			err:   "c2 does not exist",
+		},
+		{
+			name:  "existing yield",
+			setup: func(n *testNetwork) { n.mustSubmit(n.producer, "CreateYield", yieldInput("y1", "c1", 10)) },
+			input: yieldInput("y1", "c1", 10),
+			err:   "this yield already exists: y1",
+		},
+		{
+			name:    "client of another org",
+			peerMSP: "Org2MSP",
+			input:   yieldInput("y1", "c1", 10),
+			err:     crossOrgError,
+		},
+		{
+			name:   "not the producer",
+			client: otherOrg1,
+			input:  yieldInput("y1", "c1", 10),
+			err:    "submitting client identity is not the producer of commitment c1",
+		},
+		{
+			name:  "partial delivery",
+			input: yieldInput("y1", "c1", 40),
+			check: func(t *testing.T, n *testNetwork) {
+				require.Equal(t, StatusDelivering, n.readCommitment("c1").Status)
+				require.Equal(t, events.YieldRecordedEvent, n.lastEvent())
+
+				err := n.evaluate(n.producer, func(ctx contractapi.TransactionContextInterface) error {
+					yield, err := n.contract.ReadProduced(ctx, "y1")
+					require.Equal(t, &Yield{Type: "yield", ID: "y1", CommitmentID: "c1", Produced: 40, Owner: n.producer.ID()}, yield)
+					return err
+				})
+				require.NoError(t, err)
+			},
+		},
+	})
+}
+
+func TestTransactionsRejectUnreadableTransientMap(t *testing.T) {
+	n := newTestNetwork(t)
+	for function, invoke := range transactions {
+		t.Run(function, func(t *testing.T) {
+			err := n.evaluate(n.producer, func(ctx contractapi.TransactionContextInterface) error {
+				return invoke(n.contract, &mockTransactionContext{
+					stub:           transientErrorStub{ctx.GetStub()},
+					clientIdentity: ctx.GetClientIdentity(),
+				})
+			})
+			require.Error(t, err)
+			require.Contains(t, err.Error(), "transient")
+		})
+	}
+}
+
+func TestClientIdentityHelpers(t *testing.T) {
+	cases := []struct {
+		name        string
+		identity    *mockClientIdentity
+		clientID    string
+		collection  string
+		clientIDErr string
+		mspIDErr    string
+		peerErr     string
+	}{
+		{
+			name:       "client of the peer org",
+			identity:   &mockClientIdentity{id: "x509::CN=producer", mspID: "Org1MSP"},
+			clientID:   "x509::CN=producer",
+			collection: "Org1MSPPrivateCollection",
+		},
+		{
+			name:       "client of another org",
+			identity:   &mockClientIdentity{id: "x509::CN=buyer", mspID: "Org2MSP"},
+			clientID:   "x509::CN=buyer",
+			collection: "Org2MSPPrivateCollection",
+			peerErr:    "client from org Org2MSP is not authorized to read or write private data from an org Org1MSP peer",
+		},
+		{
+			name:        "unreadable ID",
+			identity:    &mockClientIdentity{mspID: "Org1MSP", idErr: fmt.Errorf("no certificate")},
+			collection:  "Org1MSPPrivateCollection",
+			clientIDErr: "Failed to read clientID: no certificate",
+		},
+		{
+			name:        "ID that is not base64",
+			identity:    &mockClientIdentity{mspID: "Org1MSP", encoded: "%%%"},
+			collection:  "Org1MSPPrivateCollection",
+			clientIDErr: "failed to base64 decode clientID",
+		},
+		{
+			name:     "unreadable MSP ID",
+			identity: &mockClientIdentity{id: "x509::CN=producer", mspIDErr: fmt.Errorf("no MSP")},
+			clientID: "x509::CN=producer",
+			mspIDErr: "failed to get verified MSPID: no MSP",
+			peerErr:  "failed getting the client's MSPID: no MSP",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			n := newTestNetwork(t)
+			err := n.evaluate(n.producer, func(ctx contractapi.TransactionContextInterface) error {
+				mock := &mockTransactionContext{stub: ctx.GetStub(), clientIdentity: tc.identity}
+
+				clientID, err := n.contract.submittingClientIdentity(mock)
+				if tc.clientIDErr != "" {
+					require.Error(t, err)
+					require.Contains(t, err.Error(), tc.clientIDErr)
+				} else {
+					require.NoError(t, err)
+					require.Equal(t, tc.clientID, clientID)
+				}
+
+				collection, err := n.contract.getCollectionName(mock)
+				if tc.mspIDErr != "" {
+					require.EqualError(t, err, tc.mspIDErr)
+				} else {
+					require.NoError(t, err)
+					require.Equal(t, tc.collection, collection)
+				}
+
+				err = n.contract.verifyClientOrgMatchesPeerOrg(mock)
+				if tc.peerErr != "" {
+					require.EqualError(t, err, tc.peerErr)
+				} else {
+					require.NoError(t, err)
+				}
+				return nil
+			})
+			require.NoError(t, err)
+		})
+	}
+}
+
+// TestTwoOrgLifecycle runs a commitment through its whole life between Org1 and Org2
+func TestTwoOrgLifecycle(t *testing.T) {
+	n := newTestNetwork(t)
+
+	n.createCommitment("c1")
+	n.mustSubmit(n.rival, "AgreeToTransfer", transient{"commitment_value": with(termsInput("c1"), "rate", 2800)})
+	n.agree("c1", n.buyer)
+
+	// The rival's offer does not match the owner's terms
+	rivalTransfer := transient{"commitment_owner": map[string]string{"commitmentID": "c1", "buyerMSP": "Org2MSP", "buyerID": n.rival.ID()}}
+	require.Error(t, n.submit(n.producer, "TransferCommitment", rivalTransfer))
+
+	n.mustSubmit(n.producer, "TransferCommitment", transient{"commitment_owner": map[string]string{"commitmentID": "c1", "buyerMSP": "Org2MSP", "buyerID": n.buyer.ID()}})
+	commitment := n.readCommitment("c1")
+	require.Equal(t, n.buyer.ID(), commitment.Owner)
+	require.Equal(t, StatusTransferred, commitment.Status)
+
+	// The owner and buyer stored identical terms, which every peer can compare by hash
+	ownerTerms, err := canonicalTerms(&CommitmentPrivateDetails{ID: "c1", Rate: 3000, Quantity: 100, Currency: "USD", Salt: "a3c9e1"})
+	require.NoError(t, err)
+	err = n.evaluate(n.producer, func(ctx contractapi.TransactionContextInterface) error {
+		buyerKey, err := privateDetailsKey(ctx, "c1", n.buyer.ID())
+		require.NoError(t, err)
+		hash, err := ctx.GetStub().GetPrivateDataHash("Org2MSPPrivateCollection", buyerKey)
+		expected := sha256.Sum256(ownerTerms)
+		require.Equal(t, expected[:], hash)
+		return err
+	})
+	require.NoError(t, err)
+
+	// The rival withdraws the closed out offer
+	n.mustSubmit(n.rival, "DeleteTranferAgreement", transient{"agreement_delete": map[string]string{"commitmentID": "c1"}})
+	require.Nil(t, n.readDetails(n.rival, "c1"))
+
+	// The new owner puts the commitment up for resale
+	n.mustSubmit(n.buyer, "AgreeToSell", transient{"commitment_value": with(termsInput("c1"), "salt", "77aa")})
+
+	// The producer keeps reporting yields on the commitment it sold, a fulfilled commitment cannot be traded
+	n.mustSubmit(n.producer, "CreateYield", transient{"yield_properties": map[string]interface{}{"objectType": "yield", "yieldID": "y1", "commitmentID": "c1", "produced": 100}})
+	require.Equal(t, StatusFulfilled, n.readCommitment("c1").Status)
+	require.Error(t, n.submit(n.other, "AgreeToTransfer", transient{"commitment_value": with(termsInput("c1"), "salt", "77aa")}))
+
+	// Only the owner can delete the commitment
+	deleteInput := transient{"commitment_delete": map[string]string{"commitmentID": "c1"}}
+	require.Error(t, n.submit(n.producer, "DeleteCommitment", deleteInput))
+
+	var history []*AuditRecord
+	err = n.evaluate(n.producer, func(ctx contractapi.TransactionContextInterface) error {
+		var err error
+		history, err = n.contract.GetCommitmentHistory(ctx, "c1")
+		return err
+	})
+	require.NoError(t, err)
+	actions := []string{}
+	for _, record := range history {
+		actions = append(actions, record.Action)
+	}
+	require.Equal(t, []string{"CreateCommitment", "AgreeToTransfer", "AgreeToSell", "AgreeToTransfer", "TransferCommitment", "DeleteTranferAgreement", "AgreeToSell", "CreateYield"}, actions)
+
+	eventNames := []string{}
+	for _, event := range n.ledger.Events() {
+		eventNames = append(eventNames, event.Name)
+	}
+	require.Equal(t, []string{
+		events.CommitmentCreatedEvent,
+		events.OfferMadeEvent,
+		events.OfferMadeEvent,
+		events.CommitmentTransferredEvent,
+		events.AgreementWithdrawnEvent,
+		events.YieldRecordedEvent,
+	}, eventNames)
+
+	var payload events.CommitmentTransferred
+	for _, event := range n.ledger.Events() {
+		if event.Name == events.CommitmentTransferredEvent {
+			require.NoError(t, json.Unmarshal(event.Payload, &payload))
+		}
+	}
+	require.Equal(t, "Org1MSP", payload.SellerMSP)
+	require.Equal(t, "Org2MSP", payload.BuyerMSP)
+}
@@ -0,0 +1,175 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Every object is stored under a composite key prefixed with its object type, so that
+// objects of different types that share an ID cannot overwrite each other.
+const (
+	commitmentObjectType               = "commitment"
+	commitmentPrivateDetailsObjectType = "commitmentPrivateDetails"
+	yieldObjectType                    = "yield"
+	yieldPrivateDetailsObjectType      = "yieldPrivateDetails"
+	dataObjectType                     = "data"
+)
+
+// commitmentRangeIndexPrefix prefixes the simple keys that index commitment IDs in key order.
+// GetPrivateDataByRange does not accept composite keys, so paginated range queries seek
+// through this index to continue after the bookmark instead of iterating every commitment.
+const commitmentRangeIndexPrefix = "commitmentRange~"
+
+// commitmentRangeIndexKey is the simple key that indexes a commitment ID
+func commitmentRangeIndexKey(commitmentID string) string {
+	return commitmentRangeIndexPrefix + commitmentID
+}
+
+// putCommitmentRangeIndex indexes the ID of a commitment for paginated range queries. The
+// index entry holds no data, the commitment is read from its own key.
+func putCommitmentRangeIndex(ctx contractapi.TransactionContextInterface, commitmentID string) error {
+	err := ctx.GetStub().PutPrivateData(commitmentCollection, commitmentRangeIndexKey(commitmentID), []byte{0x00})
+	if err != nil {
+		return fmt.Errorf("failed to index commitment %v: %v", commitmentID, err)
+	}
+	return nil
+}
+
+// objectKey builds the composite key of an object
+func objectKey(ctx contractapi.TransactionContextInterface, objectType string, attributes ...string) (string, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(objectType, attributes)
+	if err != nil {
+		return "", fmt.Errorf("failed to create composite key: %v", err)
+	}
+	return key, nil
+}
+
+// privateDetailsKey is the key of the rate details held by an identity for a commitment in
+// its org collection. The owner's details and a buyer's agreed value are stored under their
+// own identities, so the buyer's entry becomes the new owner's details after a transfer.
+func privateDetailsKey(ctx contractapi.TransactionContextInterface, commitmentID string, identity string) (string, error) {
+	return objectKey(ctx, commitmentPrivateDetailsObjectType, commitmentID, identity)
+}
+
+// MigrateLegacyKeys rewrites objects stored under bare IDs, before typed keys were
+// introduced, to their composite keys. The collection must be one of the shared
+// collections or the caller's org collection. Entries in the org collection are
+// rewritten under the caller's identity, so each owner or buyer migrates their own
+// rate details. Range queries cannot be combined with writes on private data, so
+// the IDs to migrate are passed in explicitly.
+func (s *SmartContract) MigrateLegacyKeys(ctx contractapi.TransactionContextInterface, collection string, ids []string) error {
+
+	// Verify that the client is submitting request to peer in their organization
+	err := s.verifyClientOrgMatchesPeerOrg(ctx)
+	if err != nil {
+		return fmt.Errorf("MigrateLegacyKeys cannot be performed: Error %v", err)
+	}
+
+	orgCollection, err := s.getCollectionName(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to infer private collection name for the org: %v", err)
+	}
+
+	clientID, err := s.submittingClientIdentity(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		if len(id) == 0 {
+			return fmt.Errorf("IDs to migrate must be non-empty strings")
+		}
+
+		legacyJSON, err := ctx.GetStub().GetPrivateData(collection, id)
+		if err != nil {
+			return fmt.Errorf("failed to read %v from collection %v: %v", id, collection, err)
+		}
+		if legacyJSON == nil {
+			log.Printf("MigrateLegacyKeys: %v does not exist in collection %v", id, collection)
+			continue
+		}
+
+		var typedKey string
+		switch collection {
+		case commitmentCollection:
+			typedKey, err = objectKey(ctx, commitmentObjectType, id)
+		case yieldCollection:
+			typedKey, err = objectKey(ctx, yieldObjectType, id)
+		case dataCollection:
+			typedKey, err = objectKey(ctx, dataObjectType, id)
+		case orgCollection:
+			typedKey, err = legacyOrgObjectKey(ctx, legacyJSON, id, clientID)
+		default:
+			return fmt.Errorf("collection %v cannot be migrated by a client of this org", collection)
+		}
+		if err != nil {
+			return err
+		}
+
+		// Legacy reputation details are no longer kept in org collections
+		if typedKey == "" {
+			log.Printf("MigrateLegacyKeys Delete: collection %v, ID %v", collection, id)
+			err = ctx.GetStub().DelPrivateData(collection, id)
+			if err != nil {
+				return fmt.Errorf("failed to delete %v: %v", id, err)
+			}
+			continue
+		}
+
+		existing, err := ctx.GetStub().GetPrivateData(collection, typedKey)
+		if err != nil {
+			return fmt.Errorf("failed to read migrated key for %v: %v", id, err)
+		}
+		if existing != nil {
+			return fmt.Errorf("%v has already been migrated in collection %v", id, collection)
+		}
+
+		log.Printf("MigrateLegacyKeys Put: collection %v, ID %v", collection, id)
+		err = ctx.GetStub().PutPrivateData(collection, typedKey, legacyJSON)
+		if err != nil {
+			return fmt.Errorf("failed to put migrated %v: %v", id, err)
+		}
+		err = ctx.GetStub().DelPrivateData(collection, id)
+		if err != nil {
+			return fmt.Errorf("failed to delete %v: %v", id, err)
+		}
+
+		if collection == commitmentCollection {
+			err = putCommitmentRangeIndex(ctx, id)
+			if err != nil {
+				return err
+			}
+			err = s.recordAudit(ctx, id, legacyJSON)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// legacyOrgObjectKey infers the type of an object stored under a bare ID in an org
+// collection from its fields. An empty key is returned for objects that are dropped.
+func legacyOrgObjectKey(ctx contractapi.TransactionContextInterface, legacyJSON []byte, id string, clientID string) (string, error) {
+	var fields map[string]json.RawMessage
+	err := json.Unmarshal(legacyJSON, &fields)
+	if err != nil {
+		return "", fmt.Errorf("failed to unmarshal JSON of %v: %v", id, err)
+	}
+
+	// Yield details also carry a commitmentID, so they are recognised first
+	if _, ok := fields["Produced"]; ok {
+		return objectKey(ctx, yieldPrivateDetailsObjectType, id)
+	}
+	if _, ok := fields["commitmentID"]; ok {
+		return privateDetailsKey(ctx, id, clientID)
+	}
+	if _, ok := fields["Reputation"]; ok {
+		return "", nil
+	}
+	return "", fmt.Errorf("cannot determine the type of %v", id)
+}
@@ -0,0 +1,127 @@
+package chaincode
+
+import (
+	"testing"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/stretchr/testify/require"
+)
+
+// legacyEntries are objects written under bare IDs, before typed keys were introduced
+var legacyEntries = []struct {
+	collection string
+	id         string
+	value      string
+}{
+	{collection: commitmentCollection, id: "c1", value: `{"objectType":"commitment","commitmentID":"c1","owner":"producer"}`},
+	{collection: yieldCollection, id: "y1", value: `{"objectType":"yield","ID":"y1","commitmentID":"c1","Produced":40}`},
+	{collection: dataCollection, id: "d1", value: `{"objectType":"data","ID":"d1","Reputation":0.5}`},
+	{collection: "Org1MSPPrivateCollection", id: "c1", value: `{"commitmentID":"c1","rate":2500}`},
+	{collection: "Org1MSPPrivateCollection", id: "y1", value: `{"ID":"y1","commitmentID":"c1","Produced":40}`},
+	{collection: "Org1MSPPrivateCollection", id: "d1", value: `{"ID":"d1","Reputation":0.5}`},
+}
+
+// seedLegacyKeys writes the legacy entries to the ledger
+func (n *testNetwork) seedLegacyKeys() {
+	require.NoError(n.t, n.call(n.producer, "seed", func(ctx contractapi.TransactionContextInterface) error {
+		for _, entry := range legacyEntries {
+			err := ctx.GetStub().PutPrivateData(entry.collection, entry.id, []byte(entry.value))
+			require.NoError(n.t, err)
+		}
+		return nil
+	}))
+}
+
+// migrate runs MigrateLegacyKeys as the producer
+func (n *testNetwork) migrate(collection string, ids ...string) error {
+	return n.call(n.producer, "MigrateLegacyKeys", func(ctx contractapi.TransactionContextInterface) error {
+		return n.contract.MigrateLegacyKeys(ctx, collection, ids)
+	})
+}
+
+func TestMigrateLegacyKeys(t *testing.T) {
+	n := newTestNetwork(t)
+	n.seedLegacyKeys()
+
+	require.NoError(t, n.migrate(commitmentCollection, "c1"))
+	require.NoError(t, n.migrate(yieldCollection, "y1"))
+	require.NoError(t, n.migrate(dataCollection, "d1"))
+	require.NoError(t, n.migrate("Org1MSPPrivateCollection", "c1", "y1", "d1"))
+
+	err := n.evaluate(n.producer, func(ctx contractapi.TransactionContextInterface) error {
+		migrated := []struct {
+			collection string
+			key        string
+			value      string
+		}{
+			{commitmentCollection, mustKey(t, ctx, commitmentObjectType, "c1"), legacyEntries[0].value},
+			{yieldCollection, mustKey(t, ctx, yieldObjectType, "y1"), legacyEntries[1].value},
+			{dataCollection, mustKey(t, ctx, dataObjectType, "d1"), legacyEntries[2].value},
+			{"Org1MSPPrivateCollection", mustKey(t, ctx, commitmentPrivateDetailsObjectType, "c1", n.producer.ID()), legacyEntries[3].value},
+			{"Org1MSPPrivateCollection", mustKey(t, ctx, yieldPrivateDetailsObjectType, "y1"), legacyEntries[4].value},
+		}
+		for _, entry := range migrated {
+			require.Equal(t, entry.value, string(n.ledger.PrivateData(entry.collection, entry.key)), "%v %q", entry.collection, entry.key)
+		}
+		return nil
+	})
+	require.NoError(t, err)
+
+	// The bare IDs are deleted, legacy reputation details in the org collection are dropped
+	for _, entry := range legacyEntries {
+		require.Nil(t, n.ledger.PrivateData(entry.collection, entry.id), "%v/%v", entry.collection, entry.id)
+	}
+	require.Len(t, n.ledger.PrivateDataKeys("Org1MSPPrivateCollection"), 2)
+
+	// The migration of the commitment is part of its audit trail
+	var history []*AuditRecord
+	require.NoError(t, n.evaluate(n.producer, func(ctx contractapi.TransactionContextInterface) error {
+		var err error
+		history, err = n.contract.GetCommitmentHistory(ctx, "c1")
+		return err
+	}))
+	require.Len(t, history, 1)
+	require.Equal(t, "MigrateLegacyKeys", history[0].Action)
+}
+
+func TestMigrateLegacyKeysRerun(t *testing.T) {
+	n := newTestNetwork(t)
+	n.seedLegacyKeys()
+	require.NoError(t, n.migrate(commitmentCollection, "c1"))
+	require.NoError(t, n.migrate("Org1MSPPrivateCollection", "c1"))
+
+	commitmentKeys := n.ledger.PrivateDataKeys(commitmentCollection)
+	orgKeys := n.ledger.PrivateDataKeys("Org1MSPPrivateCollection")
+
+	// IDs that have been migrated no longer exist under their bare keys and are skipped
+	require.NoError(t, n.migrate(commitmentCollection, "c1"))
+	require.NoError(t, n.migrate("Org1MSPPrivateCollection", "c1"))
+	require.Equal(t, commitmentKeys, n.ledger.PrivateDataKeys(commitmentCollection))
+	require.Equal(t, orgKeys, n.ledger.PrivateDataKeys("Org1MSPPrivateCollection"))
+
+	// A bare key written again after the migration does not overwrite the migrated object
+	require.NoError(t, n.call(n.producer, "seed", func(ctx contractapi.TransactionContextInterface) error {
+		return ctx.GetStub().PutPrivateData(commitmentCollection, "c1", []byte(`{"objectType":"commitment","commitmentID":"c1","owner":"other"}`))
+	}))
+	err := n.migrate(commitmentCollection, "c1")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "c1 has already been migrated in collection commitmentCollection")
+}
+
+func TestMigrateLegacyKeysRejectsOtherCollections(t *testing.T) {
+	n := newTestNetwork(t)
+
+	err := n.migrate("Org2MSPPrivateCollection", "c1")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "failed to read c1 from collection Org2MSPPrivateCollection")
+
+	err = n.migrate(commitmentCollection, "")
+	require.EqualError(t, err, "IDs to migrate must be non-empty strings")
+}
+
+// mustKey returns the composite key of an object
+func mustKey(t *testing.T, ctx contractapi.TransactionContextInterface, objectType string, attributes ...string) string {
+	key, err := objectKey(ctx, objectType, attributes...)
+	require.NoError(t, err)
+	return key
+}
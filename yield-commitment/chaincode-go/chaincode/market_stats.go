@@ -0,0 +1,141 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// MarketSummary aggregates the commitments for one crop in one location. Only fields of the
+// commitmentCollection and the delivery totals of the yieldCollection are used, rates and other
+// terms held in org collections are never read.
+type MarketSummary struct {
+	Crop            string        `json:"crop"`
+	Location        string        `json:"location"`
+	Commitments     int           `json:"commitments"`
+	OpenCommitments int           `json:"openCommitments"` // commitments available to buyers, Open or Transferred
+	Production      *Distribution `json:"production"`
+	Size            *Distribution `json:"size"`
+	Delivered       *Distribution `json:"delivered"` // yield delivered per commitment
+}
+
+// Distribution summarizes a set of values. Percentiles use the nearest-rank method.
+type Distribution struct {
+	Sum    float64 `json:"sum"`
+	Min    float64 `json:"min"`
+	Max    float64 `json:"max"`
+	Mean   float64 `json:"mean"`
+	P25    float64 `json:"p25"`
+	Median float64 `json:"median"`
+	P75    float64 `json:"p75"`
+	P90    float64 `json:"p90"`
+}
+
+// newDistribution summarizes the values, which must not be empty
+func newDistribution(values []float64) *Distribution {
+	sorted := append([]float64{}, values...)
+	sort.Float64s(sorted)
+
+	distribution := &Distribution{
+		Min:    sorted[0],
+		Max:    sorted[len(sorted)-1],
+		P25:    percentile(sorted, 25),
+		Median: percentile(sorted, 50),
+		P75:    percentile(sorted, 75),
+		P90:    percentile(sorted, 90),
+	}
+	for _, value := range sorted {
+		distribution.Sum += value
+	}
+	distribution.Mean = distribution.Sum / float64(len(sorted))
+	return distribution
+}
+
+// percentile returns the nearest-rank percentile of the sorted values
+func percentile(sorted []float64, p float64) float64 {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// GetMarketStats returns market statistics per crop and location, restricted to the given crop
+// and location unless they are empty. Cancelled commitments are left out, as are lots, whose
+// production is counted through their member commitments.
+func (s *SmartContract) GetMarketStats(ctx contractapi.TransactionContextInterface, crop string, location string) ([]*MarketSummary, error) {
+
+	commitments := []*Commitment{}
+	lotIDs := map[string]bool{}
+	err := iterateRange(ctx, commitmentCollection, commitmentObjectType, "", "", func(value []byte) error {
+		var commitment *Commitment
+		err := json.Unmarshal(value, &commitment)
+		if err != nil {
+			return fmt.Errorf("failed to unmarshal JSON: %v", err)
+		}
+		if commitment.LotID != "" {
+			lotIDs[commitment.LotID] = true
+		}
+		commitments = append(commitments, commitment)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	type group struct {
+		summary    *MarketSummary
+		production []float64
+		size       []float64
+		delivered  []float64
+	}
+	groups := map[string]*group{}
+	summaries := []*MarketSummary{}
+
+	for _, commitment := range commitments {
+		if commitmentStatus(commitment) == StatusCancelled || lotIDs[commitment.ID] {
+			continue
+		}
+		if (crop != "" && commitment.Crop != crop) || (location != "" && commitment.Location != location) {
+			continue
+		}
+
+		record, err := readDeliveryRecord(ctx, commitment.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		groupKey := commitment.Crop + "\x00" + commitment.Location
+		g, ok := groups[groupKey]
+		if !ok {
+			g = &group{summary: &MarketSummary{Crop: commitment.Crop, Location: commitment.Location}}
+			groups[groupKey] = g
+			summaries = append(summaries, g.summary)
+		}
+
+		g.summary.Commitments++
+		if isTradeable(commitment) {
+			g.summary.OpenCommitments++
+		}
+		g.production = append(g.production, float64(commitment.Production))
+		g.size = append(g.size, float64(commitment.Size))
+		g.delivered = append(g.delivered, record.Delivered)
+	}
+
+	for _, g := range groups {
+		g.summary.Production = newDistribution(g.production)
+		g.summary.Size = newDistribution(g.size)
+		g.summary.Delivered = newDistribution(g.delivered)
+	}
+
+	sort.Slice(summaries, func(i, j int) bool {
+		if summaries[i].Crop != summaries[j].Crop {
+			return summaries[i].Crop < summaries[j].Crop
+		}
+		return summaries[i].Location < summaries[j].Location
+	})
+	return summaries, nil
+}
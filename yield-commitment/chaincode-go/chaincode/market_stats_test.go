@@ -0,0 +1,76 @@
+package chaincode
+
+import (
+	"testing"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/stretchr/testify/require"
+)
+
+// marketStats returns the market statistics for the crop and location as read by the buyer
+func (n *testNetwork) marketStats(crop string, location string) []*MarketSummary {
+	var summaries []*MarketSummary
+	err := n.evaluate(n.buyer, func(ctx contractapi.TransactionContextInterface) error {
+		var err error
+		summaries, err = n.contract.GetMarketStats(ctx, crop, location)
+		return err
+	})
+	require.NoError(n.t, err)
+	return summaries
+}
+
+// summaryGroups returns the crop, location, commitments and open commitments of each summary
+func summaryGroups(summaries []*MarketSummary) [][]interface{} {
+	groups := [][]interface{}{}
+	for _, summary := range summaries {
+		groups = append(groups, []interface{}{summary.Crop, summary.Location, summary.Commitments, summary.OpenCommitments})
+	}
+	return groups
+}
+
+func TestNewDistribution(t *testing.T) {
+	require.Equal(t, &Distribution{Sum: 7, Min: 7, Max: 7, Mean: 7, P25: 7, Median: 7, P75: 7, P90: 7}, newDistribution([]float64{7}))
+
+	values := []float64{10, 1, 9, 2, 8, 3, 7, 4, 6, 5}
+	require.Equal(t, &Distribution{Sum: 55, Min: 1, Max: 10, Mean: 5.5, P25: 3, Median: 5, P75: 8, P90: 9}, newDistribution(values))
+	require.Equal(t, 10.0, values[0], "the values are not sorted in place")
+}
+
+func TestGetMarketStats(t *testing.T) {
+	n := newQueryNetwork(t)
+
+	// The transferred commitment c4 is available to buyers, the delivering c1 is not
+	require.Equal(t, [][]interface{}{
+		{"corn", "Iowa", 2, 1},
+		{"corn", "Kansas", 1, 1},
+		{"wheat", "Kansas", 1, 1},
+	}, summaryGroups(n.marketStats("", "")))
+
+	iowa := n.marketStats("corn", "Iowa")
+	require.Len(t, iowa, 1)
+	require.Equal(t, &Distribution{Sum: 150, Min: 50, Max: 100, Mean: 75, P25: 50, Median: 50, P75: 100, P90: 100}, iowa[0].Production)
+	require.Equal(t, &Distribution{Sum: 60, Min: 20, Max: 40, Mean: 30, P25: 20, Median: 20, P75: 40, P90: 40}, iowa[0].Size)
+	require.Equal(t, 40.0, iowa[0].Delivered.Sum)
+	require.Equal(t, 40.0, iowa[0].Delivered.Max)
+
+	require.Equal(t, [][]interface{}{{"corn", "Iowa", 2, 1}, {"corn", "Kansas", 1, 1}}, summaryGroups(n.marketStats("corn", "")))
+	require.Equal(t, [][]interface{}{{"corn", "Kansas", 1, 1}, {"wheat", "Kansas", 1, 1}}, summaryGroups(n.marketStats("", "Kansas")))
+	require.Empty(t, n.marketStats("rice", ""))
+
+	// Offers take a commitment off the market, cancelled commitments are left out
+	n.mustSubmit(n.rival, "AgreeToTransfer", transient{"commitment_value": termsInput("c4")})
+	n.mustSubmit(n.producer, "DeleteCommitment", transient{"commitment_delete": map[string]string{"commitmentID": "c2"}})
+	require.Equal(t, [][]interface{}{
+		{"corn", "Iowa", 2, 1},
+		{"corn", "Kansas", 1, 0},
+	}, summaryGroups(n.marketStats("", "")))
+}
+
+func TestGetMarketStatsCountsLotMembers(t *testing.T) {
+	n := newTestNetwork(t)
+	n.pool()
+
+	summaries := n.marketStats("corn", "")
+	require.Equal(t, [][]interface{}{{"corn", "Iowa", 2, 0}}, summaryGroups(summaries))
+	require.Equal(t, 200.0, summaries[0].Production.Sum)
+}
@@ -0,0 +1,288 @@
+package chaincode
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/hyperledger/fabric-chaincode-go/pkg/cid"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/hyperledger/fabric-samples/yield-commitment/chaincode-go/simulator"
+	"github.com/stretchr/testify/require"
+)
+
+// mockClientIdentity is a client identity whose ID and MSP ID can be made to fail
+type mockClientIdentity struct {
+	id       string // raw identity, returned base64 encoded by GetID
+	mspID    string
+	encoded  string // returned as is by GetID when set, to simulate a malformed ID
+	idErr    error
+	mspIDErr error
+}
+
+func (m *mockClientIdentity) GetID() (string, error) {
+	if m.idErr != nil {
+		return "", m.idErr
+	}
+	if m.encoded != "" {
+		return m.encoded, nil
+	}
+	return base64.StdEncoding.EncodeToString([]byte(m.id)), nil
+}
+
+func (m *mockClientIdentity) GetMSPID() (string, error) {
+	if m.mspIDErr != nil {
+		return "", m.mspIDErr
+	}
+	return m.mspID, nil
+}
+
+func (m *mockClientIdentity) GetAttributeValue(attrName string) (string, bool, error) {
+	return "", false, nil
+}
+
+func (m *mockClientIdentity) AssertAttributeValue(attrName string, attrValue string) error {
+	return fmt.Errorf("attribute %v was not found", attrName)
+}
+
+func (m *mockClientIdentity) GetX509Certificate() (*x509.Certificate, error) {
+	return nil, fmt.Errorf("mock identity has no certificate")
+}
+
+// mockTransactionContext pairs a stub with a client identity
+type mockTransactionContext struct {
+	stub           shim.ChaincodeStubInterface
+	clientIdentity cid.ClientIdentity
+}
+
+func (m *mockTransactionContext) GetStub() shim.ChaincodeStubInterface {
+	return m.stub
+}
+
+func (m *mockTransactionContext) GetClientIdentity() cid.ClientIdentity {
+	return m.clientIdentity
+}
+
+// transientErrorStub is a stub whose transient map cannot be read
+type transientErrorStub struct {
+	shim.ChaincodeStubInterface
+}
+
+func (transientErrorStub) GetTransient() (map[string][]byte, error) {
+	return nil, fmt.Errorf("transient map is unavailable")
+}
+
+// transactions are the transactions that take their input from the transient map
+var transactions = map[string]func(*SmartContract, contractapi.TransactionContextInterface) error{
+	"CreateCommitment":       (*SmartContract).CreateCommitment,
+	"CreateYield":            (*SmartContract).CreateYield,
+	"AgreeToSell":            (*SmartContract).AgreeToSell,
+	"AgreeToTransfer":        (*SmartContract).AgreeToTransfer,
+	"TransferCommitment":     (*SmartContract).TransferCommitment,
+	"DeleteCommitment":       (*SmartContract).DeleteCommitment,
+	"DeleteTranferAgreement": (*SmartContract).DeleteTranferAgreement,
+	"SetCommitmentStatus":    (*SmartContract).SetCommitmentStatus,
+	"OpenAuction":            (*SmartContract).OpenAuction,
+	"SubmitBid":              (*SmartContract).SubmitBid,
+	"RevealBid":              (*SmartContract).RevealBid,
+	"SplitCommitment":        (*SmartContract).SplitCommitment,
+	"PoolCommitments":        (*SmartContract).PoolCommitments,
+}
+
+// transient is the transient map of a transaction. Values are marshaled to JSON, except byte
+// slices which are passed as is.
+type transient map[string]interface{}
+
+// testNetwork is a two org channel with a producer in Org1 and two buyers in Org2
+type testNetwork struct {
+	t        *testing.T
+	ledger   *simulator.Ledger
+	contract *SmartContract
+
+	producer *simulator.Client // Org1MSP
+	other    *simulator.Client // Org1MSP
+	buyer    *simulator.Client // Org2MSP
+	rival    *simulator.Client // Org2MSP
+}
+
+func newTestNetwork(t *testing.T) *testNetwork {
+	ledger, err := simulator.NewLedgerFromConfig("../collections_config.json")
+	require.NoError(t, err)
+
+	return &testNetwork{
+		t:        t,
+		ledger:   ledger,
+		contract: &SmartContract{Topology: simulator.NewTopology(DefaultTopology{})},
+		producer: simulator.NewClient("Org1MSP", "producer"),
+		other:    simulator.NewClient("Org1MSP", "other"),
+		buyer:    simulator.NewClient("Org2MSP", "buyer"),
+		rival:    simulator.NewClient("Org2MSP", "rival"),
+	}
+}
+
+// transaction starts a transaction of the client on a peer of its org
+func (n *testNetwork) transaction(client *simulator.Client, function string, input transient) *simulator.Transaction {
+	tx := n.ledger.NewTransaction(client, function)
+	for key, value := range input {
+		valueJSON, ok := value.([]byte)
+		if !ok {
+			var err error
+			valueJSON, err = json.Marshal(value)
+			require.NoError(n.t, err)
+		}
+		tx.WithTransient(key, valueJSON)
+	}
+	return tx
+}
+
+// submit runs a transaction of the client on a peer of its org and commits it if it succeeds
+func (n *testNetwork) submit(client *simulator.Client, function string, input transient) error {
+	return n.submitOnPeer(client, client.MSPID(), function, input)
+}
+
+// submitOnPeer runs a transaction of the client on a peer of the given org
+func (n *testNetwork) submitOnPeer(client *simulator.Client, peerMSP string, function string, input transient) error {
+	invoke, ok := transactions[function]
+	require.True(n.t, ok, "unknown transaction %v", function)
+
+	tx := n.transaction(client, function, input).OnPeer(peerMSP)
+	return n.ledger.Submit(tx, func(ctx contractapi.TransactionContextInterface) error {
+		return invoke(n.contract, ctx)
+	})
+}
+
+// call submits a transaction of the client that takes arguments, on a peer of its org
+func (n *testNetwork) call(client *simulator.Client, function string, invoke func(ctx contractapi.TransactionContextInterface) error) error {
+	tx := n.transaction(client, function, nil)
+	return n.ledger.Submit(tx, invoke)
+}
+
+// mustSubmit submits a transaction that is expected to succeed
+func (n *testNetwork) mustSubmit(client *simulator.Client, function string, input transient) {
+	require.NoError(n.t, n.submit(client, function, input), function)
+}
+
+// evaluate runs a query of the client on a peer of its org
+func (n *testNetwork) evaluate(client *simulator.Client, query func(ctx contractapi.TransactionContextInterface) error) error {
+	tx := n.ledger.NewTransaction(client, "query")
+	return n.ledger.Evaluate(tx, query)
+}
+
+// readCommitment returns the committed commitment as read by the producer
+func (n *testNetwork) readCommitment(id string) *Commitment {
+	var commitment *Commitment
+	err := n.evaluate(n.producer, func(ctx contractapi.TransactionContextInterface) error {
+		var err error
+		commitment, err = n.contract.ReadCommitment(ctx, id)
+		return err
+	})
+	require.NoError(n.t, err)
+	return commitment
+}
+
+// readDetails returns the private details held by the client in its org collection
+func (n *testNetwork) readDetails(client *simulator.Client, id string) *CommitmentPrivateDetails {
+	var details *CommitmentPrivateDetails
+	err := n.evaluate(client, func(ctx contractapi.TransactionContextInterface) error {
+		var err error
+		details, err = n.contract.ReadCommitmentPrivateDetails(ctx, client.MSPID()+"PrivateCollection", id)
+		return err
+	})
+	require.NoError(n.t, err)
+	return details
+}
+
+// readData returns the committed reputation record of a producer
+func (n *testNetwork) readData(producer *simulator.Client) *Data {
+	var data *Data
+	err := n.evaluate(n.producer, func(ctx contractapi.TransactionContextInterface) error {
+		var err error
+		data, err = n.contract.ReadData(ctx, producer.ID())
+		return err
+	})
+	require.NoError(n.t, err)
+	return data
+}
+
+// portfolio returns the portfolio of the client as read on a peer of its org
+func (n *testNetwork) portfolio(client *simulator.Client) *Portfolio {
+	var portfolio *Portfolio
+	err := n.evaluate(client, func(ctx contractapi.TransactionContextInterface) error {
+		var err error
+		portfolio, err = n.contract.GetMyPortfolio(ctx)
+		return err
+	})
+	require.NoError(n.t, err)
+	return portfolio
+}
+
+// lastEvent returns the name of the event of the last committed transaction that emitted one
+func (n *testNetwork) lastEvent() string {
+	events := n.ledger.Events()
+	require.NotEmpty(n.t, events)
+	return events[len(events)-1].Name
+}
+
+// lastEventPayload unmarshals the payload of the last committed event into payload
+func (n *testNetwork) lastEventPayload(payload interface{}) {
+	events := n.ledger.Events()
+	require.NotEmpty(n.t, events)
+	require.NoError(n.t, json.Unmarshal(events[len(events)-1].Payload, payload))
+}
+
+// createCommitment creates a commitment of 100 units of corn owned by the producer
+func (n *testNetwork) createCommitment(id string) {
+	n.mustSubmit(n.producer, "CreateCommitment", transient{"commitment_properties": commitmentInput(id)})
+}
+
+// agree sets salted terms as owner and makes a matching offer as buyer
+func (n *testNetwork) agree(id string, buyer *simulator.Client) {
+	n.mustSubmit(n.producer, "AgreeToSell", transient{"commitment_value": termsInput(id)})
+	n.mustSubmit(buyer, "AgreeToTransfer", transient{"commitment_value": termsInput(id)})
+}
+
+// recordYield reports a yield of the producer on a commitment
+func (n *testNetwork) recordYield(id string, commitmentID string, produced float64) {
+	n.mustSubmit(n.producer, "CreateYield", transient{"yield_properties": map[string]interface{}{"objectType": "yield", "yieldID": id, "commitmentID": commitmentID, "produced": produced}})
+}
+
+func commitmentInput(id string) map[string]interface{} {
+	return map[string]interface{}{
+		"objectType":   "commitment",
+		"commitmentID": id,
+		"location":     "Iowa",
+		"production":   100,
+		"size":         40,
+		"crop":         "corn",
+		"rate":         2500,
+		"currency":     "USD",
+		"salt":         "5e1f07",
+	}
+}
+
+func termsInput(id string) map[string]interface{} {
+	return map[string]interface{}{
+		"commitmentID": id,
+		"rate":         3000,
+		"quantity":     100,
+		"currency":     "USD",
+		"salt":         "a3c9e1",
+	}
+}
+
+// with returns a copy of the input with a field replaced, or removed if the value is nil
+func with(input map[string]interface{}, field string, value interface{}) map[string]interface{} {
+	copied := map[string]interface{}{}
+	for key, existing := range input {
+		copied[key] = existing
+	}
+	if value == nil {
+		delete(copied, field)
+	} else {
+		copied[field] = value
+	}
+	return copied
+}
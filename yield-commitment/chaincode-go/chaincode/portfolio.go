@@ -0,0 +1,152 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Portfolio lists the commitments owned by a client with their totals per crop
+type Portfolio struct {
+	Commitments []*PortfolioEntry `json:"commitments"`
+	Totals      []*CropTotal      `json:"totals"`
+}
+
+// PortfolioEntry is a commitment joined with the owner's terms from the org collection and the
+// pending offers on it. The terms of a commitment pooled in a lot bought by the caller are derived
+// from the terms of the lot. Rate, Quantity and Currency are empty if the caller's org collection
+// holds no terms for the commitment.
+type PortfolioEntry struct {
+	Commitment *Commitment          `json:"commitment"`
+	Rate       int                  `json:"rate"`
+	Quantity   int                  `json:"quantity"`
+	Currency   string               `json:"currency"`
+	Offers     []*TransferAgreement `json:"offers"`
+}
+
+// CropTotal sums the commitments of a portfolio for one crop
+type CropTotal struct {
+	Crop        string `json:"crop"`
+	Commitments int    `json:"commitments"`
+	Production  int    `json:"production"`
+	Size        int    `json:"size"`
+	Offers      int    `json:"offers"`
+}
+
+// GetMyPortfolio returns every commitment owned by the submitting client, with the rate held in
+// the client's org collection and the pending offers on each. Totals per crop leave out cancelled
+// commitments and commitments pooled in a lot, which are counted through the lot.
+// Commitments are found by iterating the commitment keys, so no rich query support is needed.
+func (s *SmartContract) GetMyPortfolio(ctx contractapi.TransactionContextInterface) (*Portfolio, error) {
+
+	// Verify that the client is reading private data from a peer in their organization
+	err := s.verifyClientOrgMatchesPeerOrg(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("GetMyPortfolio cannot be performed: Error %v", err)
+	}
+
+	clientID, err := s.submittingClientIdentity(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	orgCollection, err := s.getCollectionName(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to infer private collection name for the org: %v", err)
+	}
+
+	owned := []*Commitment{}
+	err = iterateRange(ctx, commitmentCollection, commitmentObjectType, "", "", func(value []byte) error {
+		var commitment *Commitment
+		err := json.Unmarshal(value, &commitment)
+		if err != nil {
+			return fmt.Errorf("failed to unmarshal JSON: %v", err)
+		}
+		if commitment.Owner == clientID {
+			owned = append(owned, commitment)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	portfolio := &Portfolio{
+		Commitments: []*PortfolioEntry{},
+		Totals:      []*CropTotal{},
+	}
+	totals := map[string]*CropTotal{}
+
+	for _, commitment := range owned {
+		entry := &PortfolioEntry{
+			Commitment: commitment,
+			Offers:     []*TransferAgreement{},
+		}
+
+		details, err := s.ReadCommitmentPrivateDetails(ctx, orgCollection, commitment.ID)
+		if err != nil {
+			return nil, err
+		}
+		if details == nil && commitment.LotID != "" {
+			details, err = s.lotMemberTerms(ctx, orgCollection, commitment)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if details != nil {
+			entry.Rate = details.Rate
+			entry.Quantity = details.Quantity
+			entry.Currency = details.Currency
+		}
+
+		if commitmentStatus(commitment) == StatusUnderAgreement {
+			entry.Offers, err = listOffers(ctx, commitment.ID)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		portfolio.Commitments = append(portfolio.Commitments, entry)
+
+		if commitmentStatus(commitment) == StatusCancelled || commitment.LotID != "" {
+			continue
+		}
+		total, ok := totals[commitment.Crop]
+		if !ok {
+			total = &CropTotal{Crop: commitment.Crop}
+			totals[commitment.Crop] = total
+			portfolio.Totals = append(portfolio.Totals, total)
+		}
+		total.Commitments++
+		total.Production += commitment.Production
+		total.Size += commitment.Size
+		total.Offers += len(entry.Offers)
+	}
+
+	sort.Slice(portfolio.Totals, func(i, j int) bool {
+		return portfolio.Totals[i].Crop < portfolio.Totals[j].Crop
+	})
+	return portfolio, nil
+}
+
+// lotMemberTerms derives the terms of a pooled commitment from the terms the org collection holds
+// for its lot, or returns nil if it holds none
+func (s *SmartContract) lotMemberTerms(ctx contractapi.TransactionContextInterface, orgCollection string, commitment *Commitment) (*CommitmentPrivateDetails, error) {
+	lot, err := readLot(ctx, commitment.LotID)
+	if err != nil {
+		return nil, err
+	}
+	if lot == nil {
+		return nil, nil
+	}
+	lotTerms, err := s.ReadCommitmentPrivateDetails(ctx, orgCollection, lot.ID)
+	if err != nil {
+		return nil, err
+	}
+	if lotTerms == nil {
+		return nil, nil
+	}
+	return memberTerms(lot, lotTerms, commitment.ID), nil
+}
@@ -0,0 +1,78 @@
+package chaincode
+
+import (
+	"testing"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/stretchr/testify/require"
+)
+
+func portfolioIDs(portfolio *Portfolio) []string {
+	ids := []string{}
+	for _, entry := range portfolio.Commitments {
+		ids = append(ids, entry.Commitment.ID)
+	}
+	return ids
+}
+
+func TestGetMyPortfolio(t *testing.T) {
+	n := newQueryNetwork(t)
+	n.mustSubmit(n.buyer, "AgreeToTransfer", transient{"commitment_value": with(termsInput("c2"), "quantity", 300)})
+	n.createCommitment("c5")
+	n.mustSubmit(n.producer, "DeleteCommitment", transient{"commitment_delete": map[string]string{"commitmentID": "c5"}})
+
+	t.Run("producer", func(t *testing.T) {
+		portfolio := n.portfolio(n.producer)
+		require.Equal(t, []string{"c1", "c2", "c5"}, portfolioIDs(portfolio))
+
+		c1, c2, c5 := portfolio.Commitments[0], portfolio.Commitments[1], portfolio.Commitments[2]
+		require.Equal(t, 2500, c1.Rate)
+		require.Equal(t, 100, c1.Quantity)
+		require.Equal(t, "USD", c1.Currency)
+		require.Empty(t, c1.Offers)
+
+		require.Equal(t, StatusUnderAgreement, c2.Commitment.Status)
+		require.Equal(t, []*TransferAgreement{{ID: "c2", BuyerID: n.buyer.ID(), BuyerMSP: "Org2MSP"}}, c2.Offers)
+
+		// The terms of a cancelled commitment are deleted with it
+		require.Equal(t, StatusCancelled, c5.Commitment.Status)
+		require.Zero(t, c5.Rate)
+
+		require.Equal(t, []*CropTotal{
+			{Crop: "corn", Commitments: 1, Production: 100, Size: 40},
+			{Crop: "wheat", Commitments: 1, Production: 300, Size: 120, Offers: 1},
+		}, portfolio.Totals)
+	})
+
+	t.Run("buyer", func(t *testing.T) {
+		portfolio := n.portfolio(n.buyer)
+		require.Equal(t, []string{"c4"}, portfolioIDs(portfolio))
+		require.Equal(t, 3000, portfolio.Commitments[0].Rate)
+		require.Equal(t, []*CropTotal{{Crop: "corn", Commitments: 1, Production: 100, Size: 40}}, portfolio.Totals)
+	})
+
+	t.Run("client without commitments", func(t *testing.T) {
+		portfolio := n.portfolio(n.rival)
+		require.Empty(t, portfolio.Commitments)
+		require.Empty(t, portfolio.Totals)
+	})
+
+	t.Run("peer of another org", func(t *testing.T) {
+		tx := n.ledger.NewTransaction(n.producer, "GetMyPortfolio").OnPeer("Org2MSP")
+		err := n.ledger.Evaluate(tx, func(ctx contractapi.TransactionContextInterface) error {
+			_, err := n.contract.GetMyPortfolio(ctx)
+			return err
+		})
+		require.Error(t, err)
+		require.Contains(t, err.Error(), crossOrgError)
+	})
+}
+
+func TestGetMyPortfolioCountsLotsOnce(t *testing.T) {
+	n := newTestNetwork(t)
+	n.pool()
+
+	portfolio := n.portfolio(n.producer)
+	require.Equal(t, []string{"c1", "c2", "l1"}, portfolioIDs(portfolio))
+	require.Equal(t, []*CropTotal{{Crop: "corn", Commitments: 1, Production: 200, Size: 80}}, portfolio.Totals)
+}
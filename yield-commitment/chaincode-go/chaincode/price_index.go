@@ -0,0 +1,236 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// marketCollection holds market data shared by every organization in anonymized form
+const marketCollection = "marketCollection"
+
+const (
+	priceIndexObjectType       = "priceIndex"
+	priceIndexEscrowObjectType = "priceIndexEscrow"
+)
+
+// minPriceIndexContributors is the number of transfers a price index needs before it is
+// published, so that no single contribution can be read from the index
+const minPriceIndexContributors = 5
+
+// priceBucketDigits is the number of significant digits unit prices are rounded down to before
+// they are stored, so that the market collection holds no price as it was agreed
+const priceBucketDigits = 2
+
+// PriceIndex summarizes the unit prices agreed in transfers of a crop in a season, in one currency.
+// Prices are rounded to buckets: Mean and Median are computed from the middle of the bucket of
+// each price, Min and Max are the bounds of the lowest and highest bucket.
+type PriceIndex struct {
+	Crop         string  `json:"crop"`
+	Season       string  `json:"season"`
+	Currency     string  `json:"currency"`
+	Contributors int     `json:"contributors"`
+	Mean         float64 `json:"mean"`
+	Median       float64 `json:"median"`
+	Min          float64 `json:"min"`
+	Max          float64 `json:"max"`
+}
+
+// priceBucket counts the unit prices in [Low, High)
+type priceBucket struct {
+	Low   float64 `json:"low"`
+	High  float64 `json:"high"`
+	Count int     `json:"count"`
+}
+
+// newPriceBucket returns the empty bucket of a unit price, whose bounds are the price rounded
+// down and up to priceBucketDigits significant digits
+func newPriceBucket(price float64) *priceBucket {
+	exponent := int(math.Floor(math.Log10(price))) - (priceBucketDigits - 1)
+	scale := math.Pow(10, math.Abs(float64(exponent)))
+	// The small offset keeps prices such as 0.3 out of the bucket below them
+	if exponent < 0 {
+		low := math.Floor(price*scale + 1e-9)
+		return &priceBucket{Low: low / scale, High: (low + 1) / scale}
+	}
+	low := math.Floor(price/scale + 1e-9)
+	return &priceBucket{Low: low * scale, High: (low + 1) * scale}
+}
+
+// priceHistogram is the stored form of a price index: counts of unit prices per bucket, sorted
+// by price, with nothing linking them to a commitment, an owner or a transaction. The published
+// index and the escrow of contributions that are not published yet are both stored in this form.
+type priceHistogram struct {
+	Crop     string         `json:"crop"`
+	Season   string         `json:"season"`
+	Currency string         `json:"currency"`
+	Buckets  []*priceBucket `json:"buckets"`
+}
+
+// contributors returns the number of prices counted by the histogram
+func (h *priceHistogram) contributors() int {
+	contributors := 0
+	for _, bucket := range h.Buckets {
+		contributors += bucket.Count
+	}
+	return contributors
+}
+
+// add merges the count of a bucket
+func (h *priceHistogram) add(bucket *priceBucket) {
+	for _, existing := range h.Buckets {
+		if existing.Low == bucket.Low {
+			existing.Count += bucket.Count
+			return
+		}
+	}
+	h.Buckets = append(h.Buckets, &priceBucket{Low: bucket.Low, High: bucket.High, Count: bucket.Count})
+	sort.Slice(h.Buckets, func(i, j int) bool {
+		return h.Buckets[i].Low < h.Buckets[j].Low
+	})
+}
+
+// readPriceHistogram returns the histogram stored under a key, or an empty one if there is none.
+// Records of earlier versions of the chaincode hold no buckets and are read as empty.
+func readPriceHistogram(ctx contractapi.TransactionContextInterface, key string, crop string, season string, currency string) (*priceHistogram, error) {
+	histogramJSON, err := ctx.GetStub().GetPrivateData(marketCollection, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read price index: %v", err)
+	}
+
+	histogram := &priceHistogram{}
+	if histogramJSON != nil {
+		err = json.Unmarshal(histogramJSON, histogram)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal JSON: %v", err)
+		}
+	}
+	// Only the buckets are kept from the stored record, which drops the prices and aggregates
+	// recorded by earlier versions
+	return &priceHistogram{Crop: crop, Season: season, Currency: currency, Buckets: histogram.Buckets}, nil
+}
+
+// putPriceHistogram stores a histogram under a key
+func putPriceHistogram(ctx contractapi.TransactionContextInterface, key string, histogram *priceHistogram) error {
+	histogramJSON, err := json.Marshal(histogram)
+	if err != nil {
+		return fmt.Errorf("failed to marshal price index: %v", err)
+	}
+
+	log.Printf("contributeToPriceIndex Put: collection %v, crop %v, season %v", marketCollection, histogram.Crop, histogram.Season)
+	err = ctx.GetStub().PutPrivateData(marketCollection, key, histogramJSON)
+	if err != nil {
+		return fmt.Errorf("failed to put price index: %v", err)
+	}
+	return nil
+}
+
+// contributeToPriceIndex adds the unit price agreed in a transfer to the index of the crop and
+// season. Only the bucket of the price is counted. Contributions are held in escrow until there
+// are minPriceIndexContributors of them, and are then published together, so that the published
+// index never changes by a single contribution that could be read from the difference.
+func contributeToPriceIndex(ctx contractapi.TransactionContextInterface, commitment *Commitment, terms *CommitmentPrivateDetails, season string) error {
+	quantity := terms.Quantity
+	if quantity == 0 {
+		quantity = commitment.Production
+	}
+	if quantity <= 0 || terms.Rate <= 0 || terms.Currency == "" {
+		return fmt.Errorf("terms of %v cannot be contributed to the price index", commitment.ID)
+	}
+
+	escrowKey, err := objectKey(ctx, priceIndexEscrowObjectType, commitment.Crop, season, terms.Currency)
+	if err != nil {
+		return err
+	}
+	escrow, err := readPriceHistogram(ctx, escrowKey, commitment.Crop, season, terms.Currency)
+	if err != nil {
+		return err
+	}
+
+	bucket := newPriceBucket(float64(terms.Rate) / float64(quantity))
+	bucket.Count = 1
+	escrow.add(bucket)
+	if escrow.contributors() < minPriceIndexContributors {
+		return putPriceHistogram(ctx, escrowKey, escrow)
+	}
+
+	indexKey, err := objectKey(ctx, priceIndexObjectType, commitment.Crop, season, terms.Currency)
+	if err != nil {
+		return err
+	}
+	index, err := readPriceHistogram(ctx, indexKey, commitment.Crop, season, terms.Currency)
+	if err != nil {
+		return err
+	}
+	for _, bucket := range escrow.Buckets {
+		index.add(bucket)
+	}
+
+	err = putPriceHistogram(ctx, indexKey, index)
+	if err != nil {
+		return err
+	}
+	err = ctx.GetStub().DelPrivateData(marketCollection, escrowKey)
+	if err != nil {
+		return fmt.Errorf("failed to delete price index escrow: %v", err)
+	}
+	return nil
+}
+
+// GetPriceIndex returns the price index of a crop in a season for each currency it was traded in.
+// Prices are per unit of production and rounded to buckets. Contributions still held in escrow
+// are not included.
+func (s *SmartContract) GetPriceIndex(ctx contractapi.TransactionContextInterface, crop string, season string) ([]*PriceIndex, error) {
+	if len(crop) == 0 || len(season) == 0 {
+		return nil, fmt.Errorf("crop and season must be non-empty strings")
+	}
+
+	resultsIterator, err := ctx.GetStub().GetPrivateDataByPartialCompositeKey(marketCollection, priceIndexObjectType, []string{crop, season})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	results := []*PriceIndex{}
+
+	for resultsIterator.HasNext() {
+		response, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var index priceHistogram
+		err = json.Unmarshal(response.Value, &index)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal JSON: %v", err)
+		}
+		// Indexes recorded by earlier versions of the chaincode hold no buckets
+		if len(index.Buckets) == 0 {
+			continue
+		}
+
+		midpoints := []float64{}
+		for _, bucket := range index.Buckets {
+			for i := 0; i < bucket.Count; i++ {
+				midpoints = append(midpoints, (bucket.Low+bucket.High)/2)
+			}
+		}
+		prices := newDistribution(midpoints)
+		results = append(results, &PriceIndex{
+			Crop:         index.Crop,
+			Season:       index.Season,
+			Currency:     index.Currency,
+			Contributors: len(midpoints),
+			Mean:         prices.Mean,
+			Median:       prices.Median,
+			Min:          index.Buckets[0].Low,
+			Max:          index.Buckets[len(index.Buckets)-1].High,
+		})
+	}
+
+	return results, nil
+}
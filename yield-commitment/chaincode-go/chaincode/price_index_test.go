@@ -0,0 +1,121 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/stretchr/testify/require"
+)
+
+// sellContributing sells a commitment of 100 units to the buyer at a rate, contributing the
+// price to the index of the 2021 season
+func (n *testNetwork) sellContributing(id string, rate int) {
+	n.createCommitment(id)
+	terms := with(termsInput(id), "rate", rate)
+	n.mustSubmit(n.producer, "AgreeToSell", transient{"commitment_value": terms})
+	n.mustSubmit(n.buyer, "AgreeToTransfer", transient{"commitment_value": terms})
+	n.mustSubmit(n.producer, "TransferCommitment", transient{"commitment_owner": map[string]interface{}{
+		"commitmentID":           id,
+		"buyerMSP":               n.buyer.MSPID(),
+		"buyerID":                n.buyer.ID(),
+		"contributeToPriceIndex": true,
+		"season":                 "2021",
+	}})
+}
+
+// priceIndex returns the published price index of corn in the 2021 season
+func (n *testNetwork) priceIndex() []*PriceIndex {
+	var index []*PriceIndex
+	err := n.evaluate(n.buyer, func(ctx contractapi.TransactionContextInterface) error {
+		var err error
+		index, err = n.contract.GetPriceIndex(ctx, "corn", "2021")
+		return err
+	})
+	require.NoError(n.t, err)
+	return index
+}
+
+// requireOnlyBuckets checks that the records of the market collection hold nothing but the
+// bucket counts of the prices
+func requireOnlyBuckets(t *testing.T, n *testNetwork) {
+	for _, key := range n.ledger.PrivateDataKeys(marketCollection) {
+		var record map[string]interface{}
+		require.NoError(t, json.Unmarshal(n.ledger.PrivateData(marketCollection, key), &record))
+		for field := range record {
+			require.Contains(t, []string{"crop", "season", "currency", "buckets"}, field, key)
+		}
+	}
+}
+
+func TestNewPriceBucket(t *testing.T) {
+	cases := []struct {
+		price float64
+		low   float64
+		high  float64
+	}{
+		{price: 20, low: 20, high: 21},
+		{price: 23.5, low: 23, high: 24},
+		{price: 9.99, low: 9.9, high: 10},
+		{price: 0.3, low: 0.3, high: 0.31},
+		{price: 0.0456, low: 0.045, high: 0.046},
+		{price: 1234, low: 1200, high: 1300},
+	}
+
+	for _, c := range cases {
+		bucket := newPriceBucket(c.price)
+		require.Equal(t, &priceBucket{Low: c.low, High: c.high}, bucket, "price %v", c.price)
+	}
+}
+
+func TestGetPriceIndex(t *testing.T) {
+	n := newTestNetwork(t)
+
+	err := n.evaluate(n.buyer, func(ctx contractapi.TransactionContextInterface) error {
+		_, err := n.contract.GetPriceIndex(ctx, "corn", "")
+		return err
+	})
+	require.EqualError(t, err, "crop and season must be non-empty strings")
+
+	// A single contribution is held in escrow, rounded to its bucket
+	escrowKey := "\x00" + priceIndexEscrowObjectType + "\x00corn\x002021\x00USD\x00"
+	n.sellContributing("c1", 2350)
+	require.Empty(t, n.priceIndex())
+	require.NotNil(t, n.ledger.PrivateData(marketCollection, escrowKey))
+	require.NotContains(t, string(n.ledger.PrivateData(marketCollection, escrowKey)), "23.5")
+	requireOnlyBuckets(t, n)
+
+	// So are contributions below the threshold
+	n.sellContributing("c2", 3000)
+	n.sellContributing("c3", 4000)
+	n.sellContributing("c4", 2000)
+	require.Empty(t, n.priceIndex())
+
+	// The batch is published once it reaches the threshold
+	n.sellContributing("c5", 4010)
+	require.Equal(t, []*PriceIndex{{Crop: "corn", Season: "2021", Currency: "USD", Contributors: 5, Mean: 31.1, Median: 30.5, Min: 20, Max: 41}}, n.priceIndex())
+	requireOnlyBuckets(t, n)
+
+	// The escrow is emptied with the batch
+	require.Nil(t, n.ledger.PrivateData(marketCollection, escrowKey))
+}
+
+func TestGetPriceIndexPublishesInBatches(t *testing.T) {
+	n := newTestNetwork(t)
+	for i, rate := range []int{2000, 3000, 4000, 2000, 3000} {
+		n.sellContributing(fmt.Sprintf("c%v", i+1), rate)
+	}
+	published := n.priceIndex()
+	require.Len(t, published, 1)
+
+	// Contributions after publication do not change the published index until the next batch
+	for i, rate := range []int{10000, 1000, 4000, 3000} {
+		n.sellContributing(fmt.Sprintf("c%v", i+6), rate)
+		require.Equal(t, published, n.priceIndex())
+	}
+
+	n.sellContributing("c10", 3000)
+	require.Equal(t, []*PriceIndex{{Crop: "corn", Season: "2021", Currency: "USD", Contributors: 10, Mean: 35.95, Median: 30.5, Min: 10, Max: 110}}, n.priceIndex())
+	requireOnlyBuckets(t, n)
+}
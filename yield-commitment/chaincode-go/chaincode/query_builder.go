@@ -0,0 +1,470 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// CommitmentFilter describes the commitments to return from QueryCommitmentsByFilter. Empty
+// strings and zero bounds are not applied. Only commitments are returned, so ObjectType can
+// only be empty or commitment.
+type CommitmentFilter struct {
+	ObjectType    string `json:"objectType,omitempty"`
+	Crop          string `json:"crop,omitempty"`
+	Location      string `json:"location,omitempty"`
+	Owner         string `json:"owner,omitempty"`
+	Status        string `json:"status,omitempty"`
+	MinProduction int    `json:"minProduction,omitempty"`
+	MaxProduction int    `json:"maxProduction,omitempty"`
+	MinSize       int    `json:"minSize,omitempty"`
+	MaxSize       int    `json:"maxSize,omitempty"`
+}
+
+// buildCommitmentSelector returns the CouchDB query for the filter. The query is built as a
+// JSON document rather than by formatting strings, so filter values cannot change its structure.
+func buildCommitmentSelector(filter CommitmentFilter) (string, error) {
+	if filter.ObjectType != "" && filter.ObjectType != commitmentObjectType {
+		return "", fmt.Errorf("objectType must be %v", commitmentObjectType)
+	}
+
+	// Lot records and other objects of the collection share fields with commitments
+	selector := map[string]interface{}{"objectType": commitmentObjectType}
+
+	equals := map[string]string{
+		"crop":     filter.Crop,
+		"location": filter.Location,
+		"owner":    filter.Owner,
+		"status":   filter.Status,
+	}
+	for field, value := range equals {
+		if value != "" {
+			selector[field] = value
+		}
+	}
+
+	err := addRange(selector, "production", filter.MinProduction, filter.MaxProduction)
+	if err != nil {
+		return "", err
+	}
+	err = addRange(selector, "size", filter.MinSize, filter.MaxSize)
+	if err != nil {
+		return "", err
+	}
+
+	return buildSelector(commitmentCollection, selector)
+}
+
+// yieldByOwnerQuery returns the CouchDB query for the yields reported by a producer
+func yieldByOwnerQuery(owner string) (string, error) {
+	return buildSelector(yieldCollection, map[string]interface{}{"objectType": yieldObjectType, "owner": owner})
+}
+
+// dataByOwnerQuery returns the CouchDB query for the reputation record of a producer
+func dataByOwnerQuery(owner string) (string, error) {
+	return buildSelector(dataCollection, map[string]interface{}{"objectType": dataObjectType, "owner": owner})
+}
+
+// buildSelector returns the CouchDB query for a selector on a collection, with a use_index hint
+// for the index the query is planned on. encoding/json escapes the values and sorts the map keys,
+// so equal selectors produce equal queries.
+func buildSelector(collection string, selector map[string]interface{}) (string, error) {
+	query := map[string]interface{}{"selector": selector}
+	if index := planQuery(collection, selector); index != nil {
+		query["use_index"] = []string{"_design/" + index.DesignDoc, index.Name}
+	}
+
+	queryJSON, err := json.Marshal(query)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal query: %v", err)
+	}
+	return string(queryJSON), nil
+}
+
+// pinQueryToType restricts an ad hoc query to the records of an object type, so that it cannot
+// match the lots, offers, audit records and other objects that share the collection. The
+// selector of the query is combined with the object type under $and, and unless the query
+// names an index, a use_index hint is added for the index planned on the object type and the
+// top level fields of the selector. The query must have been checked by validateQueryString.
+func pinQueryToType(queryString string, collection string, objectType string) (string, error) {
+	var query map[string]json.RawMessage
+	err := json.Unmarshal([]byte(queryString), &query)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse query string: %v", err)
+	}
+	var selector map[string]json.RawMessage
+	err = json.Unmarshal(query["selector"], &selector)
+	if err != nil {
+		return "", fmt.Errorf("selector must be a JSON object: %v", err)
+	}
+
+	pinned := map[string]interface{}{
+		"$and": []interface{}{map[string]string{"objectType": objectType}, selector},
+	}
+	pinnedJSON, err := json.Marshal(pinned)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal selector: %v", err)
+	}
+	query["selector"] = pinnedJSON
+
+	if _, ok := query["use_index"]; !ok {
+		fields := map[string]interface{}{"objectType": objectType}
+		for field, condition := range selector {
+			fields[field] = condition
+		}
+		if index := planQuery(collection, fields); index != nil {
+			indexJSON, err := json.Marshal([]string{"_design/" + index.DesignDoc, index.Name})
+			if err != nil {
+				return "", fmt.Errorf("failed to marshal index: %v", err)
+			}
+			query["use_index"] = indexJSON
+		}
+	}
+
+	queryJSON, err := json.Marshal(query)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal query: %v", err)
+	}
+	return string(queryJSON), nil
+}
+
+// queryIndex is a CouchDB index packaged with the chaincode under
+// META-INF/statedb/couchdb/collections/<collection>/indexes
+type queryIndex struct {
+	DesignDoc string
+	Name      string
+	Fields    []string
+}
+
+// collectionIndexes lists the indexes of each collection, most selective first. The
+// definitions in META-INF must be kept in step, which is checked by query_index_test.go.
+// marketCollection and the org collections have no indexes: they are only read by key and by
+// partial composite key, which CouchDB serves from the primary index on the document ID.
+var collectionIndexes = map[string][]queryIndex{
+	commitmentCollection: {
+		{DesignDoc: "indexOwnerDoc", Name: "indexOwner", Fields: []string{"objectType", "owner"}},
+		{DesignDoc: "indexStatusDoc", Name: "indexStatus", Fields: []string{"objectType", "status"}},
+		{DesignDoc: "indexCropDoc", Name: "indexCrop", Fields: []string{"objectType", "crop"}},
+		{DesignDoc: "indexLocationDoc", Name: "indexLocation", Fields: []string{"objectType", "location"}},
+		{DesignDoc: "indexDeliveryDeadlineDoc", Name: "indexDeliveryDeadline", Fields: []string{"objectType", "deliveryDeadline"}},
+	},
+	yieldCollection: {
+		{DesignDoc: "indexOwnerDoc", Name: "indexOwner", Fields: []string{"objectType", "owner"}},
+		{DesignDoc: "indexCommitmentDoc", Name: "indexCommitment", Fields: []string{"objectType", "commitmentID"}},
+	},
+	dataCollection: {
+		{DesignDoc: "indexOwnerDoc", Name: "indexOwner", Fields: []string{"objectType", "owner"}},
+	},
+}
+
+// planQuery returns the first index of the collection whose fields all appear in the selector,
+// or nil if none does. CouchDB only uses a JSON index when the selector covers every indexed field.
+func planQuery(collection string, selector map[string]interface{}) *queryIndex {
+	for i, index := range collectionIndexes[collection] {
+		covered := true
+		for _, field := range index.Fields {
+			if _, ok := selector[field]; !ok {
+				covered = false
+				break
+			}
+		}
+		if covered {
+			return &collectionIndexes[collection][i]
+		}
+	}
+	return nil
+}
+
+// addRange adds an inclusive range condition on a numeric field to the selector
+func addRange(selector map[string]interface{}, field string, min int, max int) error {
+	if min < 0 || max < 0 {
+		return fmt.Errorf("%v bounds must not be negative", field)
+	}
+	if max != 0 && min > max {
+		return fmt.Errorf("minimum %v %v is greater than maximum %v", field, min, max)
+	}
+
+	condition := map[string]int{}
+	if min != 0 {
+		condition["$gte"] = min
+	}
+	if max != 0 {
+		condition["$lte"] = max
+	}
+	if len(condition) != 0 {
+		selector[field] = condition
+	}
+	return nil
+}
+
+// Ad hoc queries are restricted to the fields of the record being queried and to
+// operators that the state database can evaluate cheaply.
+var (
+	allowedQueryOptions = map[string]bool{
+		"selector":  true,
+		"sort":      true,
+		"fields":    true,
+		"limit":     true,
+		"skip":      true,
+		"use_index": true,
+	}
+	commitmentQueryFields = map[string]bool{
+		"objectType":       true,
+		"commitmentID":     true,
+		"location":         true,
+		"production":       true,
+		"crop":             true,
+		"size":             true,
+		"owner":            true,
+		"producer":         true,
+		"deliveryDeadline": true,
+		"status":           true,
+		"parentID":         true,
+		"lotID":            true,
+	}
+	yieldQueryFields = map[string]bool{
+		"objectType":   true,
+		"ID":           true,
+		"commitmentID": true,
+		"Produced":     true,
+		"owner":        true,
+	}
+	dataQueryFields = map[string]bool{
+		"objectType":        true,
+		"ID":                true,
+		"owner":             true,
+		"Reputation":        true,
+		"committed":         true,
+		"delivered":         true,
+		"closedCommitments": true,
+		"onTime":            true,
+		"late":              true,
+		"defaults":          true,
+	}
+	allowedConditionOperators = map[string]bool{
+		"$eq":     true,
+		"$ne":     true,
+		"$gt":     true,
+		"$gte":    true,
+		"$lt":     true,
+		"$lte":    true,
+		"$in":     true,
+		"$nin":    true,
+		"$exists": true,
+	}
+	allowedCombinationOperators = map[string]bool{
+		"$and": true,
+		"$or":  true,
+		"$nor": true,
+		"$not": true,
+	}
+)
+
+// validateQueryString checks an ad hoc query against the allow-lists of query options
+// and operators, and against the fields allowed for the record being queried.
+func validateQueryString(queryString string, allowedFields map[string]bool) error {
+	var query map[string]json.RawMessage
+	err := json.Unmarshal([]byte(queryString), &query)
+	if err != nil {
+		return fmt.Errorf("failed to parse query string: %v", err)
+	}
+
+	for option := range query {
+		if !allowedQueryOptions[option] {
+			return fmt.Errorf("query option %v is not allowed", option)
+		}
+	}
+
+	selectorJSON, ok := query["selector"]
+	if !ok {
+		return fmt.Errorf("query must have a selector")
+	}
+	var selector map[string]json.RawMessage
+	err = json.Unmarshal(selectorJSON, &selector)
+	if err != nil {
+		return fmt.Errorf("selector must be a JSON object: %v", err)
+	}
+	err = validateSelector(selector, allowedFields)
+	if err != nil {
+		return err
+	}
+
+	if fieldsJSON, ok := query["fields"]; ok {
+		var fields []string
+		err = json.Unmarshal(fieldsJSON, &fields)
+		if err != nil {
+			return fmt.Errorf("fields must be an array of field names: %v", err)
+		}
+		for _, field := range fields {
+			if !allowedFields[field] {
+				return fmt.Errorf("field %v is not allowed", field)
+			}
+		}
+	}
+
+	if sortJSON, ok := query["sort"]; ok {
+		err = validateSort(sortJSON, allowedFields)
+		if err != nil {
+			return err
+		}
+	}
+
+	if indexJSON, ok := query["use_index"]; ok {
+		var designDoc string
+		var index []string
+		if json.Unmarshal(indexJSON, &designDoc) != nil && json.Unmarshal(indexJSON, &index) != nil {
+			return fmt.Errorf("use_index must be a design document name or a design document and index name")
+		}
+	}
+
+	for _, option := range []string{"limit", "skip"} {
+		if valueJSON, ok := query[option]; ok {
+			var value uint
+			err = json.Unmarshal(valueJSON, &value)
+			if err != nil {
+				return fmt.Errorf("%v must be a non-negative integer", option)
+			}
+		}
+	}
+	return nil
+}
+
+// validateSelector checks the fields and operators of a selector and of the selectors nested in it
+func validateSelector(selector map[string]json.RawMessage, allowedFields map[string]bool) error {
+	if selector == nil {
+		return fmt.Errorf("selector must be a JSON object, not null")
+	}
+	for key, valueJSON := range selector {
+		if strings.HasPrefix(key, "$") {
+			if !allowedCombinationOperators[key] {
+				return fmt.Errorf("operator %v is not allowed", key)
+			}
+			err := validateCombination(key, valueJSON, allowedFields)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		if !allowedFields[key] {
+			return fmt.Errorf("field %v is not allowed", key)
+		}
+		err := validateCondition(key, valueJSON)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateCombination checks the selectors combined by $and, $or, $nor or $not
+func validateCombination(operator string, valueJSON json.RawMessage, allowedFields map[string]bool) error {
+	if operator == "$not" {
+		var selector map[string]json.RawMessage
+		err := json.Unmarshal(valueJSON, &selector)
+		if err != nil {
+			return fmt.Errorf("%v must be applied to a selector: %v", operator, err)
+		}
+		return validateSelector(selector, allowedFields)
+	}
+
+	var selectors []map[string]json.RawMessage
+	err := json.Unmarshal(valueJSON, &selectors)
+	if err != nil {
+		return fmt.Errorf("%v must be applied to an array of selectors: %v", operator, err)
+	}
+	for _, selector := range selectors {
+		err = validateSelector(selector, allowedFields)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateCondition checks the condition on a field, either a value to match or an object of
+// condition operators whose arguments are values
+func validateCondition(field string, valueJSON json.RawMessage) error {
+	var condition map[string]json.RawMessage
+	if json.Unmarshal(valueJSON, &condition) != nil {
+		// An implicit $eq on a value, objects and arrays are rejected below
+		return validateValue(field, valueJSON)
+	}
+
+	for operator, argumentJSON := range condition {
+		if !allowedConditionOperators[operator] {
+			return fmt.Errorf("operator %v on field %v is not allowed", operator, field)
+		}
+
+		if operator == "$in" || operator == "$nin" {
+			var arguments []json.RawMessage
+			err := json.Unmarshal(argumentJSON, &arguments)
+			if err != nil {
+				return fmt.Errorf("%v on field %v must be applied to an array: %v", operator, field, err)
+			}
+			for _, argument := range arguments {
+				err = validateValue(field, argument)
+				if err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		err := validateValue(field, argumentJSON)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateValue checks that a condition argument is a string, number, boolean or null
+func validateValue(field string, valueJSON json.RawMessage) error {
+	var value interface{}
+	err := json.Unmarshal(valueJSON, &value)
+	if err != nil {
+		return fmt.Errorf("invalid value for field %v: %v", field, err)
+	}
+
+	switch value.(type) {
+	case string, float64, bool, nil:
+		return nil
+	default:
+		return fmt.Errorf("value for field %v must be a string, number, boolean or null", field)
+	}
+}
+
+// validateSort checks that the query is sorted on allowed fields
+func validateSort(sortJSON json.RawMessage, allowedFields map[string]bool) error {
+	var sort []json.RawMessage
+	err := json.Unmarshal(sortJSON, &sort)
+	if err != nil {
+		return fmt.Errorf("sort must be an array: %v", err)
+	}
+
+	for _, entryJSON := range sort {
+		var field string
+		if json.Unmarshal(entryJSON, &field) == nil {
+			if !allowedFields[field] {
+				return fmt.Errorf("sort on field %v is not allowed", field)
+			}
+			continue
+		}
+
+		var entry map[string]string
+		err = json.Unmarshal(entryJSON, &entry)
+		if err != nil || len(entry) != 1 {
+			return fmt.Errorf("sort entries must be a field name or a single field and direction")
+		}
+		for field, direction := range entry {
+			if !allowedFields[field] {
+				return fmt.Errorf("sort on field %v is not allowed", field)
+			}
+			if direction != "asc" && direction != "desc" {
+				return fmt.Errorf("sort direction %v is not allowed", direction)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,241 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// indexDefinition is the CouchDB index definition format read by the peer from META-INF
+type indexDefinition struct {
+	Index struct {
+		Fields []string `json:"fields"`
+	} `json:"index"`
+	DesignDoc string `json:"ddoc"`
+	Name      string `json:"name"`
+	Type      string `json:"type"`
+}
+
+func readIndexDefinitions(t *testing.T, collection string) map[string]indexDefinition {
+	dir := filepath.Join("..", "META-INF", "statedb", "couchdb", "collections", collection, "indexes")
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("failed to read indexes of %v: %v", collection, err)
+	}
+
+	definitions := map[string]indexDefinition{}
+	for _, file := range files {
+		definitionJSON, err := ioutil.ReadFile(filepath.Join(dir, file.Name()))
+		if err != nil {
+			t.Fatalf("failed to read %v: %v", file.Name(), err)
+		}
+		var definition indexDefinition
+		err = json.Unmarshal(definitionJSON, &definition)
+		if err != nil {
+			t.Fatalf("invalid index definition %v: %v", file.Name(), err)
+		}
+		if definition.Type != "json" {
+			t.Errorf("index %v of %v has type %q, want json", file.Name(), collection, definition.Type)
+		}
+		if strings.TrimSuffix(file.Name(), ".json") != definition.Name {
+			t.Errorf("index file %v of %v defines index %v", file.Name(), collection, definition.Name)
+		}
+		definitions[definition.Name] = definition
+	}
+	return definitions
+}
+
+func TestIndexDefinitionsMatchPlanner(t *testing.T) {
+	for collection, indexes := range collectionIndexes {
+		definitions := readIndexDefinitions(t, collection)
+		if len(definitions) != len(indexes) {
+			t.Errorf("%v has %v index definitions, the planner knows %v", collection, len(definitions), len(indexes))
+		}
+
+		for _, index := range indexes {
+			definition, ok := definitions[index.Name]
+			if !ok {
+				t.Errorf("index %v of %v has no definition", index.Name, collection)
+				continue
+			}
+			if definition.DesignDoc != index.DesignDoc {
+				t.Errorf("index %v of %v is in design document %v, the planner uses %v", index.Name, collection, definition.DesignDoc, index.DesignDoc)
+			}
+			if !reflect.DeepEqual(definition.Index.Fields, index.Fields) {
+				t.Errorf("index %v of %v covers %v, the planner expects %v", index.Name, collection, definition.Index.Fields, index.Fields)
+			}
+		}
+	}
+}
+
+// TestRichQueriesUseIndexedCollections checks that the chaincode only runs rich queries on
+// collections that ship indexes. Reads by key and by partial composite key need none.
+func TestRichQueriesUseIndexedCollections(t *testing.T) {
+	collections := map[string]string{
+		"commitmentCollection": commitmentCollection,
+		"yieldCollection":      yieldCollection,
+		"dataCollection":       dataCollection,
+		"marketCollection":     marketCollection,
+	}
+	richQuery := regexp.MustCompile(`GetPrivateDataQueryResult(?:WithPagination)?\(\s*(\w+)`)
+
+	files, err := filepath.Glob("*.go")
+	if err != nil {
+		t.Fatalf("failed to list sources: %v", err)
+	}
+	queries := 0
+	for _, file := range files {
+		if strings.HasSuffix(file, "_test.go") {
+			continue
+		}
+		source, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatalf("failed to read %v: %v", file, err)
+		}
+		for _, match := range richQuery.FindAllStringSubmatch(string(source), -1) {
+			queries++
+			collection, ok := collections[match[1]]
+			if !ok {
+				t.Errorf("%v runs a rich query on %v, which is not a shared collection", file, match[1])
+				continue
+			}
+			if len(collectionIndexes[collection]) == 0 {
+				t.Errorf("%v runs a rich query on %v, which has no indexes", file, collection)
+			}
+		}
+	}
+	if queries == 0 {
+		t.Error("found no rich queries")
+	}
+}
+
+func TestParameterizedQueriesHaveIndexes(t *testing.T) {
+	queries := []struct {
+		name       string
+		collection string
+		build      func() (string, error)
+	}{
+		{"QueryCommitmentByOwner", commitmentCollection, func() (string, error) {
+			return buildCommitmentSelector(CommitmentFilter{ObjectType: "commitment", Owner: "owner1"})
+		}},
+		{"QueryCommitmentsByFilter status", commitmentCollection, func() (string, error) {
+			return buildCommitmentSelector(CommitmentFilter{ObjectType: "commitment", Status: StatusOpen, MinProduction: 10})
+		}},
+		{"QueryCommitmentsByFilter crop", commitmentCollection, func() (string, error) {
+			return buildCommitmentSelector(CommitmentFilter{ObjectType: "commitment", Crop: "wheat"})
+		}},
+		{"QueryCommitmentsByFilter location", commitmentCollection, func() (string, error) {
+			return buildCommitmentSelector(CommitmentFilter{ObjectType: "commitment", Location: "north"})
+		}},
+		{"QueryYieldByOwner", yieldCollection, func() (string, error) {
+			return yieldByOwnerQuery("owner1")
+		}},
+		{"QueryDataByOwner", dataCollection, func() (string, error) {
+			return dataByOwnerQuery("owner1")
+		}},
+	}
+
+	for _, query := range queries {
+		t.Run(query.name, func(t *testing.T) {
+			queryString, err := query.build()
+			if err != nil {
+				t.Fatalf("failed to build query: %v", err)
+			}
+
+			var parsed struct {
+				Selector map[string]interface{} `json:"selector"`
+				UseIndex []string               `json:"use_index"`
+			}
+			err = json.Unmarshal([]byte(queryString), &parsed)
+			if err != nil {
+				t.Fatalf("query %v is not valid JSON: %v", queryString, err)
+			}
+			if len(parsed.UseIndex) != 2 {
+				t.Fatalf("query %v has no use_index hint", queryString)
+			}
+
+			definitions := readIndexDefinitions(t, query.collection)
+			definition, ok := definitions[parsed.UseIndex[1]]
+			if !ok {
+				t.Fatalf("query %v uses index %v, which is not defined for %v", queryString, parsed.UseIndex[1], query.collection)
+			}
+			if parsed.UseIndex[0] != "_design/"+definition.DesignDoc {
+				t.Errorf("query %v uses design document %v, index %v is in %v", queryString, parsed.UseIndex[0], definition.Name, definition.DesignDoc)
+			}
+			for _, field := range definition.Index.Fields {
+				if _, ok := parsed.Selector[field]; !ok {
+					t.Errorf("query %v does not select on %v, so index %v cannot be used", queryString, field, definition.Name)
+				}
+			}
+		})
+	}
+}
+
+func TestCommitmentSelectorsSelectCommitments(t *testing.T) {
+	queryString, err := buildCommitmentSelector(CommitmentFilter{Owner: "owner1"})
+	if err != nil {
+		t.Fatalf("failed to build query: %v", err)
+	}
+	expected := `{"selector":{"objectType":"commitment","owner":"owner1"},"use_index":["_design/indexOwnerDoc","indexOwner"]}`
+	if queryString != expected {
+		t.Errorf("query of a filter without objectType is %v, expected %v", queryString, expected)
+	}
+
+	_, err = buildCommitmentSelector(CommitmentFilter{ObjectType: "lot", Owner: "owner1"})
+	if err == nil || err.Error() != "objectType must be commitment" {
+		t.Errorf("query of a filter for lots should fail, got %v", err)
+	}
+}
+
+func TestPinQueryToType(t *testing.T) {
+	cases := []struct {
+		name     string
+		query    string
+		expected string
+	}{
+		{
+			name:     "selector on an indexed field",
+			query:    `{"selector":{"crop":"corn"},"limit":5}`,
+			expected: `{"selector":{"$and":[{"objectType":"commitment"},{"crop":"corn"}]},"limit":5,"use_index":["_design/indexCropDoc","indexCrop"]}`,
+		},
+		{
+			name:     "selector on another object type",
+			query:    `{"selector":{"objectType":"yield","owner":"owner1"}}`,
+			expected: `{"selector":{"$and":[{"objectType":"commitment"},{"objectType":"yield","owner":"owner1"}]},"use_index":["_design/indexOwnerDoc","indexOwner"]}`,
+		},
+		{
+			name:     "selector without indexed fields",
+			query:    `{"selector":{"production":{"$gt":50}}}`,
+			expected: `{"selector":{"$and":[{"objectType":"commitment"},{"production":{"$gt":50}}]}}`,
+		},
+		{
+			name:     "index named by the query",
+			query:    `{"selector":{"crop":"corn"},"use_index":"indexLocationDoc"}`,
+			expected: `{"selector":{"$and":[{"objectType":"commitment"},{"crop":"corn"}]},"use_index":"indexLocationDoc"}`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			pinned, err := pinQueryToType(tc.query, commitmentCollection, commitmentObjectType)
+			if err != nil {
+				t.Fatalf("failed to pin query: %v", err)
+			}
+
+			var actual, expected interface{}
+			if err := json.Unmarshal([]byte(pinned), &actual); err != nil {
+				t.Fatalf("pinned query %v is not valid JSON: %v", pinned, err)
+			}
+			if err := json.Unmarshal([]byte(tc.expected), &expected); err != nil {
+				t.Fatalf("expected query %v is not valid JSON: %v", tc.expected, err)
+			}
+			if !reflect.DeepEqual(expected, actual) {
+				t.Errorf("pinned query is %v, want %v", pinned, tc.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,263 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+const reputationConfigObjectType = "reputationConfig"
+
+// reputationAdminAttribute is the client certificate attribute required to change the reputation weights
+const reputationAdminAttribute = "reputation.admin"
+
+// Data is the reputation of a producer. The score is computed by the chaincode from the
+// producer's fulfillment history and is stored in the dataCollection under the producer identity,
+// which is also recorded as the owner of the record.
+type Data struct {
+	Type              string  `json:"objectType"`
+	ID                string  `json:"ID"`
+	Owner             string  `json:"owner"`
+	Reputation        float64 `json:"Reputation"`
+	Committed         float64 `json:"committed"`
+	Delivered         float64 `json:"delivered"`
+	ClosedCommitments int     `json:"closedCommitments"`
+	OnTime            int     `json:"onTime"`
+	Late              int     `json:"late"`
+	Defaults          int     `json:"defaults"`
+}
+
+// ReputationConfig holds the weights used to compute reputation scores
+type ReputationConfig struct {
+	DeliveryWeight   float64 `json:"deliveryWeight"`
+	TimelinessWeight float64 `json:"timelinessWeight"`
+	DefaultPenalty   float64 `json:"defaultPenalty"`
+}
+
+// defaultReputationConfig is used until weights are stored on the ledger with SetReputationConfig
+var defaultReputationConfig = ReputationConfig{
+	DeliveryWeight:   0.6,
+	TimelinessWeight: 0.4,
+	DefaultPenalty:   0.5,
+}
+
+// computeReputation scores a producer between 0 and 1. The delivered-vs-committed ratio and
+// the share of commitments closed on time are weighted and averaged, then the share of
+// defaulted commitments is subtracted as a penalty.
+func computeReputation(data *Data, config *ReputationConfig) float64 {
+	deliveryRatio := 0.0
+	if data.Committed > 0 {
+		deliveryRatio = data.Delivered / data.Committed
+		if deliveryRatio > 1 {
+			deliveryRatio = 1
+		}
+	}
+
+	timelinessRatio := 1.0
+	if data.OnTime+data.Late > 0 {
+		timelinessRatio = float64(data.OnTime) / float64(data.OnTime+data.Late)
+	}
+
+	defaultRatio := 0.0
+	if data.ClosedCommitments > 0 {
+		defaultRatio = float64(data.Defaults) / float64(data.ClosedCommitments)
+	}
+
+	totalWeight := config.DeliveryWeight + config.TimelinessWeight
+	if totalWeight <= 0 {
+		return 0
+	}
+
+	score := (config.DeliveryWeight*deliveryRatio+config.TimelinessWeight*timelinessRatio)/totalWeight - config.DefaultPenalty*defaultRatio
+	if score < 0 {
+		return 0
+	}
+	if score > 1 {
+		return 1
+	}
+	return score
+}
+
+// readReputationConfig returns the weights stored on the ledger, or the default weights
+func readReputationConfig(ctx contractapi.TransactionContextInterface) (*ReputationConfig, error) {
+	configKey, err := ctx.GetStub().CreateCompositeKey(reputationConfigObjectType, []string{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	configJSON, err := ctx.GetStub().GetPrivateData(dataCollection, configKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read reputation config: %v", err)
+	}
+
+	config := defaultReputationConfig
+	if configJSON == nil {
+		return &config, nil
+	}
+
+	err = json.Unmarshal(configJSON, &config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal JSON: %v", err)
+	}
+	return &config, nil
+}
+
+// reputationUpdates collects the changes to the reputation of several producers made by one
+// transaction. Private data writes are not visible to later reads in the same transaction, so
+// the changes for a producer are applied to the reputation together.
+type reputationUpdates struct {
+	producers []string
+	updates   map[string][]func(*Data)
+}
+
+// add queues a change to the producer's reputation
+func (r *reputationUpdates) add(producer string, update func(*Data)) {
+	if r.updates == nil {
+		r.updates = map[string][]func(*Data){}
+	}
+	if _, ok := r.updates[producer]; !ok {
+		r.producers = append(r.producers, producer)
+	}
+	r.updates[producer] = append(r.updates[producer], update)
+}
+
+// apply writes the queued changes, once per producer
+func (r *reputationUpdates) apply(ctx contractapi.TransactionContextInterface, s *SmartContract) error {
+	for _, producer := range r.producers {
+		producerUpdates := r.updates[producer]
+		err := s.updateReputation(ctx, producer, func(data *Data) {
+			for _, update := range producerUpdates {
+				update(data)
+			}
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// updateReputation applies a change to the producer's fulfillment history and recomputes the score
+func (s *SmartContract) updateReputation(ctx contractapi.TransactionContextInterface, producer string, update func(data *Data)) error {
+	// Commitments created before producers were recorded cannot be attributed
+	if producer == "" {
+		return nil
+	}
+
+	data, err := s.ReadData(ctx, producer)
+	if err != nil {
+		return err
+	}
+	if data == nil {
+		data = &Data{ID: producer}
+	}
+
+	update(data)
+	data.Type = dataObjectType
+	data.Owner = producer
+
+	config, err := readReputationConfig(ctx)
+	if err != nil {
+		return err
+	}
+	data.Reputation = computeReputation(data, config)
+
+	dataJSONasBytes, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("failed to marshal reputation into JSON: %v", err)
+	}
+
+	dataKey, err := objectKey(ctx, dataObjectType, producer)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("updateReputation Put: collection %v, ID %v, reputation %v", dataCollection, producer, data.Reputation)
+	err = ctx.GetStub().PutPrivateData(dataCollection, dataKey, dataJSONasBytes)
+	if err != nil {
+		return fmt.Errorf("failed to put reputation into private data collecton: %v", err)
+	}
+	return nil
+}
+
+// deliveredOnTime reports whether the commitment is being closed before its delivery deadline.
+// Commitments without a deadline are always on time.
+func deliveredOnTime(ctx contractapi.TransactionContextInterface, commitment *Commitment) (bool, error) {
+	if commitment.DeliveryDeadline == "" {
+		return true, nil
+	}
+
+	deadline, err := time.Parse(time.RFC3339, commitment.DeliveryDeadline)
+	if err != nil {
+		return false, fmt.Errorf("invalid deliveryDeadline on commitment %v: %v", commitment.ID, err)
+	}
+
+	closedAt, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return false, fmt.Errorf("failed to get transaction timestamp: %v", err)
+	}
+
+	return !time.Unix(closedAt.Seconds, int64(closedAt.Nanos)).After(deadline), nil
+}
+
+// recordClosed counts a commitment that reached Fulfilled or Defaulted in the producer's history
+func recordClosed(data *Data, commitment *Commitment, onTime bool) {
+	data.ClosedCommitments++
+	switch {
+	case commitmentStatus(commitment) == StatusDefaulted:
+		data.Defaults++
+	case onTime:
+		data.OnTime++
+	default:
+		data.Late++
+	}
+}
+
+// SetReputationConfig stores the weights used to compute reputation scores. Only clients
+// holding the reputation.admin attribute can change the weights.
+func (s *SmartContract) SetReputationConfig(ctx contractapi.TransactionContextInterface, deliveryWeight float64, timelinessWeight float64, defaultPenalty float64) error {
+
+	err := ctx.GetClientIdentity().AssertAttributeValue(reputationAdminAttribute, "true")
+	if err != nil {
+		return fmt.Errorf("submitting client is not authorized to change the reputation config: %v", err)
+	}
+
+	if deliveryWeight < 0 || timelinessWeight < 0 || defaultPenalty < 0 {
+		return fmt.Errorf("reputation weights must not be negative")
+	}
+	if deliveryWeight+timelinessWeight == 0 {
+		return fmt.Errorf("deliveryWeight and timelinessWeight cannot both be zero")
+	}
+
+	// Verify that the client is submitting request to peer in their organization
+	err = s.verifyClientOrgMatchesPeerOrg(ctx)
+	if err != nil {
+		return fmt.Errorf("SetReputationConfig cannot be performed: Error %v", err)
+	}
+
+	config := ReputationConfig{
+		DeliveryWeight:   deliveryWeight,
+		TimelinessWeight: timelinessWeight,
+		DefaultPenalty:   defaultPenalty,
+	}
+	configJSONasBytes, err := json.Marshal(config)
+	if err != nil {
+		return fmt.Errorf("failed to marshal reputation config: %v", err)
+	}
+
+	configKey, err := ctx.GetStub().CreateCompositeKey(reputationConfigObjectType, []string{})
+	if err != nil {
+		return fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	log.Printf("SetReputationConfig Put: collection %v, config %+v", dataCollection, config)
+	return ctx.GetStub().PutPrivateData(dataCollection, configKey, configJSONasBytes)
+}
+
+// GetReputationConfig returns the weights currently used to compute reputation scores
+func (s *SmartContract) GetReputationConfig(ctx contractapi.TransactionContextInterface) (*ReputationConfig, error) {
+	return readReputationConfig(ctx)
+}
@@ -0,0 +1,152 @@
+package chaincode
+
+import (
+	"testing"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/hyperledger/fabric-samples/yield-commitment/chaincode-go/simulator"
+	"github.com/stretchr/testify/require"
+)
+
+func TestComputeReputation(t *testing.T) {
+	cases := []struct {
+		name   string
+		data   Data
+		config ReputationConfig
+		score  float64
+	}{
+		{
+			name:   "no history",
+			config: defaultReputationConfig,
+			score:  0.4,
+		},
+		{
+			name:   "delivered in full and on time",
+			data:   Data{Committed: 100, Delivered: 100, ClosedCommitments: 1, OnTime: 1},
+			config: defaultReputationConfig,
+			score:  1,
+		},
+		{
+			name:   "over delivery is capped",
+			data:   Data{Committed: 100, Delivered: 150, ClosedCommitments: 1, Late: 1},
+			config: defaultReputationConfig,
+			score:  0.6,
+		},
+		{
+			name:   "one default in two commitments",
+			data:   Data{Committed: 200, Delivered: 100, ClosedCommitments: 2, OnTime: 1, Defaults: 1},
+			config: defaultReputationConfig,
+			score:  0.45,
+		},
+		{
+			name:   "penalty below zero",
+			data:   Data{Committed: 100, ClosedCommitments: 1, Defaults: 1},
+			config: ReputationConfig{DeliveryWeight: 1, DefaultPenalty: 2},
+			score:  0,
+		},
+		{
+			name:   "no weights",
+			data:   Data{Committed: 100, Delivered: 100},
+			config: ReputationConfig{},
+			score:  0,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			require.InDelta(t, tc.score, computeReputation(&tc.data, &tc.config), 1e-9)
+		})
+	}
+}
+
+func TestSetReputationConfig(t *testing.T) {
+	cases := []struct {
+		name    string
+		admin   bool
+		peerMSP string
+		config  ReputationConfig
+		err     string
+	}{
+		{
+			name:   "client without the admin attribute",
+			config: ReputationConfig{DeliveryWeight: 1, TimelinessWeight: 1},
+			err:    "submitting client is not authorized to change the reputation config",
+		},
+		{
+			name:   "negative weight",
+			admin:  true,
+			config: ReputationConfig{DeliveryWeight: 1, DefaultPenalty: -1},
+			err:    "reputation weights must not be negative",
+		},
+		{
+			name:   "no weights",
+			admin:  true,
+			config: ReputationConfig{DefaultPenalty: 1},
+			err:    "deliveryWeight and timelinessWeight cannot both be zero",
+		},
+		{
+			name:    "client of another org",
+			admin:   true,
+			peerMSP: "Org2MSP",
+			config:  ReputationConfig{DeliveryWeight: 1, TimelinessWeight: 1},
+			err:     crossOrgError,
+		},
+		{
+			name:   "admin",
+			admin:  true,
+			config: ReputationConfig{DeliveryWeight: 1, TimelinessWeight: 0, DefaultPenalty: 0.25},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			n := newTestNetwork(t)
+			client := simulator.NewClient("Org1MSP", "admin")
+			if tc.admin {
+				client.WithAttribute(reputationAdminAttribute, "true")
+			}
+			peerMSP := tc.peerMSP
+			if peerMSP == "" {
+				peerMSP = client.MSPID()
+			}
+
+			tx := n.transaction(client, "SetReputationConfig", nil).OnPeer(peerMSP)
+			err := n.ledger.Submit(tx, func(ctx contractapi.TransactionContextInterface) error {
+				return n.contract.SetReputationConfig(ctx, tc.config.DeliveryWeight, tc.config.TimelinessWeight, tc.config.DefaultPenalty)
+			})
+
+			var config *ReputationConfig
+			require.NoError(t, n.evaluate(n.producer, func(ctx contractapi.TransactionContextInterface) error {
+				var err error
+				config, err = n.contract.GetReputationConfig(ctx)
+				return err
+			}))
+
+			if tc.err != "" {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), tc.err)
+				require.Equal(t, &defaultReputationConfig, config)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, &tc.config, config)
+		})
+	}
+}
+
+func TestReputationUsesStoredConfig(t *testing.T) {
+	n := newTestNetwork(t)
+	admin := simulator.NewClient("Org1MSP", "admin").WithAttribute(reputationAdminAttribute, "true")
+	require.NoError(t, n.call(admin, "SetReputationConfig", func(ctx contractapi.TransactionContextInterface) error {
+		return n.contract.SetReputationConfig(ctx, 1, 0, 0)
+	}))
+
+	// Only half of the committed production is delivered before the commitment defaults
+	n.createCommitment("c1")
+	n.recordYield("y1", "c1", 50)
+	n.mustSubmit(n.producer, "SetCommitmentStatus", transient{"commitment_status": map[string]string{"commitmentID": "c1", "status": StatusDefaulted}})
+
+	data := n.readData(n.producer)
+	require.Equal(t, 1, data.Defaults)
+	require.InDelta(t, 0.5, data.Reputation, 1e-9)
+}
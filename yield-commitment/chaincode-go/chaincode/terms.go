@@ -0,0 +1,125 @@
+package chaincode
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// defaultCurrency is the currency of terms that do not name one, as rates were quoted before
+// the currency became part of the terms
+const defaultCurrency = "USD"
+
+// normalizeTerms validates the agreement terms and rewrites them in their canonical form:
+// surrounding whitespace removed, currency in upper case and the delivery window in UTC.
+func normalizeTerms(terms *CommitmentPrivateDetails) error {
+	terms.ID = strings.TrimSpace(terms.ID)
+	terms.Currency = strings.ToUpper(strings.TrimSpace(terms.Currency))
+	terms.Salt = strings.TrimSpace(terms.Salt)
+	if terms.Currency == "" {
+		terms.Currency = defaultCurrency
+	}
+
+	if len(terms.ID) == 0 {
+		return fmt.Errorf("commitmentID field must be a non-empty string")
+	}
+	if terms.Rate <= 0 {
+		return fmt.Errorf("rate field must be a positive integer")
+	}
+	if terms.Quantity <= 0 {
+		return fmt.Errorf("quantity field must be a positive integer")
+	}
+	if len(terms.Currency) != 3 {
+		return fmt.Errorf("currency field must be a three letter currency code")
+	}
+	if len(terms.Salt) == 0 {
+		return fmt.Errorf("salt field must be a non-empty string")
+	}
+
+	if terms.DeliveryStart == "" && terms.DeliveryEnd == "" {
+		return nil
+	}
+	start, err := time.Parse(time.RFC3339, strings.TrimSpace(terms.DeliveryStart))
+	if err != nil {
+		return fmt.Errorf("deliveryStart field must be an RFC3339 time: %v", err)
+	}
+	end, err := time.Parse(time.RFC3339, strings.TrimSpace(terms.DeliveryEnd))
+	if err != nil {
+		return fmt.Errorf("deliveryEnd field must be an RFC3339 time: %v", err)
+	}
+	if end.Before(start) {
+		return fmt.Errorf("deliveryEnd must not be before deliveryStart")
+	}
+	terms.DeliveryStart = start.UTC().Format(time.RFC3339)
+	terms.DeliveryEnd = end.UTC().Format(time.RFC3339)
+	return nil
+}
+
+// canonicalTerms returns the serialization of the agreement terms that is stored by both the
+// owner and the buyer. Marshaling the normalized struct fixes the field order and drops any
+// field that is not part of the terms, so identical terms always produce identical hashes.
+func canonicalTerms(terms *CommitmentPrivateDetails) ([]byte, error) {
+	err := normalizeTerms(terms)
+	if err != nil {
+		return nil, err
+	}
+
+	termsJSON, err := json.Marshal(terms)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal terms: %v", err)
+	}
+	return termsJSON, nil
+}
+
+// derivedSalt returns the salt of terms written on behalf of the owner from other terms, such
+// as the parts of a split commitment. It is as hard to guess as the salt it is derived from,
+// and differs for each ID.
+func derivedSalt(salt string, id string) string {
+	hash := sha256.Sum256([]byte(salt + "\x00" + id))
+	return hex.EncodeToString(hash[:])
+}
+
+// readTermsInput reads the agreement terms passed in the commitment_value transient field
+// and returns them in canonical form
+func readTermsInput(ctx contractapi.TransactionContextInterface) (*CommitmentPrivateDetails, []byte, error) {
+	transientMap, err := ctx.GetStub().GetTransient()
+	if err != nil {
+		return nil, nil, fmt.Errorf("error getting transient: %v", err)
+	}
+
+	// Value is private, therefore it gets passed in transient field
+	transientValueJSON, ok := transientMap["commitment_value"]
+	if !ok {
+		return nil, nil, fmt.Errorf("commitment_value key not found in the transient map")
+	}
+
+	var terms CommitmentPrivateDetails
+	err = json.Unmarshal(transientValueJSON, &terms)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to unmarshal JSON: %v", err)
+	}
+
+	termsJSON, err := canonicalTerms(&terms)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &terms, termsJSON, nil
+}
+
+// PreviewAgreementHash returns the SHA-256 hash, hex encoded, of the canonical form of the
+// terms passed in the commitment_value transient field. Owners and buyers can evaluate it to
+// check that they will store matching terms before calling AgreeToSell and AgreeToTransfer.
+func (s *SmartContract) PreviewAgreementHash(ctx contractapi.TransactionContextInterface) (string, error) {
+	_, termsJSON, err := readTermsInput(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	hash := sha256.Sum256(termsJSON)
+	return hex.EncodeToString(hash[:]), nil
+}
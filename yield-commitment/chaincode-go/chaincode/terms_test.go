@@ -0,0 +1,113 @@
+package chaincode
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/hyperledger/fabric-samples/yield-commitment/chaincode-go/simulator"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTermsRequireSalt(t *testing.T) {
+	terms := &CommitmentPrivateDetails{ID: "c1", Rate: 2500, Quantity: 100, Currency: "USD"}
+	_, err := canonicalTerms(terms)
+	require.EqualError(t, err, "salt field must be a non-empty string")
+
+	terms.Salt = " 5e1f07 "
+	termsJSON, err := canonicalTerms(terms)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"commitmentID":"c1","rate":2500,"quantity":100,"deliveryStart":"","deliveryEnd":"","currency":"USD","salt":"5e1f07"}`, string(termsJSON))
+}
+
+func TestNormalizeTerms(t *testing.T) {
+	cases := []struct {
+		name     string
+		terms    CommitmentPrivateDetails
+		expected CommitmentPrivateDetails
+		err      string
+	}{
+		{
+			name:     "currency defaults to USD",
+			terms:    CommitmentPrivateDetails{ID: "c1", Rate: 2500, Quantity: 100, Salt: "5e1f07"},
+			expected: CommitmentPrivateDetails{ID: "c1", Rate: 2500, Quantity: 100, Currency: "USD", Salt: "5e1f07"},
+		},
+		{
+			name:     "whitespace, case and time zone",
+			terms:    CommitmentPrivateDetails{ID: " c1 ", Rate: 2500, Quantity: 100, Currency: " eur", Salt: "5e1f07 ", DeliveryStart: "2021-09-01T02:00:00+02:00", DeliveryEnd: "2021-09-30T00:00:00Z"},
+			expected: CommitmentPrivateDetails{ID: "c1", Rate: 2500, Quantity: 100, Currency: "EUR", Salt: "5e1f07", DeliveryStart: "2021-09-01T00:00:00Z", DeliveryEnd: "2021-09-30T00:00:00Z"},
+		},
+		{
+			name:  "zero rate",
+			terms: CommitmentPrivateDetails{ID: "c1", Quantity: 100, Salt: "5e1f07"},
+			err:   "rate field must be a positive integer",
+		},
+		{
+			name:  "malformed currency",
+			terms: CommitmentPrivateDetails{ID: "c1", Rate: 2500, Quantity: 100, Currency: "dollars", Salt: "5e1f07"},
+			err:   "currency field must be a three letter currency code",
+		},
+		{
+			name:  "half of a delivery window",
+			terms: CommitmentPrivateDetails{ID: "c1", Rate: 2500, Quantity: 100, Salt: "5e1f07", DeliveryStart: "2021-09-01T00:00:00Z"},
+			err:   "deliveryEnd field must be an RFC3339 time",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := normalizeTerms(&tc.terms)
+			if tc.err != "" {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), tc.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, tc.terms)
+		})
+	}
+}
+
+func TestPreviewAgreementHash(t *testing.T) {
+	n := newTestNetwork(t)
+	preview := func(client *simulator.Client, input transient) (string, error) {
+		var hash string
+		err := n.ledger.Evaluate(n.transaction(client, "PreviewAgreementHash", input), func(ctx contractapi.TransactionContextInterface) error {
+			var err error
+			hash, err = n.contract.PreviewAgreementHash(ctx)
+			return err
+		})
+		return hash, err
+	}
+
+	_, err := preview(n.producer, transient{})
+	require.EqualError(t, err, "commitment_value key not found in the transient map")
+	_, err = preview(n.producer, transient{"commitment_value": with(termsInput("c1"), "salt", nil)})
+	require.EqualError(t, err, "salt field must be a non-empty string")
+
+	// Terms that differ only in their formatting have the same hash
+	ownerHash, err := preview(n.producer, transient{"commitment_value": termsInput("c1")})
+	require.NoError(t, err)
+	buyerHash, err := preview(n.buyer, transient{"commitment_value": with(with(termsInput("c1"), "currency", " usd"), "comment", "ignored")})
+	require.NoError(t, err)
+	require.Equal(t, ownerHash, buyerHash)
+	defaultHash, err := preview(n.buyer, transient{"commitment_value": with(termsInput("c1"), "currency", nil)})
+	require.NoError(t, err)
+	require.Equal(t, ownerHash, defaultHash)
+
+	otherHash, err := preview(n.buyer, transient{"commitment_value": with(termsInput("c1"), "rate", 2900)})
+	require.NoError(t, err)
+	require.NotEqual(t, ownerHash, otherHash)
+
+	// The preview is the hash of the terms stored by AgreeToSell
+	n.createCommitment("c1")
+	n.mustSubmit(n.producer, "AgreeToSell", transient{"commitment_value": termsInput("c1")})
+	err = n.evaluate(n.producer, func(ctx contractapi.TransactionContextInterface) error {
+		ownerKey, err := privateDetailsKey(ctx, "c1", n.producer.ID())
+		require.NoError(t, err)
+		hash, err := ctx.GetStub().GetPrivateDataHash("Org1MSPPrivateCollection", ownerKey)
+		require.Equal(t, ownerHash, hex.EncodeToString(hash))
+		return err
+	})
+	require.NoError(t, err)
+}
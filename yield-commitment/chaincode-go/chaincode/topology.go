@@ -0,0 +1,95 @@
+package chaincode
+
+import (
+	"encoding/base64"
+	"fmt"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// Topology maps the peer and the client of a transaction to their organizations and private
+// data collections. Deployments that name their org collections differently, or tests that
+// simulate other org layouts, configure their own Topology on the SmartContract.
+type Topology interface {
+	// PeerMSPID returns the MSP ID of the organization of the peer endorsing the transaction
+	PeerMSPID(ctx contractapi.TransactionContextInterface) (string, error)
+	// OrgCollection returns the name of the private data collection of an organization
+	OrgCollection(mspID string) string
+	// ClientID returns the identity of the submitting client, as recorded in owner and buyer fields
+	ClientID(ctx contractapi.TransactionContextInterface) (string, error)
+}
+
+// DefaultTopology reads the peer MSP ID from the CORE_PEER_LOCALMSPID environment variable of the
+// peer, names org collections <MSPID>PrivateCollection as in collections_config.json, and decodes
+// the base64 client identity of the certificate.
+type DefaultTopology struct{}
+
+// PeerMSPID returns the MSP ID of the peer the chaincode runs for
+func (DefaultTopology) PeerMSPID(ctx contractapi.TransactionContextInterface) (string, error) {
+	return shim.GetMSPID()
+}
+
+// OrgCollection returns <MSPID>PrivateCollection
+func (DefaultTopology) OrgCollection(mspID string) string {
+	return mspID + "PrivateCollection"
+}
+
+// ClientID returns the decoded x509 identity of the submitting client
+func (DefaultTopology) ClientID(ctx contractapi.TransactionContextInterface) (string, error) {
+	b64ID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return "", fmt.Errorf("Failed to read clientID: %v", err)
+	}
+	decodeID, err := base64.StdEncoding.DecodeString(b64ID)
+	if err != nil {
+		return "", fmt.Errorf("failed to base64 decode clientID: %v", err)
+	}
+	return string(decodeID), nil
+}
+
+// topology returns the configured Topology, or DefaultTopology
+func (s *SmartContract) topology() Topology {
+	if s.Topology == nil {
+		return DefaultTopology{}
+	}
+	return s.Topology
+}
+
+// getCollectionName is an internal helper function to get collection of submitting client identity.
+func (s *SmartContract) getCollectionName(ctx contractapi.TransactionContextInterface) (string, error) {
+
+	// Get the MSP ID of submitting client identity
+	clientMSPID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return "", fmt.Errorf("failed to get verified MSPID: %v", err)
+	}
+
+	// Create the collection name
+	orgCollection := s.topology().OrgCollection(clientMSPID)
+
+	return orgCollection, nil
+}
+
+// verifyClientOrgMatchesPeerOrg is an internal function used verify client org id and matches peer org id.
+func (s *SmartContract) verifyClientOrgMatchesPeerOrg(ctx contractapi.TransactionContextInterface) error {
+	clientMSPID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return fmt.Errorf("failed getting the client's MSPID: %v", err)
+	}
+	peerMSPID, err := s.topology().PeerMSPID(ctx)
+	if err != nil {
+		return fmt.Errorf("failed getting the peer's MSPID: %v", err)
+	}
+
+	if clientMSPID != peerMSPID {
+		return fmt.Errorf("client from org %v is not authorized to read or write private data from an org %v peer", clientMSPID, peerMSPID)
+	}
+
+	return nil
+}
+
+// submittingClientIdentity returns the identity of the submitting client
+func (s *SmartContract) submittingClientIdentity(ctx contractapi.TransactionContextInterface) (string, error) {
+	return s.topology().ClientID(ctx)
+}
@@ -0,0 +1,102 @@
+package chaincode
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/hyperledger/fabric-samples/yield-commitment/chaincode-go/simulator"
+	"github.com/stretchr/testify/require"
+)
+
+// termsTopology names org collections terms_<MSPID>
+type termsTopology struct {
+	DefaultTopology
+}
+
+func (termsTopology) OrgCollection(mspID string) string {
+	return "terms_" + mspID
+}
+
+// threeOrgCollections is a collection configuration for three orgs with terms_<MSPID> collections
+func threeOrgCollections(t *testing.T) []*simulator.Collection {
+	orgs := []string{"Org1MSP", "Org2MSP", "Org3MSP"}
+	members := []string{}
+	for _, org := range orgs {
+		members = append(members, fmt.Sprintf("'%v.member'", org))
+	}
+	shared := fmt.Sprintf("OR(%v)", strings.Join(members, ", "))
+
+	config := []string{}
+	for _, name := range []string{commitmentCollection, dataCollection, yieldCollection, marketCollection} {
+		config = append(config, fmt.Sprintf(`{"name":%q,"policy":%q,"memberOnlyRead":true,"memberOnlyWrite":true}`, name, shared))
+	}
+	for _, org := range orgs {
+		config = append(config, fmt.Sprintf(`{"name":"terms_%v","policy":"OR('%v.member')","memberOnlyRead":true}`, org, org))
+	}
+
+	collections, err := simulator.ParseCollections([]byte("[" + strings.Join(config, ",") + "]"))
+	require.NoError(t, err)
+	return collections
+}
+
+func TestCustomTopology(t *testing.T) {
+	n := &testNetwork{
+		t:        t,
+		ledger:   simulator.NewLedger(threeOrgCollections(t)),
+		contract: &SmartContract{Topology: simulator.NewTopology(termsTopology{})},
+		producer: simulator.NewClient("Org3MSP", "producer"),
+		other:    simulator.NewClient("Org3MSP", "other"),
+		buyer:    simulator.NewClient("Org1MSP", "buyer"),
+		rival:    simulator.NewClient("Org2MSP", "rival"),
+	}
+
+	n.createCommitment("c1")
+	require.Len(t, n.ledger.PrivateDataKeys("terms_Org3MSP"), 1)
+
+	// Clients are still confined to the peers of their org
+	err := n.submitOnPeer(n.buyer, "Org2MSP", "AgreeToTransfer", transient{"commitment_value": termsInput("c1")})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "client from org Org1MSP is not authorized to read or write private data from an org Org2MSP peer")
+
+	n.agree("c1", n.buyer)
+	n.mustSubmit(n.producer, "TransferCommitment", transient{"commitment_owner": map[string]string{"commitmentID": "c1", "buyerMSP": "Org1MSP", "buyerID": n.buyer.ID()}})
+
+	require.Equal(t, n.buyer.ID(), n.readCommitment("c1").Owner)
+	require.Empty(t, n.ledger.PrivateDataKeys("terms_Org3MSP"))
+	require.Len(t, n.ledger.PrivateDataKeys("terms_Org1MSP"), 1)
+	require.Empty(t, n.ledger.PrivateDataKeys("terms_Org2MSP"))
+
+	var details *CommitmentPrivateDetails
+	err = n.evaluate(n.buyer, func(ctx contractapi.TransactionContextInterface) error {
+		var err error
+		details, err = n.contract.ReadCommitmentPrivateDetails(ctx, "terms_Org1MSP", "c1")
+		return err
+	})
+	require.NoError(t, err)
+	require.Equal(t, 3000, details.Rate)
+}
+
+// The chaincode process runs for the peer whose MSP ID is in its environment
+func TestDefaultTopologyPeerMSPID(t *testing.T) {
+	previous, set := os.LookupEnv("CORE_PEER_LOCALMSPID")
+	defer func() {
+		if set {
+			os.Setenv("CORE_PEER_LOCALMSPID", previous)
+		} else {
+			os.Unsetenv("CORE_PEER_LOCALMSPID")
+		}
+	}()
+
+	ctx := &mockTransactionContext{stub: transientErrorStub{}}
+	require.NoError(t, os.Setenv("CORE_PEER_LOCALMSPID", "Org3MSP"))
+	peerMSPID, err := DefaultTopology{}.PeerMSPID(ctx)
+	require.NoError(t, err)
+	require.Equal(t, "Org3MSP", peerMSPID)
+
+	require.NoError(t, os.Unsetenv("CORE_PEER_LOCALMSPID"))
+	_, err = DefaultTopology{}.PeerMSPID(ctx)
+	require.Error(t, err)
+}
@@ -0,0 +1,197 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// GetYieldByRange performs a range query based on the start and end yield IDs provided. The start ID
+// is inclusive and the end ID exclusive, an empty string leaves that end of the range open.
+func (s *SmartContract) GetYieldByRange(ctx contractapi.TransactionContextInterface, startKey string, endKey string) ([]*Yield, error) {
+
+	results := []*Yield{}
+	err := iterateRange(ctx, yieldCollection, yieldObjectType, startKey, endKey, func(value []byte) error {
+		var yield *Yield
+		err := json.Unmarshal(value, &yield)
+		if err != nil {
+			return fmt.Errorf("failed to unmarshal JSON: %v", err)
+		}
+		results = append(results, yield)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// QueryYieldByOwner queries for the yields reported by a producer.
+// Only available on state databases that support rich query (e.g. CouchDB)
+func (s *SmartContract) QueryYieldByOwner(ctx contractapi.TransactionContextInterface, owner string) ([]*Yield, error) {
+
+	queryString, err := yieldByOwnerQuery(owner)
+	if err != nil {
+		return nil, err
+	}
+	return getYieldQueryResult(ctx, queryString)
+}
+
+// QueryYields uses a query string to perform a query for yields. The query is checked
+// against the fields of the Yield record and the allowed operators before it is executed,
+// and only matches yields, not the delivery records kept in the same collection.
+// Only available on state databases that support rich query (e.g. CouchDB)
+func (s *SmartContract) QueryYields(ctx contractapi.TransactionContextInterface, queryString string) ([]*Yield, error) {
+
+	err := validateQueryString(queryString, yieldQueryFields)
+	if err != nil {
+		return nil, err
+	}
+	queryString, err = pinQueryToType(queryString, yieldCollection, yieldObjectType)
+	if err != nil {
+		return nil, err
+	}
+	return getYieldQueryResult(ctx, queryString)
+}
+
+// getYieldQueryResult executes the passed in query string on the yieldCollection
+func getYieldQueryResult(ctx contractapi.TransactionContextInterface, queryString string) ([]*Yield, error) {
+
+	resultsIterator, err := ctx.GetStub().GetPrivateDataQueryResult(yieldCollection, queryString)
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	results := []*Yield{}
+
+	for resultsIterator.HasNext() {
+		response, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var yield *Yield
+		err = json.Unmarshal(response.Value, &yield)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal JSON: %v", err)
+		}
+
+		results = append(results, yield)
+	}
+	return results, nil
+}
+
+// GetDataByRange performs a range query on the reputation records, based on the start and end
+// producer identities provided. The start is inclusive and the end exclusive, an empty string
+// leaves that end of the range open.
+func (s *SmartContract) GetDataByRange(ctx contractapi.TransactionContextInterface, startKey string, endKey string) ([]*Data, error) {
+
+	results := []*Data{}
+	err := iterateRange(ctx, dataCollection, dataObjectType, startKey, endKey, func(value []byte) error {
+		var data *Data
+		err := json.Unmarshal(value, &data)
+		if err != nil {
+			return fmt.Errorf("failed to unmarshal JSON: %v", err)
+		}
+		results = append(results, data)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// QueryDataByOwner queries for the reputation record of a producer.
+// Only available on state databases that support rich query (e.g. CouchDB)
+func (s *SmartContract) QueryDataByOwner(ctx contractapi.TransactionContextInterface, owner string) ([]*Data, error) {
+
+	queryString, err := dataByOwnerQuery(owner)
+	if err != nil {
+		return nil, err
+	}
+	return getDataQueryResult(ctx, queryString)
+}
+
+// QueryData uses a query string to perform a query for reputation records. The query is checked
+// against the fields of the Data record and the allowed operators before it is executed,
+// and only matches reputation records.
+// Only available on state databases that support rich query (e.g. CouchDB)
+func (s *SmartContract) QueryData(ctx contractapi.TransactionContextInterface, queryString string) ([]*Data, error) {
+
+	err := validateQueryString(queryString, dataQueryFields)
+	if err != nil {
+		return nil, err
+	}
+	queryString, err = pinQueryToType(queryString, dataCollection, dataObjectType)
+	if err != nil {
+		return nil, err
+	}
+	return getDataQueryResult(ctx, queryString)
+}
+
+// getDataQueryResult executes the passed in query string on the dataCollection
+func getDataQueryResult(ctx contractapi.TransactionContextInterface, queryString string) ([]*Data, error) {
+
+	resultsIterator, err := ctx.GetStub().GetPrivateDataQueryResult(dataCollection, queryString)
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	results := []*Data{}
+
+	for resultsIterator.HasNext() {
+		response, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var data *Data
+		err = json.Unmarshal(response.Value, &data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal JSON: %v", err)
+		}
+
+		results = append(results, data)
+	}
+	return results, nil
+}
+
+// iterateRange calls visit with the value of each object of the given type whose ID is in the range.
+// Objects are stored under composite keys, which cannot be used with GetPrivateDataByRange, so the
+// keys of the type are iterated in key order and filtered on the ID.
+func iterateRange(ctx contractapi.TransactionContextInterface, collection string, objectType string, startKey string, endKey string, visit func(value []byte) error) error {
+
+	resultsIterator, err := ctx.GetStub().GetPrivateDataByPartialCompositeKey(collection, objectType, []string{})
+	if err != nil {
+		return err
+	}
+	defer resultsIterator.Close()
+
+	for resultsIterator.HasNext() {
+		response, err := resultsIterator.Next()
+		if err != nil {
+			return err
+		}
+
+		_, keyParts, err := ctx.GetStub().SplitCompositeKey(response.Key)
+		if err != nil {
+			return fmt.Errorf("failed to split composite key: %v", err)
+		}
+		if len(keyParts) == 0 || keyParts[0] < startKey {
+			continue
+		}
+		if endKey != "" && keyParts[0] >= endKey {
+			break
+		}
+
+		err = visit(response.Value)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
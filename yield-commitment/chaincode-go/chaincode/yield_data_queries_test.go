@@ -0,0 +1,209 @@
+package chaincode
+
+import (
+	"testing"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/stretchr/testify/require"
+)
+
+// newYieldNetwork returns the query network with two more yields: y2 of 50 reported by the
+// other producer on c3 and y3 of 100 reported by the producer on c2
+func newYieldNetwork(t *testing.T) *testNetwork {
+	n := newQueryNetwork(t)
+	n.mustSubmit(n.other, "CreateYield", transient{"yield_properties": map[string]interface{}{"objectType": "yield", "yieldID": "y2", "commitmentID": "c3", "produced": 50}})
+	n.recordYield("y3", "c2", 100)
+	return n
+}
+
+func yieldIDs(yields []*Yield) []string {
+	ids := []string{}
+	for _, yield := range yields {
+		ids = append(ids, yield.ID)
+	}
+	return ids
+}
+
+func dataOwners(records []*Data) []string {
+	owners := []string{}
+	for _, data := range records {
+		owners = append(owners, data.Owner)
+	}
+	return owners
+}
+
+func TestGetYieldByRange(t *testing.T) {
+	n := newYieldNetwork(t)
+
+	cases := []struct {
+		name       string
+		start, end string
+		ids        []string
+	}{
+		{name: "open range", ids: []string{"y1", "y2", "y3"}},
+		{name: "bounded range", start: "y2", end: "y3", ids: []string{"y2"}},
+		{name: "open start", end: "y2", ids: []string{"y1"}},
+		{name: "empty range", start: "z", ids: []string{}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := n.evaluate(n.buyer, func(ctx contractapi.TransactionContextInterface) error {
+				yields, err := n.contract.GetYieldByRange(ctx, tc.start, tc.end)
+				require.Equal(t, tc.ids, yieldIDs(yields))
+				return err
+			})
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestQueryYieldByOwner(t *testing.T) {
+	n := newYieldNetwork(t)
+
+	cases := []struct {
+		name  string
+		owner string
+		ids   []string
+	}{
+		{name: "producer", owner: n.producer.ID(), ids: []string{"y1", "y3"}},
+		{name: "other producer", owner: n.other.ID(), ids: []string{"y2"}},
+		{name: "owner without yields", owner: n.buyer.ID(), ids: []string{}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := n.evaluate(n.buyer, func(ctx contractapi.TransactionContextInterface) error {
+				yields, err := n.contract.QueryYieldByOwner(ctx, tc.owner)
+				require.Equal(t, tc.ids, yieldIDs(yields))
+				return err
+			})
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestQueryYields(t *testing.T) {
+	n := newYieldNetwork(t)
+
+	cases := []struct {
+		name  string
+		query string
+		ids   []string
+		err   string
+	}{
+		{name: "commitment", query: `{"selector":{"commitmentID":"c1"}}`, ids: []string{"y1"}},
+		{name: "produced range and sort", query: `{"selector":{"Produced":{"$gte":50}},"sort":[{"Produced":"desc"}]}`, ids: []string{"y3", "y2"}},
+		{name: "no match", query: `{"selector":{"commitmentID":"c4"}}`, ids: []string{}},
+		{name: "field that is not allowed", query: `{"selector":{"delivered":{"$gt":0}}}`, err: "field delivered is not allowed"},
+		{name: "null selector", query: `{"selector":null}`, err: "selector must be a JSON object, not null"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := n.evaluate(n.buyer, func(ctx contractapi.TransactionContextInterface) error {
+				yields, err := n.contract.QueryYields(ctx, tc.query)
+				if err != nil {
+					return err
+				}
+				require.Equal(t, tc.ids, yieldIDs(yields))
+				return nil
+			})
+			if tc.err != "" {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), tc.err)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestGetDataByRange(t *testing.T) {
+	n := newYieldNetwork(t)
+
+	err := n.evaluate(n.buyer, func(ctx contractapi.TransactionContextInterface) error {
+		records, err := n.contract.GetDataByRange(ctx, "", "")
+		require.NoError(t, err)
+		require.Equal(t, []string{n.other.ID(), n.producer.ID()}, dataOwners(records))
+
+		records, err = n.contract.GetDataByRange(ctx, n.producer.ID(), "")
+		require.NoError(t, err)
+		require.Equal(t, []string{n.producer.ID()}, dataOwners(records))
+
+		records, err = n.contract.GetDataByRange(ctx, "", n.producer.ID())
+		require.NoError(t, err)
+		require.Equal(t, []string{n.other.ID()}, dataOwners(records))
+		return nil
+	})
+	require.NoError(t, err)
+}
+
+func TestQueryDataByOwner(t *testing.T) {
+	n := newYieldNetwork(t)
+
+	err := n.evaluate(n.buyer, func(ctx contractapi.TransactionContextInterface) error {
+		records, err := n.contract.QueryDataByOwner(ctx, n.other.ID())
+		require.NoError(t, err)
+		require.Len(t, records, 1)
+		require.Equal(t, 50.0, records[0].Delivered)
+		require.Equal(t, 1, records[0].ClosedCommitments)
+
+		records, err = n.contract.QueryDataByOwner(ctx, n.buyer.ID())
+		require.NoError(t, err)
+		require.Empty(t, records)
+		return nil
+	})
+	require.NoError(t, err)
+}
+
+func TestQueryData(t *testing.T) {
+	n := newYieldNetwork(t)
+
+	cases := []struct {
+		name   string
+		query  string
+		owners func(n *testNetwork) []string
+		err    string
+	}{
+		{
+			name:   "closed commitments",
+			query:  `{"selector":{"closedCommitments":{"$gte":1}}}`,
+			owners: func(n *testNetwork) []string { return []string{n.other.ID()} },
+		},
+		{
+			name:   "sorted on delivery",
+			query:  `{"selector":{"objectType":"data"},"sort":[{"delivered":"desc"}]}`,
+			owners: func(n *testNetwork) []string { return []string{n.producer.ID(), n.other.ID()} },
+		},
+		{
+			name:  "field that is not allowed",
+			query: `{"selector":{"rate":3000}}`,
+			err:   "field rate is not allowed",
+		},
+		{
+			name:  "option that is not allowed",
+			query: `{"selector":{"owner":"x"},"bookmark":"y"}`,
+			err:   "query option bookmark is not allowed",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := n.evaluate(n.producer, func(ctx contractapi.TransactionContextInterface) error {
+				records, err := n.contract.QueryData(ctx, tc.query)
+				if err != nil {
+					return err
+				}
+				require.Equal(t, tc.owners(n), dataOwners(records))
+				return nil
+			})
+			if tc.err != "" {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), tc.err)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+/*
+SPDX-License-Identifier: Apache-2.0
+*/
+
+// Command scenario replays YAML business flows against the yield-commitment contract on an
+// in-memory ledger. Each scenario runs on a fresh channel: the runner prints the outcome of
+// every step, checks it against the expected outcome, and prints the final private state of
+// every collection.
+//
+//	go run ./cmd/scenario cmd/scenario/examples/commitment_sale.yaml
+//
+// A scenario names its clients and the org of each, then lists the steps:
+//
+//	name: Org1 sells a commitment to Org2
+//	clients:
+//	  producer: Org1MSP
+//	  buyer: Org2MSP
+//	steps:
+//	  - name: Org1 creates a commitment
+//	    client: producer
+//	    function: CreateCommitment
+//	    transient:
+//	      commitment_properties: {objectType: commitment, commitmentID: c1, ...}
+//	    expect:
+//	      event: CommitmentCreated
+//	  - name: Org2 reads the commitment
+//	    client: buyer
+//	    function: ReadCommitment
+//	    args: [c1]
+//	    evaluate: true
+//	    expect:
+//	      result: {owner: "${producer.id}"}
+//
+// The command exits with status 1 when a step does not have its expected outcome.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+
+	"github.com/hyperledger/fabric-samples/yield-commitment/chaincode-go/simulator"
+)
+
+func main() {
+	collectionsPath := flag.String("collections", "collections_config.json", "collection configuration of the channel")
+	verbose := flag.Bool("log", false, "print the log of the chaincode")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %v [flags] scenario.yaml...\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	collections, err := simulator.LoadCollections(*collectionsPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading collections: %v\n", err)
+		os.Exit(2)
+	}
+	scenarios := []*Scenario{}
+	for _, path := range flag.Args() {
+		scenario, err := LoadScenario(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading scenario: %v\n", err)
+			os.Exit(2)
+		}
+		scenarios = append(scenarios, scenario)
+	}
+
+	if !*verbose {
+		log.SetOutput(ioutil.Discard)
+	}
+
+	failed := 0
+	for _, scenario := range scenarios {
+		r := newRunner(collections, os.Stdout)
+		failed += r.run(scenario)
+		r.printPrivateState()
+		fmt.Println()
+	}
+
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,352 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/hyperledger/fabric-samples/yield-commitment/chaincode-go/chaincode"
+	"github.com/hyperledger/fabric-samples/yield-commitment/chaincode-go/simulator"
+)
+
+// clientReference matches the ${name.id} and ${name.msp} references to the clients of a scenario
+var clientReference = regexp.MustCompile(`\$\{([^}.]+)\.([^}]+)\}`)
+
+// contextType is the type of the first parameter of every transaction
+var contextType = reflect.TypeOf((*contractapi.TransactionContextInterface)(nil)).Elem()
+
+// runner replays scenarios against a simulated channel and reports to out
+type runner struct {
+	ledger      *simulator.Ledger
+	collections []*simulator.Collection
+	contract    *chaincode.SmartContract
+	clients     map[string]*simulator.Client
+	out         io.Writer
+}
+
+// newRunner returns a runner for a channel with the given private data collections
+func newRunner(collections []*simulator.Collection, out io.Writer) *runner {
+	return &runner{
+		ledger:      simulator.NewLedger(collections),
+		collections: collections,
+		contract:    &chaincode.SmartContract{Topology: simulator.NewTopology(chaincode.DefaultTopology{})},
+		out:         out,
+	}
+}
+
+// run replays the steps of the scenario in order and returns the number of steps whose
+// outcome did not match the expectation. Later steps are run after a failed step.
+func (r *runner) run(scenario *Scenario) int {
+	r.clients = map[string]*simulator.Client{}
+	for name, mspID := range scenario.Clients {
+		r.clients[name] = simulator.NewClient(mspID, name)
+	}
+
+	fmt.Fprintf(r.out, "Scenario: %v\n", scenario.Name)
+	failed := 0
+	for i, step := range scenario.Steps {
+		client := r.clients[step.Client]
+		fmt.Fprintf(r.out, "[%v] %v\n", i+1, step.Name)
+		fmt.Fprintf(r.out, "    %v (%v) %v on an %v peer\n", step.Client, client.MSPID(), step.Function, r.peer(step))
+
+		for _, problem := range r.runStep(step) {
+			fmt.Fprintf(r.out, "    FAIL: %v\n", problem)
+			failed++
+		}
+	}
+	fmt.Fprintf(r.out, "%v steps, %v failed\n", len(scenario.Steps), failed)
+
+	return failed
+}
+
+// peer returns the MSP ID of the peer a step is sent to
+func (r *runner) peer(step *Step) string {
+	if step.Peer != "" {
+		return step.Peer
+	}
+	return r.clients[step.Client].MSPID()
+}
+
+// runStep runs the transaction of a step and returns how its outcome differs from the expectation
+func (r *runner) runStep(step *Step) []string {
+	tx, args, err := r.transaction(step)
+	if err != nil {
+		return []string{err.Error()}
+	}
+
+	var result interface{}
+	invoke := func(ctx contractapi.TransactionContextInterface) error {
+		var err error
+		result, err = r.invoke(ctx, step.Function, args)
+		return err
+	}
+	if step.Evaluate {
+		err = r.ledger.Evaluate(tx, invoke)
+	} else {
+		err = r.ledger.Submit(tx, invoke)
+	}
+
+	if err != nil {
+		fmt.Fprintf(r.out, "    error: %v\n", err)
+		if step.Expect.Error == "" {
+			return []string{"the step was expected to succeed"}
+		}
+		if !strings.Contains(err.Error(), step.Expect.Error) {
+			return []string{fmt.Sprintf("expected an error containing %q", step.Expect.Error)}
+		}
+		return nil
+	}
+
+	problems := []string{}
+	fmt.Fprintf(r.out, "    ok\n")
+	if step.Expect.Error != "" {
+		problems = append(problems, fmt.Sprintf("expected an error containing %q, the step succeeded", step.Expect.Error))
+	}
+
+	if !step.Evaluate {
+		event := ""
+		events := r.ledger.Events()
+		if len(events) > 0 && events[len(events)-1].TxID == tx.GetTxID() {
+			event = events[len(events)-1].Name
+			fmt.Fprintf(r.out, "    event: %v\n", event)
+		}
+		if step.Expect.Event != "" && step.Expect.Event != event {
+			problems = append(problems, fmt.Sprintf("expected event %v", step.Expect.Event))
+		}
+	}
+
+	var actual interface{}
+	if result != nil {
+		resultJSON, err := json.Marshal(result)
+		if err != nil {
+			return append(problems, fmt.Sprintf("failed to marshal result to JSON: %v", err))
+		}
+		fmt.Fprintf(r.out, "    result: %s\n", resultJSON)
+		err = json.Unmarshal(resultJSON, &actual)
+		if err != nil {
+			return append(problems, fmt.Sprintf("failed to unmarshal result: %v", err))
+		}
+	}
+	if step.Expect.Result != nil {
+		expected, err := r.resolve(step.Expect.Result)
+		if err != nil {
+			return append(problems, err.Error())
+		}
+		// Round trip through JSON so that numbers compare as in the result
+		expectedJSON, err := json.Marshal(expected)
+		if err != nil {
+			return append(problems, fmt.Sprintf("failed to marshal expected result to JSON: %v", err))
+		}
+		err = json.Unmarshal(expectedJSON, &expected)
+		if err != nil {
+			return append(problems, fmt.Sprintf("failed to unmarshal expected result: %v", err))
+		}
+		if !matches(expected, actual) {
+			problems = append(problems, fmt.Sprintf("expected result to contain %s", expectedJSON))
+		}
+	}
+
+	return problems
+}
+
+// transaction prepares the transaction of a step and converts its arguments
+func (r *runner) transaction(step *Step) (*simulator.Transaction, []interface{}, error) {
+	if step.Time != "" {
+		timestamp, err := time.Parse(time.RFC3339, step.Time)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to parse time: %v", err)
+		}
+		r.ledger.SetTime(timestamp)
+	}
+
+	args := make([]interface{}, len(step.Args))
+	for i, arg := range step.Args {
+		var err error
+		args[i], err = r.resolve(arg)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	tx := r.ledger.NewTransaction(r.clients[step.Client], step.Function).OnPeer(r.peer(step))
+
+	// Sorted so that transactions of a scenario are built the same on every run
+	keys := []string{}
+	for key := range step.Transient {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		value, err := r.resolve(step.Transient[key])
+		if err != nil {
+			return nil, nil, err
+		}
+		valueJSON, err := toJSON(value)
+		if err != nil {
+			return nil, nil, err
+		}
+		tx.WithTransient(key, valueJSON)
+	}
+
+	return tx, args, nil
+}
+
+// resolve normalizes a yaml value and replaces the client references in its strings
+func (r *runner) resolve(value interface{}) (interface{}, error) {
+	normalized, err := normalize(value)
+	if err != nil {
+		return nil, err
+	}
+	return r.expand(normalized)
+}
+
+// expand replaces the client references in the strings of a normalized value
+func (r *runner) expand(value interface{}) (interface{}, error) {
+	switch value := value.(type) {
+	case string:
+		var err error
+		expanded := clientReference.ReplaceAllStringFunc(value, func(reference string) string {
+			parts := clientReference.FindStringSubmatch(reference)
+			client, ok := r.clients[parts[1]]
+			switch {
+			case ok && parts[2] == "id":
+				return client.ID()
+			case ok && parts[2] == "msp":
+				return client.MSPID()
+			}
+			err = fmt.Errorf("unknown client reference %v", reference)
+			return reference
+		})
+		return expanded, err
+	case map[string]interface{}:
+		for key, item := range value {
+			var err error
+			value[key], err = r.expand(item)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return value, nil
+	case []interface{}:
+		for i, item := range value {
+			var err error
+			value[i], err = r.expand(item)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return value, nil
+	default:
+		return value, nil
+	}
+}
+
+// invoke calls a transaction of the contract by name. String arguments are passed as is to
+// string parameters and parsed as JSON for other parameters, as the contract API does with the
+// arguments of a proposal.
+func (r *runner) invoke(ctx contractapi.TransactionContextInterface, function string, args []interface{}) (interface{}, error) {
+	method := reflect.ValueOf(r.contract).MethodByName(function)
+	if !method.IsValid() || method.Type().NumIn() == 0 || method.Type().In(0) != contextType {
+		return nil, fmt.Errorf("%v is not a transaction of the contract", function)
+	}
+	methodType := method.Type()
+	if methodType.NumIn() != len(args)+1 {
+		return nil, fmt.Errorf("%v takes %v arguments, got %v", function, methodType.NumIn()-1, len(args))
+	}
+
+	in := []reflect.Value{reflect.ValueOf(ctx)}
+	for i, arg := range args {
+		value, err := argumentValue(arg, methodType.In(i+1))
+		if err != nil {
+			return nil, fmt.Errorf("argument %v: %v", i+1, err)
+		}
+		in = append(in, value)
+	}
+
+	out := method.Call(in)
+	if err, _ := out[len(out)-1].Interface().(error); err != nil {
+		return nil, err
+	}
+	if len(out) == 2 && !isNil(out[0]) {
+		return out[0].Interface(), nil
+	}
+	return nil, nil
+}
+
+// argumentValue converts a normalized yaml value to a parameter of the given type
+func argumentValue(arg interface{}, argType reflect.Type) (reflect.Value, error) {
+	value := reflect.New(argType).Elem()
+	text, isString := arg.(string)
+	if isString && argType.Kind() == reflect.String {
+		value.SetString(text)
+		return value, nil
+	}
+
+	argJSON, err := toJSON(arg)
+	if err != nil {
+		return value, err
+	}
+	err = json.Unmarshal(argJSON, value.Addr().Interface())
+	if err != nil {
+		return value, fmt.Errorf("failed to convert %s to %v: %v", argJSON, argType, err)
+	}
+	return value, nil
+}
+
+// isNil reports whether a result is a nil pointer, slice or map
+func isNil(value reflect.Value) bool {
+	switch value.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Map, reflect.Interface:
+		return value.IsNil()
+	}
+	return false
+}
+
+// matches reports whether the actual JSON value contains the expected one: objects match when
+// every expected field matches, arrays when they have the same length and their items match
+func matches(expected interface{}, actual interface{}) bool {
+	switch expected := expected.(type) {
+	case map[string]interface{}:
+		actualObject, ok := actual.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		for key, value := range expected {
+			if !matches(value, actualObject[key]) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		actualArray, ok := actual.([]interface{})
+		if !ok || len(actualArray) != len(expected) {
+			return false
+		}
+		for i, value := range expected {
+			if !matches(value, actualArray[i]) {
+				return false
+			}
+		}
+		return true
+	default:
+		return reflect.DeepEqual(expected, actual)
+	}
+}
+
+// printPrivateState writes the committed keys and values of every collection
+func (r *runner) printPrivateState() {
+	fmt.Fprintf(r.out, "Private state\n")
+	for _, collection := range r.collections {
+		keys := r.ledger.PrivateDataKeys(collection.Name)
+		fmt.Fprintf(r.out, "  %v (%v keys)\n", collection.Name, len(keys))
+		for _, key := range keys {
+			fmt.Fprintf(r.out, "    %q: %s\n", key, r.ledger.PrivateData(collection.Name, key))
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/hyperledger/fabric-samples/yield-commitment/chaincode-go/chaincode"
+	"github.com/hyperledger/fabric-samples/yield-commitment/chaincode-go/simulator"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestRunner(t *testing.T) (*runner, *bytes.Buffer) {
+	collections, err := simulator.LoadCollections("../../collections_config.json")
+	require.NoError(t, err)
+	out := &bytes.Buffer{}
+	return newRunner(collections, out), out
+}
+
+// loadScenarioText writes a scenario to a temporary file and loads it
+func loadScenarioText(t *testing.T, scenarioYAML string) (*Scenario, error) {
+	dir, err := ioutil.TempDir("", "scenario")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "scenario.yaml")
+	require.NoError(t, ioutil.WriteFile(path, []byte(scenarioYAML), 0644))
+	return LoadScenario(path)
+}
+
+func TestExamples(t *testing.T) {
+	paths, err := filepath.Glob("examples/*.yaml")
+	require.NoError(t, err)
+	require.NotEmpty(t, paths)
+
+	for _, path := range paths {
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			scenario, err := LoadScenario(path)
+			require.NoError(t, err)
+
+			r, out := newTestRunner(t)
+			require.Equal(t, 0, r.run(scenario), out.String())
+		})
+	}
+}
+
+func TestLoadScenario(t *testing.T) {
+	_, err := loadScenarioText(t, "clients: {producer: Org1MSP}\nsteps:\n  - client: buyer\n    function: ReadCommitment\n")
+	require.EqualError(t, err, `step 1: unknown client "buyer"`)
+
+	_, err = loadScenarioText(t, "clients: {producer: Org1MSP}\nsteps:\n  - client: producer\n")
+	require.EqualError(t, err, "step 1: function must be a non-empty string")
+
+	_, err = loadScenarioText(t, "clients: {producer: Org1MSP}\nsteps:\n  - client: producer\n    function: ReadCommitment\n    time: tomorrow\n")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "step 1: time must be in RFC 3339 format")
+
+	_, err = loadScenarioText(t, "clients: {producer: Org1MSP}\nsteps:\n  - client: producer\n    function: ReadCommitment\n    expected: {}\n")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "field expected not found")
+}
+
+func TestRunReportsUnexpectedOutcomes(t *testing.T) {
+	scenario, err := loadScenarioText(t, `
+clients:
+  producer: Org1MSP
+steps:
+  - name: succeeds although a failure is expected
+    client: producer
+    function: CreateCommitment
+    transient:
+      commitment_properties: {objectType: commitment, commitmentID: c1, location: Iowa, production: 100, size: 40, crop: corn, rate: 2500, currency: USD, salt: 5e1f07}
+    expect:
+      error: already exists
+      event: CommitmentDeleted
+  - name: fails although success is expected
+    client: producer
+    function: CreateCommitment
+    transient:
+      commitment_properties: {objectType: commitment, commitmentID: c1, location: Iowa, production: 100, size: 40, crop: corn, rate: 2500, currency: USD, salt: 5e1f07}
+  - name: returns another owner
+    client: producer
+    function: ReadCommitment
+    args: [c1]
+    evaluate: true
+    expect:
+      result: {owner: "${producer.id}", production: 200}
+  - name: unknown transaction
+    client: producer
+    function: topology
+  - name: wrong number of arguments
+    client: producer
+    function: ReadCommitment
+    evaluate: true
+  - name: unknown client reference
+    client: producer
+    function: ReadCommitment
+    args: ["${buyer.id}"]
+    evaluate: true
+`)
+	require.NoError(t, err)
+
+	r, out := newTestRunner(t)
+	require.Equal(t, 7, r.run(scenario))
+	require.Contains(t, out.String(), `FAIL: expected an error containing "already exists", the step succeeded`)
+	require.Contains(t, out.String(), "FAIL: expected event CommitmentDeleted")
+	require.Contains(t, out.String(), "FAIL: the step was expected to succeed")
+	require.Contains(t, out.String(), `FAIL: expected result to contain {"owner":"x509::CN=producer,OU=client,O=Org1::CN=ca.org1,O=Org1","production":200}`)
+	require.Contains(t, out.String(), "topology is not a transaction of the contract")
+	require.Contains(t, out.String(), "ReadCommitment takes 1 arguments, got 0")
+	require.Contains(t, out.String(), "FAIL: unknown client reference ${buyer.id}")
+
+	r.printPrivateState()
+	require.Contains(t, out.String(), `"\x00commitment\x00c1\x00": {"objectType":"commitment","commitmentID":"c1"`)
+}
+
+func TestArgumentValue(t *testing.T) {
+	r, _ := newTestRunner(t)
+
+	count, err := argumentValue("25", reflect.TypeOf(0))
+	require.NoError(t, err)
+	require.Equal(t, 25, count.Interface())
+
+	id, err := argumentValue("c1", reflect.TypeOf(""))
+	require.NoError(t, err)
+	require.Equal(t, "c1", id.Interface())
+
+	arg, err := r.resolve(map[interface{}]interface{}{"crop": "corn", "minProduction": 50})
+	require.NoError(t, err)
+	filter, err := argumentValue(arg, reflect.TypeOf(chaincode.CommitmentFilter{}))
+	require.NoError(t, err)
+	require.Equal(t, chaincode.CommitmentFilter{Crop: "corn", MinProduction: 50}, filter.Interface())
+
+	_, err = argumentValue("many", reflect.TypeOf(0))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "failed to convert many to int")
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Scenario is a multi-org business flow, replayed step by step against the simulator
+type Scenario struct {
+	Name string `yaml:"name"`
+	// Clients maps the name of each client of the scenario to the MSP ID of its org
+	Clients map[string]string `yaml:"clients"`
+	Steps   []*Step           `yaml:"steps"`
+}
+
+// Step is a transaction submitted, or evaluated, by one of the clients of the scenario.
+// String values of args, transient and expect.result can reference clients as ${name.id}
+// and ${name.msp}.
+type Step struct {
+	Name   string `yaml:"name"`
+	Client string `yaml:"client"`
+	// Peer is the MSP ID of the org of the peer the transaction is sent to, by default the
+	// org of the client
+	Peer     string        `yaml:"peer"`
+	Function string        `yaml:"function"`
+	Args     []interface{} `yaml:"args"`
+	// Transient are the transient map inputs of the transaction. Strings are passed as is,
+	// other values are marshaled to JSON.
+	Transient map[string]interface{} `yaml:"transient"`
+	// Evaluate runs the transaction as a query, without committing it
+	Evaluate bool `yaml:"evaluate"`
+	// Time is the RFC 3339 timestamp of the transaction, by default a second after the previous one
+	Time   string      `yaml:"time"`
+	Expect Expectation `yaml:"expect"`
+}
+
+// Expectation is the expected outcome of a step. A step without expected error must succeed.
+type Expectation struct {
+	// Error is a part of the expected error message
+	Error string `yaml:"error"`
+	// Result holds the fields expected in the JSON result of the transaction
+	Result interface{} `yaml:"result"`
+	// Event is the name of the expected chaincode event
+	Event string `yaml:"event"`
+}
+
+// LoadScenario reads and validates a YAML scenario file
+func LoadScenario(path string) (*Scenario, error) {
+	scenarioYAML, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read scenario: %v", err)
+	}
+
+	var scenario *Scenario
+	err = yaml.UnmarshalStrict(scenarioYAML, &scenario)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal scenario %v: %v", path, err)
+	}
+	if scenario == nil {
+		return nil, fmt.Errorf("scenario %v is empty", path)
+	}
+	if scenario.Name == "" {
+		scenario.Name = path
+	}
+
+	for i, step := range scenario.Steps {
+		if step.Function == "" {
+			return nil, fmt.Errorf("step %v: function must be a non-empty string", i+1)
+		}
+		if _, ok := scenario.Clients[step.Client]; !ok {
+			return nil, fmt.Errorf("step %v: unknown client %q", i+1, step.Client)
+		}
+		if step.Time != "" {
+			if _, err := time.Parse(time.RFC3339, step.Time); err != nil {
+				return nil, fmt.Errorf("step %v: time must be in RFC 3339 format: %v", i+1, err)
+			}
+		}
+		if step.Evaluate && step.Expect.Event != "" {
+			return nil, fmt.Errorf("step %v: evaluated transactions do not emit events", i+1)
+		}
+	}
+
+	return scenario, nil
+}
+
+// normalize converts the maps decoded by yaml to maps with string keys, so that values can be
+// marshaled to JSON
+func normalize(value interface{}) (interface{}, error) {
+	switch value := value.(type) {
+	case map[interface{}]interface{}:
+		normalized := map[string]interface{}{}
+		for key, item := range value {
+			name, ok := key.(string)
+			if !ok {
+				return nil, fmt.Errorf("map key %v must be a string", key)
+			}
+			var err error
+			normalized[name], err = normalize(item)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return normalized, nil
+	case map[string]interface{}:
+		normalized := map[string]interface{}{}
+		for key, item := range value {
+			var err error
+			normalized[key], err = normalize(item)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return normalized, nil
+	case []interface{}:
+		normalized := make([]interface{}, len(value))
+		for i, item := range value {
+			var err error
+			normalized[i], err = normalize(item)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return normalized, nil
+	default:
+		return value, nil
+	}
+}
+
+// toJSON returns the JSON encoding of a normalized value, strings are returned as is
+func toJSON(value interface{}) ([]byte, error) {
+	if text, ok := value.(string); ok {
+		return []byte(text), nil
+	}
+	valueJSON, err := json.Marshal(value)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal %v to JSON: %v", value, err)
+	}
+	return valueJSON, nil
+}
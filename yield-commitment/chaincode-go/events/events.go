@@ -0,0 +1,78 @@
+// Package events defines the payloads of the chaincode events emitted by the yield
+// commitment chaincode, for use by client applications that listen for them.
+//
+// Each transaction emits at most one event, named after the business action. Payloads
+// carry identifiers, lifecycle states and organization MSP IDs only: rates, terms,
+// quantities and client identities stay in the private data collections.
+package events
+
+// Version is the version of the payload format. It is incremented whenever a field is
+// removed or changes meaning, listeners should ignore events with a version they do
+// not understand.
+const Version = 1
+
+// Event names, as passed to SetEvent
+const (
+	CommitmentCreatedEvent     = "CommitmentCreated"
+	OfferMadeEvent             = "OfferMade"
+	CommitmentTransferredEvent = "CommitmentTransferred"
+	YieldRecordedEvent         = "YieldRecorded"
+	CommitmentDeletedEvent     = "CommitmentDeleted"
+	AgreementWithdrawnEvent    = "AgreementWithdrawn"
+)
+
+// Header is included in every event payload
+type Header struct {
+	Version   int    `json:"version"`
+	TxID      string `json:"txID"`
+	Timestamp string `json:"timestamp"` // RFC3339 time of the transaction
+}
+
+// CommitmentCreated is emitted by CreateCommitment, by PoolCommitments for the lot and by
+// SplitCommitment. A split emits a single event for all of its parts: CommitmentID is the
+// first part, CommitmentIDs lists every part and ParentID is the commitment that was split.
+type CommitmentCreated struct {
+	Header
+	CommitmentID  string   `json:"commitmentID"`
+	CommitmentIDs []string `json:"commitmentIDs,omitempty"`
+	ParentID      string   `json:"parentID,omitempty"`
+	Status        string   `json:"status"`
+	OwnerMSP      string   `json:"ownerMSP"`
+}
+
+// OfferMade is emitted by AgreeToTransfer when a buyer makes or replaces an offer
+type OfferMade struct {
+	Header
+	CommitmentID string `json:"commitmentID"`
+	BuyerMSP     string `json:"buyerMSP"`
+}
+
+// CommitmentTransferred is emitted by TransferCommitment
+type CommitmentTransferred struct {
+	Header
+	CommitmentID string `json:"commitmentID"`
+	SellerMSP    string `json:"sellerMSP"`
+	BuyerMSP     string `json:"buyerMSP"`
+}
+
+// YieldRecorded is emitted by CreateYield. Status is the state of the commitment after the yield.
+type YieldRecorded struct {
+	Header
+	CommitmentID string `json:"commitmentID"`
+	YieldID      string `json:"yieldID"`
+	Status       string `json:"status"`
+}
+
+// CommitmentDeleted is emitted by DeleteCommitment
+type CommitmentDeleted struct {
+	Header
+	CommitmentID string `json:"commitmentID"`
+	OwnerMSP     string `json:"ownerMSP"`
+}
+
+// AgreementWithdrawn is emitted by DeleteTranferAgreement when a buyer withdraws an offer
+type AgreementWithdrawn struct {
+	Header
+	CommitmentID string `json:"commitmentID"`
+	BuyerMSP     string `json:"buyerMSP"`
+}
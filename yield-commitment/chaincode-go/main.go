@@ -2,11 +2,26 @@
 SPDX-License-Identifier: Apache-2.0
 */
 
+// The yield-commitment chaincode is launched by the peer by default. When CHAINCODE_SERVER_ADDRESS
+// is set it runs as an external chaincode service instead, for example in Kubernetes, and the peer
+// connects to it. The service is configured with:
+//
+//	CHAINCODE_SERVER_ADDRESS  address to listen on, e.g. 0.0.0.0:9999
+//	CHAINCODE_ID              package ID of the chaincode, as returned by peer lifecycle chaincode install
+//	CHAINCODE_TLS_KEY         path of the PEM private key of the server, enables TLS together with CHAINCODE_TLS_CERT
+//	CHAINCODE_TLS_CERT        path of the PEM certificate of the server
+//	CHAINCODE_CLIENT_CA_CERT  path of the PEM root CA certificate of the peers, when peers must present client certificates
 package main
 
 import (
+	"fmt"
+	"io/ioutil"
 	"log"
+	"os"
+	"os/signal"
+	"syscall"
 
+	"github.com/hyperledger/fabric-chaincode-go/shim"
 	"github.com/hyperledger/fabric-contract-api-go/contractapi"
 	"github.com/hyperledger/fabric-samples/yield-commitment/chaincode-go/chaincode"
 )
@@ -17,7 +32,95 @@ func main() {
 		log.Panicf("Error creating yield-commitment chaincode: %v", err)
 	}
 
-	if err := commitmentChaincode.Start(); err != nil {
-		log.Panicf("Error starting yield-commitment chaincode: %v", err)
+	address := os.Getenv("CHAINCODE_SERVER_ADDRESS")
+	if address == "" {
+		if err := commitmentChaincode.Start(); err != nil {
+			log.Panicf("Error starting yield-commitment chaincode: %v", err)
+		}
+		return
 	}
+
+	ccid := os.Getenv("CHAINCODE_ID")
+	if ccid == "" {
+		log.Panicf("Error starting yield-commitment chaincode server: CHAINCODE_ID must be set with CHAINCODE_SERVER_ADDRESS")
+	}
+	tlsProps, err := getTLSProperties()
+	if err != nil {
+		log.Panicf("Error starting yield-commitment chaincode server: %v", err)
+	}
+
+	server := &shim.ChaincodeServer{
+		CCID:     ccid,
+		Address:  address,
+		CC:       commitmentChaincode,
+		TLSProps: tlsProps,
+	}
+	if err := serve(server); err != nil {
+		log.Panicf("Error starting yield-commitment chaincode server: %v", err)
+	}
+}
+
+// serve runs the chaincode server until it fails or the process receives SIGTERM or SIGINT.
+// shim.ChaincodeServer has no Stop method, so on a signal serve logs it and returns, and the
+// listener is closed when the process exits. Peers reconnect to the next instance of the service.
+func serve(server *shim.ChaincodeServer) error {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	defer signal.Stop(signals)
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- server.Start()
+	}()
+	log.Printf("Starting yield-commitment chaincode server %v on %v, TLS enabled: %v", server.CCID, server.Address, !server.TLSProps.Disabled)
+
+	select {
+	case err := <-errs:
+		return err
+	case sig := <-signals:
+		log.Printf("Received %v, stopping yield-commitment chaincode server", sig)
+		return nil
+	}
+}
+
+// getTLSProperties reads the TLS key and certificates of the chaincode server. TLS is disabled
+// when neither CHAINCODE_TLS_KEY nor CHAINCODE_TLS_CERT is set.
+func getTLSProperties() (shim.TLSProperties, error) {
+	keyPath := os.Getenv("CHAINCODE_TLS_KEY")
+	certPath := os.Getenv("CHAINCODE_TLS_CERT")
+	clientCACertPath := os.Getenv("CHAINCODE_CLIENT_CA_CERT")
+
+	if keyPath == "" && certPath == "" {
+		if clientCACertPath != "" {
+			return shim.TLSProperties{}, fmt.Errorf("CHAINCODE_CLIENT_CA_CERT requires CHAINCODE_TLS_KEY and CHAINCODE_TLS_CERT")
+		}
+		return shim.TLSProperties{Disabled: true}, nil
+	}
+	if keyPath == "" || certPath == "" {
+		return shim.TLSProperties{}, fmt.Errorf("CHAINCODE_TLS_KEY and CHAINCODE_TLS_CERT must be set together")
+	}
+
+	key, err := ioutil.ReadFile(keyPath)
+	if err != nil {
+		return shim.TLSProperties{}, fmt.Errorf("failed to read TLS key: %v", err)
+	}
+	cert, err := ioutil.ReadFile(certPath)
+	if err != nil {
+		return shim.TLSProperties{}, fmt.Errorf("failed to read TLS certificate: %v", err)
+	}
+
+	var clientCACerts []byte
+	if clientCACertPath != "" {
+		clientCACerts, err = ioutil.ReadFile(clientCACertPath)
+		if err != nil {
+			return shim.TLSProperties{}, fmt.Errorf("failed to read client CA certificate: %v", err)
+		}
+	}
+
+	return shim.TLSProperties{
+		Disabled:      false,
+		Key:           key,
+		Cert:          cert,
+		ClientCACerts: clientCACerts,
+	}, nil
 }
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/hyperledger/fabric-samples/yield-commitment/chaincode-go/chaincode"
+	"github.com/stretchr/testify/require"
+)
+
+var tlsVariables = []string{"CHAINCODE_TLS_KEY", "CHAINCODE_TLS_CERT", "CHAINCODE_CLIENT_CA_CERT"}
+
+// setTLSEnv sets the TLS variables of the environment, unsetting those that are not given, and
+// returns a function that restores their previous values
+func setTLSEnv(t *testing.T, env map[string]string) func() {
+	previous := map[string]*string{}
+	for _, name := range tlsVariables {
+		if value, ok := os.LookupEnv(name); ok {
+			previous[name] = &value
+		} else {
+			previous[name] = nil
+		}
+
+		if value, ok := env[name]; ok {
+			require.NoError(t, os.Setenv(name, value))
+		} else {
+			require.NoError(t, os.Unsetenv(name))
+		}
+	}
+
+	return func() {
+		for name, value := range previous {
+			if value != nil {
+				os.Setenv(name, *value)
+			} else {
+				os.Unsetenv(name)
+			}
+		}
+	}
+}
+
+func TestGetTLSProperties(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tls")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	key := filepath.Join(dir, "server.key")
+	cert := filepath.Join(dir, "server.crt")
+	clientCA := filepath.Join(dir, "ca.crt")
+	missing := filepath.Join(dir, "missing.pem")
+	require.NoError(t, ioutil.WriteFile(key, []byte("key"), 0600))
+	require.NoError(t, ioutil.WriteFile(cert, []byte("cert"), 0644))
+	require.NoError(t, ioutil.WriteFile(clientCA, []byte("ca"), 0644))
+
+	cases := []struct {
+		name     string
+		env      map[string]string
+		expected shim.TLSProperties
+		err      string
+	}{
+		{
+			name:     "TLS disabled",
+			env:      map[string]string{},
+			expected: shim.TLSProperties{Disabled: true},
+		},
+		{
+			name: "key without certificate",
+			env:  map[string]string{"CHAINCODE_TLS_KEY": key},
+			err:  "CHAINCODE_TLS_KEY and CHAINCODE_TLS_CERT must be set together",
+		},
+		{
+			name: "certificate without key",
+			env:  map[string]string{"CHAINCODE_TLS_CERT": cert},
+			err:  "CHAINCODE_TLS_KEY and CHAINCODE_TLS_CERT must be set together",
+		},
+		{
+			name: "client CA without key and certificate",
+			env:  map[string]string{"CHAINCODE_CLIENT_CA_CERT": clientCA},
+			err:  "CHAINCODE_CLIENT_CA_CERT requires CHAINCODE_TLS_KEY and CHAINCODE_TLS_CERT",
+		},
+		{
+			name: "client CA with key only",
+			env:  map[string]string{"CHAINCODE_TLS_KEY": key, "CHAINCODE_CLIENT_CA_CERT": clientCA},
+			err:  "CHAINCODE_TLS_KEY and CHAINCODE_TLS_CERT must be set together",
+		},
+		{
+			name: "unreadable key",
+			env:  map[string]string{"CHAINCODE_TLS_KEY": missing, "CHAINCODE_TLS_CERT": cert},
+			err:  "failed to read TLS key",
+		},
+		{
+			name: "unreadable certificate",
+			env:  map[string]string{"CHAINCODE_TLS_KEY": key, "CHAINCODE_TLS_CERT": missing},
+			err:  "failed to read TLS certificate",
+		},
+		{
+			name: "unreadable client CA",
+			env:  map[string]string{"CHAINCODE_TLS_KEY": key, "CHAINCODE_TLS_CERT": cert, "CHAINCODE_CLIENT_CA_CERT": missing},
+			err:  "failed to read client CA certificate",
+		},
+		{
+			name:     "TLS",
+			env:      map[string]string{"CHAINCODE_TLS_KEY": key, "CHAINCODE_TLS_CERT": cert},
+			expected: shim.TLSProperties{Key: []byte("key"), Cert: []byte("cert")},
+		},
+		{
+			name:     "TLS with client certificates",
+			env:      map[string]string{"CHAINCODE_TLS_KEY": key, "CHAINCODE_TLS_CERT": cert, "CHAINCODE_CLIENT_CA_CERT": clientCA},
+			expected: shim.TLSProperties{Key: []byte("key"), Cert: []byte("cert"), ClientCACerts: []byte("ca")},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			defer setTLSEnv(t, c.env)()
+
+			props, err := getTLSProperties()
+			if c.err != "" {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), c.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, c.expected, props)
+		})
+	}
+}
+
+func TestServeStopsOnSignal(t *testing.T) {
+	// Keep SIGTERM from ending the test process before serve is notified of it
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	cc, err := contractapi.NewChaincode(&chaincode.SmartContract{})
+	require.NoError(t, err)
+	server := &shim.ChaincodeServer{CCID: "yield-commitment:1", Address: "127.0.0.1:0", CC: cc, TLSProps: shim.TLSProperties{Disabled: true}}
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- serve(server)
+	}()
+
+	// serve may not be listening for signals yet, so the signal is repeated until it returns
+	deadline := time.After(5 * time.Second)
+	for {
+		require.NoError(t, syscall.Kill(os.Getpid(), syscall.SIGTERM))
+		select {
+		case err := <-errs:
+			require.NoError(t, err)
+			return
+		case <-deadline:
+			t.Fatal("serve did not return on SIGTERM")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package simulator
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+)
+
+// Collection is a private data collection definition, in the format of collections_config.json
+type Collection struct {
+	Name              string `json:"name"`
+	Policy            string `json:"policy"`
+	RequiredPeerCount int    `json:"requiredPeerCount"`
+	MaxPeerCount      int    `json:"maxPeerCount"`
+	BlockToLive       uint64 `json:"blockToLive"`
+	MemberOnlyRead    bool   `json:"memberOnlyRead"`
+	MemberOnlyWrite   bool   `json:"memberOnlyWrite"`
+
+	members map[string]bool
+}
+
+// policyPrincipal matches the MSP IDs of the principals in a signature policy, such as 'Org1MSP.member'
+var policyPrincipal = regexp.MustCompile(`'([^'.]+)\.(member|peer|client|admin|orderer)'`)
+
+// ParseCollections parses a collection configuration. The members of each collection are the MSP IDs
+// named in its policy.
+func ParseCollections(configJSON []byte) ([]*Collection, error) {
+	var collections []*Collection
+	err := json.Unmarshal(configJSON, &collections)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse collection configuration: %v", err)
+	}
+
+	for _, collection := range collections {
+		if collection.Name == "" {
+			return nil, fmt.Errorf("collection configuration has a collection without a name")
+		}
+		collection.members = map[string]bool{}
+		for _, principal := range policyPrincipal.FindAllStringSubmatch(collection.Policy, -1) {
+			collection.members[principal[1]] = true
+		}
+		if len(collection.members) == 0 {
+			return nil, fmt.Errorf("policy of collection %v names no organization", collection.Name)
+		}
+	}
+	return collections, nil
+}
+
+// LoadCollections reads and parses a collection configuration file, such as collections_config.json
+func LoadCollections(path string) ([]*Collection, error) {
+	configJSON, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read collection configuration: %v", err)
+	}
+	return ParseCollections(configJSON)
+}
+
+// IsMember reports whether the organization is a member of the collection
+func (c *Collection) IsMember(mspID string) bool {
+	return c.members[mspID]
+}
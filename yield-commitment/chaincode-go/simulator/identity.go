@@ -0,0 +1,75 @@
+package simulator
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+// Client is a simulated client identity. It implements cid.ClientIdentity, returning its ID in
+// the base64 encoded x509::<subject>::<issuer> form used by Fabric.
+type Client struct {
+	mspID      string
+	id         string
+	attributes map[string]string
+}
+
+// NewClient returns a client of the organization with the given common name
+func NewClient(mspID string, name string) *Client {
+	org := strings.TrimSuffix(mspID, "MSP")
+	return &Client{
+		mspID:      mspID,
+		id:         fmt.Sprintf("x509::CN=%s,OU=client,O=%s::CN=ca.%s,O=%s", name, org, strings.ToLower(org), org),
+		attributes: map[string]string{},
+	}
+}
+
+// WithAttribute adds a certificate attribute to the client, such as reputation.admin
+func (c *Client) WithAttribute(name string, value string) *Client {
+	c.attributes[name] = value
+	return c
+}
+
+// ID returns the decoded identity of the client, as recorded by the chaincode on commitments
+func (c *Client) ID() string {
+	return c.id
+}
+
+// MSPID returns the MSP ID of the client's organization
+func (c *Client) MSPID() string {
+	return c.mspID
+}
+
+// GetID returns the base64 encoded identity of the client
+func (c *Client) GetID() (string, error) {
+	return base64.StdEncoding.EncodeToString([]byte(c.id)), nil
+}
+
+// GetMSPID returns the MSP ID of the client's organization
+func (c *Client) GetMSPID() (string, error) {
+	return c.mspID, nil
+}
+
+// GetAttributeValue returns the value of a certificate attribute of the client
+func (c *Client) GetAttributeValue(attrName string) (string, bool, error) {
+	value, found := c.attributes[attrName]
+	return value, found, nil
+}
+
+// AssertAttributeValue checks that the client has the certificate attribute with the given value
+func (c *Client) AssertAttributeValue(attrName string, attrValue string) error {
+	value, found := c.attributes[attrName]
+	if !found {
+		return fmt.Errorf("attribute '%s' was not found", attrName)
+	}
+	if value != attrValue {
+		return fmt.Errorf("attribute '%s' equals '%s', not '%s'", attrName, value, attrValue)
+	}
+	return nil
+}
+
+// GetX509Certificate is not supported, simulated clients have no certificate
+func (c *Client) GetX509Certificate() (*x509.Certificate, error) {
+	return nil, fmt.Errorf("simulated client %v has no certificate", c.id)
+}
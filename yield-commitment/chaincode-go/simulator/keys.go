@@ -0,0 +1,73 @@
+package simulator
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	compositeKeyNamespace = "\x00"
+	maxUnicodeRune        = string(utf8.MaxRune)
+)
+
+// createCompositeKey builds a composite key in the format used by the shim
+func createCompositeKey(objectType string, attributes []string) (string, error) {
+	err := validateCompositeKeyAttribute(objectType)
+	if err != nil {
+		return "", err
+	}
+
+	key := compositeKeyNamespace + objectType + compositeKeyNamespace
+	for _, attribute := range attributes {
+		err = validateCompositeKeyAttribute(attribute)
+		if err != nil {
+			return "", err
+		}
+		key += attribute + compositeKeyNamespace
+	}
+	return key, nil
+}
+
+// splitCompositeKey returns the object type and attributes of a composite key
+func splitCompositeKey(compositeKey string) (string, []string, error) {
+	if !strings.HasPrefix(compositeKey, compositeKeyNamespace) || !strings.HasSuffix(compositeKey, compositeKeyNamespace) {
+		return "", nil, fmt.Errorf("%q is not a composite key", compositeKey)
+	}
+
+	components := strings.Split(compositeKey[1:len(compositeKey)-1], compositeKeyNamespace)
+	return components[0], components[1:], nil
+}
+
+func validateCompositeKeyAttribute(attribute string) error {
+	if !utf8.ValidString(attribute) {
+		return fmt.Errorf("not a valid utf8 string: [%x]", attribute)
+	}
+	for _, r := range attribute {
+		if r == 0 || r == utf8.MaxRune {
+			return fmt.Errorf("input contains unicode %#U starting at position [%d]. %#U and %#U are not allowed in the input attribute of a composite key", r, strings.IndexRune(attribute, r), 0, utf8.MaxRune)
+		}
+	}
+	return nil
+}
+
+// validateSimpleKeys rejects composite keys, which cannot be used in range queries
+func validateSimpleKeys(keys ...string) error {
+	for _, key := range keys {
+		if strings.HasPrefix(key, compositeKeyNamespace) {
+			return fmt.Errorf("first character of the key [%s] contains a null character which is not allowed", key)
+		}
+	}
+	return nil
+}
+
+// validateKey checks a key that is written
+func validateKey(key string) error {
+	if key == "" {
+		return fmt.Errorf("key must not be an empty string")
+	}
+	if !utf8.ValidString(key) {
+		return fmt.Errorf("invalid key. Key must be a valid UTF-8 string")
+	}
+	return nil
+}
@@ -0,0 +1,341 @@
+// Package simulator runs chaincode transactions against an in-memory ledger, so that every
+// transaction of the contract can be exercised in plain go test.
+//
+// The ledger keeps the public state and one store per private data collection. Collection
+// membership is taken from the policies of collections_config.json: peers of a member
+// organization read the private values, other peers only see their hashes. Transactions
+// implement both shim.ChaincodeStubInterface and contractapi.TransactionContextInterface,
+// so they can be passed to the contract directly:
+//
+//	ledger, _ := simulator.NewLedgerFromConfig("../collections_config.json")
+//	org1 := simulator.NewClient("Org1MSP", "producer")
+//	tx := ledger.NewTransaction(org1, "CreateCommitment").WithTransient("commitment_properties", properties)
+//	err := ledger.Submit(tx, func(ctx contractapi.TransactionContextInterface) error {
+//		return contract.CreateCommitment(ctx)
+//	})
+//
+// As on a peer, reads return the committed state and ignore the writes of the same
+// transaction, and queries on private data cannot be combined with writes. Contracts that
+// check the peer of a transaction read it through a Topology, see NewTopology.
+package simulator
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/hyperledger/fabric-protos-go/ledger/queryresult"
+)
+
+// DefaultChannel is the channel of a new ledger
+const DefaultChannel = "mychannel"
+
+// Event is a chaincode event of a committed transaction
+type Event struct {
+	TxID    string
+	Name    string
+	Payload []byte
+}
+
+// entry is a committed value with the number of the block that last wrote it
+type entry struct {
+	value      []byte
+	version    uint64
+	validation []byte
+}
+
+// Ledger is the committed state of a simulated channel
+type Ledger struct {
+	mu          sync.Mutex
+	channelID   string
+	collections map[string]*Collection
+	state       map[string]*entry
+	private     map[string]map[string]*entry
+	history     map[string][]*queryresult.KeyModification
+	events      []*Event
+	height      uint64
+	clock       time.Time
+	sequence    uint64
+}
+
+// NewLedger returns an empty ledger with the given private data collections
+func NewLedger(collections []*Collection) *Ledger {
+	ledger := &Ledger{
+		channelID:   DefaultChannel,
+		collections: map[string]*Collection{},
+		state:       map[string]*entry{},
+		private:     map[string]map[string]*entry{},
+		history:     map[string][]*queryresult.KeyModification{},
+		clock:       time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC),
+	}
+	for _, collection := range collections {
+		ledger.collections[collection.Name] = collection
+		ledger.private[collection.Name] = map[string]*entry{}
+	}
+	return ledger
+}
+
+// NewLedgerFromConfig returns an empty ledger with the collections of a collection configuration file
+func NewLedgerFromConfig(path string) (*Ledger, error) {
+	collections, err := LoadCollections(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewLedger(collections), nil
+}
+
+// SetTime sets the timestamp of the next transaction. Each transaction advances the clock by a second.
+func (l *Ledger) SetTime(t time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.clock = t.UTC()
+}
+
+// Now returns the timestamp of the next transaction
+func (l *Ledger) Now() time.Time {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.clock
+}
+
+// Height returns the number of committed transactions
+func (l *Ledger) Height() uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.height
+}
+
+// Collection returns the definition of a private data collection
+func (l *Ledger) Collection(name string) (*Collection, error) {
+	collection, ok := l.collections[name]
+	if !ok {
+		return nil, fmt.Errorf("collection %v is not defined in the collection configuration", name)
+	}
+	return collection, nil
+}
+
+// NewTransaction starts a transaction submitted by the client to a peer of its own organization
+func (l *Ledger) NewTransaction(client *Client, function string, args ...string) *Transaction {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.sequence++
+	var sequence [8]byte
+	binary.BigEndian.PutUint64(sequence[:], l.sequence)
+	txID := sha256.Sum256(sequence[:])
+
+	timestamp := l.clock
+	l.clock = l.clock.Add(time.Second)
+
+	return &Transaction{
+		ledger:    l,
+		client:    client,
+		peerMSP:   client.MSPID(),
+		txID:      hex.EncodeToString(txID[:]),
+		timestamp: timestamp,
+		function:  function,
+		args:      args,
+		transient: map[string][]byte{},
+		reads:     map[string]map[string]uint64{},
+		writes:    map[string]map[string]*write{},
+	}
+}
+
+// Evaluate runs a transaction on its peer without committing it, as a client query does
+func (l *Ledger) Evaluate(tx *Transaction, invoke func(ctx contractapi.TransactionContextInterface) error) error {
+	return invoke(tx)
+}
+
+// Submit runs a transaction on its peer and commits it if it succeeds
+func (l *Ledger) Submit(tx *Transaction, invoke func(ctx contractapi.TransactionContextInterface) error) error {
+	err := l.Evaluate(tx, invoke)
+	if err != nil {
+		return err
+	}
+	return l.Commit(tx)
+}
+
+// Commit validates the read set of a transaction against the committed state and applies its
+// writes. A transaction that read a key written since fails with an MVCC conflict.
+func (l *Ledger) Commit(tx *Transaction) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if tx.committed {
+		return fmt.Errorf("transaction %v has already been committed", tx.txID)
+	}
+
+	for namespace, keys := range tx.reads {
+		store := l.store(namespace)
+		for key, version := range keys {
+			if currentVersion(store, key) != version {
+				return fmt.Errorf("transaction %v failed with MVCC_READ_CONFLICT on key %q of %v", tx.txID, key, namespaceName(namespace))
+			}
+		}
+	}
+
+	l.height++
+	timestamp := &timestamp.Timestamp{Seconds: tx.timestamp.Unix(), Nanos: int32(tx.timestamp.Nanosecond())}
+	for namespace, keys := range tx.writes {
+		store := l.store(namespace)
+		for _, key := range sortedKeys(keys) {
+			w := keys[key]
+			existing := store[key]
+			if w.valueWritten {
+				if w.deleted {
+					delete(store, key)
+				} else {
+					validation := []byte(nil)
+					if existing != nil {
+						validation = existing.validation
+					}
+					existing = &entry{value: w.value, validation: validation}
+					store[key] = existing
+				}
+				if namespace == publicNamespace {
+					l.history[key] = append(l.history[key], &queryresult.KeyModification{
+						TxId:      tx.txID,
+						Value:     w.value,
+						Timestamp: timestamp,
+						IsDelete:  w.deleted,
+					})
+				}
+			}
+			if w.validationWritten && existing != nil && !w.deleted {
+				existing.validation = w.validation
+			}
+			if existing != nil && !w.deleted {
+				existing.version = l.height
+			}
+		}
+	}
+
+	if tx.event != nil {
+		l.events = append(l.events, tx.event)
+	}
+	tx.committed = true
+	return nil
+}
+
+// Events returns the chaincode events of the committed transactions, in commit order
+func (l *Ledger) Events() []*Event {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]*Event{}, l.events...)
+}
+
+// State returns the committed public value of a key, or nil if it does not exist
+func (l *Ledger) State(key string) []byte {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if e, ok := l.state[key]; ok {
+		return e.value
+	}
+	return nil
+}
+
+// PrivateData returns the committed value of a key in a collection, or nil if it does not exist.
+// Unlike GetPrivateData, it does not check membership, so tests can inspect any collection.
+func (l *Ledger) PrivateData(collection string, key string) []byte {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if e, ok := l.private[collection][key]; ok {
+		return e.value
+	}
+	return nil
+}
+
+// PrivateDataKeys returns the committed keys of a collection in key order
+func (l *Ledger) PrivateDataKeys(collection string) []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	keys := []string{}
+	for key := range l.private[collection] {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// publicNamespace is the namespace of the public state in read and write sets. Private
+// data is kept under the name of its collection.
+const publicNamespace = ""
+
+func namespaceName(namespace string) string {
+	if namespace == publicNamespace {
+		return "the public state"
+	}
+	return "collection " + namespace
+}
+
+// store returns the committed entries of a namespace. The caller holds the lock.
+func (l *Ledger) store(namespace string) map[string]*entry {
+	if namespace == publicNamespace {
+		return l.state
+	}
+	return l.private[namespace]
+}
+
+// get returns the committed entry of a key, or nil if it does not exist
+func (l *Ledger) get(namespace string, key string) *entry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.store(namespace)[key]
+}
+
+// scan returns the committed entries of a namespace whose keys are in [startKey, endKey), in key
+// order. An empty endKey leaves the range open.
+func (l *Ledger) scan(namespace string, startKey string, endKey string) ([]string, []*entry) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	store := l.store(namespace)
+	keys := []string{}
+	for key := range store {
+		if key >= startKey && (endKey == "" || key < endKey) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	entries := make([]*entry, len(keys))
+	for i, key := range keys {
+		entries[i] = store[key]
+	}
+	return keys, entries
+}
+
+// keyHistory returns the modifications of a public key, most recent first
+func (l *Ledger) keyHistory(key string) []*queryresult.KeyModification {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	modifications := l.history[key]
+	results := make([]*queryresult.KeyModification, len(modifications))
+	for i, modification := range modifications {
+		results[len(modifications)-1-i] = modification
+	}
+	return results
+}
+
+func currentVersion(store map[string]*entry, key string) uint64 {
+	if e, ok := store[key]; ok {
+		return e.version
+	}
+	return 0
+}
+
+func sortedKeys(writes map[string]*write) []string {
+	keys := make([]string, 0, len(writes))
+	for key := range writes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,404 @@
+package simulator
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// richQuery is a CouchDB query, as passed to GetQueryResult and GetPrivateDataQueryResult
+type richQuery struct {
+	Selector map[string]interface{} `json:"selector"`
+	Sort     []interface{}          `json:"sort"`
+	Fields   []string               `json:"fields"`
+	Skip     int                    `json:"skip"`
+	Limit    int                    `json:"limit"`
+	UseIndex interface{}            `json:"use_index"`
+	Bookmark string                 `json:"bookmark"`
+}
+
+// sortField is one field of the sort order of a query
+type sortField struct {
+	path       string
+	descending bool
+}
+
+// document is a stored JSON value together with its key
+type document struct {
+	key   string
+	value []byte
+	body  map[string]interface{}
+}
+
+// parseRichQuery parses a CouchDB query. The limit is ignored, as it is by Fabric for queries
+// that are not paginated.
+func parseRichQuery(query string) (*richQuery, []sortField, error) {
+	var parsed richQuery
+	err := json.Unmarshal([]byte(query), &parsed)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse query: %v", err)
+	}
+	if parsed.Selector == nil {
+		return nil, nil, fmt.Errorf("query %v has no selector", query)
+	}
+	if parsed.Skip < 0 {
+		return nil, nil, fmt.Errorf("skip of query %v must not be negative", query)
+	}
+
+	var order []sortField
+	for _, field := range parsed.Sort {
+		switch field := field.(type) {
+		case string:
+			order = append(order, sortField{path: field})
+		case map[string]interface{}:
+			if len(field) != 1 {
+				return nil, nil, fmt.Errorf("sort field %v must name a single field", field)
+			}
+			for path, direction := range field {
+				switch direction {
+				case "asc":
+					order = append(order, sortField{path: path})
+				case "desc":
+					order = append(order, sortField{path: path, descending: true})
+				default:
+					return nil, nil, fmt.Errorf("sort direction of %v must be asc or desc", path)
+				}
+			}
+		default:
+			return nil, nil, fmt.Errorf("sort field %v must be a field name or an object", field)
+		}
+	}
+	return &parsed, order, nil
+}
+
+// execute returns the documents that match the query in its sort order, followed by key order
+func (q *richQuery) execute(documents []*document, order []sortField) ([]*document, error) {
+	matches := []*document{}
+	for _, doc := range documents {
+		if doc.body == nil {
+			continue
+		}
+		match, err := matchSelector(q.Selector, doc.body)
+		if err != nil {
+			return nil, err
+		}
+		if match {
+			matches = append(matches, doc)
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		for _, field := range order {
+			a, _ := lookupField(matches[i].body, field.path)
+			b, _ := lookupField(matches[j].body, field.path)
+			c := compareValues(a, b)
+			if c == 0 {
+				continue
+			}
+			if field.descending {
+				return c > 0
+			}
+			return c < 0
+		}
+		return false
+	})
+
+	if q.Skip >= len(matches) {
+		return []*document{}, nil
+	}
+	return matches[q.Skip:], nil
+}
+
+// project returns the value of a document restricted to the query fields
+func (q *richQuery) project(doc *document) ([]byte, error) {
+	if len(q.Fields) == 0 {
+		return doc.value, nil
+	}
+
+	projection := map[string]interface{}{}
+	for _, path := range q.Fields {
+		value, ok := lookupField(doc.body, path)
+		if !ok {
+			continue
+		}
+		target := projection
+		parts := strings.Split(path, ".")
+		for _, part := range parts[:len(parts)-1] {
+			next, ok := target[part].(map[string]interface{})
+			if !ok {
+				next = map[string]interface{}{}
+				target[part] = next
+			}
+			target = next
+		}
+		target[parts[len(parts)-1]] = value
+	}
+	return json.Marshal(projection)
+}
+
+// parseDocument decodes a stored value, returning a nil body for values that are not JSON objects
+func parseDocument(key string, value []byte) *document {
+	doc := &document{key: key, value: value}
+	decoder := json.NewDecoder(bytes.NewReader(value))
+	var body map[string]interface{}
+	if decoder.Decode(&body) == nil {
+		doc.body = body
+	}
+	return doc
+}
+
+// lookupField returns the value at a dotted field path
+func lookupField(body map[string]interface{}, path string) (interface{}, bool) {
+	var current interface{} = body
+	for _, part := range strings.Split(path, ".") {
+		object, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		current, ok = object[part]
+		if !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// matchSelector reports whether a document matches a selector
+func matchSelector(selector map[string]interface{}, body map[string]interface{}) (bool, error) {
+	for name, condition := range selector {
+		var match bool
+		var err error
+		if strings.HasPrefix(name, "$") {
+			match, err = matchCombination(name, condition, body)
+		} else {
+			value, found := lookupField(body, name)
+			match, err = matchCondition(name, condition, value, found, body)
+		}
+		if err != nil || !match {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// matchCombination evaluates $and, $or, $nor and $not at the top level of a selector
+func matchCombination(operator string, operand interface{}, body map[string]interface{}) (bool, error) {
+	if operator == "$not" {
+		selector, ok := operand.(map[string]interface{})
+		if !ok {
+			return false, fmt.Errorf("operand of $not must be a selector")
+		}
+		match, err := matchSelector(selector, body)
+		return !match, err
+	}
+
+	selectors, ok := operand.([]interface{})
+	if !ok {
+		return false, fmt.Errorf("operand of %v must be an array of selectors", operator)
+	}
+	matches := 0
+	for _, selector := range selectors {
+		selector, ok := selector.(map[string]interface{})
+		if !ok {
+			return false, fmt.Errorf("operand of %v must be an array of selectors", operator)
+		}
+		match, err := matchSelector(selector, body)
+		if err != nil {
+			return false, err
+		}
+		if match {
+			matches++
+		}
+	}
+
+	switch operator {
+	case "$and":
+		return matches == len(selectors), nil
+	case "$or":
+		return matches > 0, nil
+	case "$nor":
+		return matches == 0, nil
+	}
+	return false, fmt.Errorf("unsupported combination operator %v", operator)
+}
+
+// matchCondition evaluates the condition on a field. A condition that is not an object of
+// operators is an implicit $eq, and an object without operators selects nested fields.
+func matchCondition(field string, condition interface{}, value interface{}, found bool, body map[string]interface{}) (bool, error) {
+	operators, ok := condition.(map[string]interface{})
+	if !ok {
+		return found && compareValues(value, condition) == 0, nil
+	}
+	if !hasOperators(operators) {
+		nested, ok := value.(map[string]interface{})
+		if !ok {
+			return false, nil
+		}
+		return matchSelector(operators, nested)
+	}
+
+	for operator, operand := range operators {
+		match, err := matchOperator(field, operator, operand, value, found, body)
+		if err != nil || !match {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func hasOperators(condition map[string]interface{}) bool {
+	for name := range condition {
+		if strings.HasPrefix(name, "$") {
+			return true
+		}
+	}
+	return false
+}
+
+// matchOperator evaluates a single condition operator on a field value
+func matchOperator(field string, operator string, operand interface{}, value interface{}, found bool, body map[string]interface{}) (bool, error) {
+	switch operator {
+	case "$exists":
+		exists, ok := operand.(bool)
+		if !ok {
+			return false, fmt.Errorf("operand of $exists on %v must be a boolean", field)
+		}
+		return found == exists, nil
+	case "$ne":
+		return !found || compareValues(value, operand) != 0, nil
+	case "$nin":
+		values, ok := operand.([]interface{})
+		if !ok {
+			return false, fmt.Errorf("operand of $nin on %v must be an array", field)
+		}
+		return !found || !containsValue(values, value), nil
+	case "$not":
+		match, err := matchCondition(field, operand, value, found, body)
+		return !match, err
+	}
+
+	if !found {
+		return false, nil
+	}
+
+	switch operator {
+	case "$eq":
+		return compareValues(value, operand) == 0, nil
+	case "$gt", "$gte", "$lt", "$lte":
+		// CouchDB only compares values of the same type
+		if typeRank(value) != typeRank(operand) {
+			return false, nil
+		}
+		c := compareValues(value, operand)
+		switch operator {
+		case "$gt":
+			return c > 0, nil
+		case "$gte":
+			return c >= 0, nil
+		case "$lt":
+			return c < 0, nil
+		default:
+			return c <= 0, nil
+		}
+	case "$in":
+		values, ok := operand.([]interface{})
+		if !ok {
+			return false, fmt.Errorf("operand of $in on %v must be an array", field)
+		}
+		return containsValue(values, value), nil
+	case "$regex":
+		pattern, ok := operand.(string)
+		if !ok {
+			return false, fmt.Errorf("operand of $regex on %v must be a string", field)
+		}
+		expression, err := regexp.Compile(pattern)
+		if err != nil {
+			return false, fmt.Errorf("invalid $regex on %v: %v", field, err)
+		}
+		text, ok := value.(string)
+		return ok && expression.MatchString(text), nil
+	case "$size":
+		size, ok := operand.(float64)
+		if !ok {
+			return false, fmt.Errorf("operand of $size on %v must be a number", field)
+		}
+		array, ok := value.([]interface{})
+		return ok && float64(len(array)) == size, nil
+	}
+	return false, fmt.Errorf("unsupported operator %v on %v", operator, field)
+}
+
+func containsValue(values []interface{}, value interface{}) bool {
+	for _, candidate := range values {
+		if compareValues(value, candidate) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// typeRank orders JSON types as CouchDB collates them
+func typeRank(value interface{}) int {
+	switch value.(type) {
+	case nil:
+		return 0
+	case bool:
+		return 1
+	case float64:
+		return 2
+	case string:
+		return 3
+	case []interface{}:
+		return 4
+	default:
+		return 5
+	}
+}
+
+// compareValues compares two JSON values in CouchDB collation order
+func compareValues(a interface{}, b interface{}) int {
+	rankA, rankB := typeRank(a), typeRank(b)
+	if rankA != rankB {
+		return rankA - rankB
+	}
+
+	switch a := a.(type) {
+	case bool:
+		b := b.(bool)
+		if a == b {
+			return 0
+		}
+		if !a {
+			return -1
+		}
+		return 1
+	case float64:
+		b := b.(float64)
+		if a < b {
+			return -1
+		}
+		if a > b {
+			return 1
+		}
+		return 0
+	case string:
+		return strings.Compare(a, b.(string))
+	case []interface{}:
+		b := b.([]interface{})
+		for i := 0; i < len(a) && i < len(b); i++ {
+			c := compareValues(a[i], b[i])
+			if c != 0 {
+				return c
+			}
+		}
+		return len(a) - len(b)
+	case map[string]interface{}:
+		aJSON, _ := json.Marshal(a)
+		bJSON, _ := json.Marshal(b)
+		return bytes.Compare(aJSON, bJSON)
+	}
+	return 0
+}
@@ -0,0 +1,238 @@
+package simulator
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"testing"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestLedger(t *testing.T) *Ledger {
+	ledger, err := NewLedgerFromConfig("../collections_config.json")
+	require.NoError(t, err)
+	return ledger
+}
+
+func put(collection string, key string, value string) func(ctx contractapi.TransactionContextInterface) error {
+	return func(ctx contractapi.TransactionContextInterface) error {
+		return ctx.GetStub().PutPrivateData(collection, key, []byte(value))
+	}
+}
+
+func TestCollectionMembershipFromConfig(t *testing.T) {
+	ledger := newTestLedger(t)
+
+	shared, err := ledger.Collection("commitmentCollection")
+	require.NoError(t, err)
+	require.True(t, shared.IsMember("Org1MSP"))
+	require.True(t, shared.IsMember("Org2MSP"))
+
+	org1, err := ledger.Collection("Org1MSPPrivateCollection")
+	require.NoError(t, err)
+	require.True(t, org1.IsMember("Org1MSP"))
+	require.False(t, org1.IsMember("Org2MSP"))
+	require.False(t, org1.MemberOnlyWrite)
+
+	_, err = ledger.Collection("missingCollection")
+	require.Error(t, err)
+}
+
+func TestNonMembersOnlySeeHashes(t *testing.T) {
+	ledger := newTestLedger(t)
+	org1 := NewClient("Org1MSP", "alice")
+	org2 := NewClient("Org2MSP", "bob")
+
+	err := ledger.Submit(ledger.NewTransaction(org1, "Put"), put("Org1MSPPrivateCollection", "k", "secret"))
+	require.NoError(t, err)
+
+	err = ledger.Evaluate(ledger.NewTransaction(org2, "Get").OnPeer("Org2MSP"), func(ctx contractapi.TransactionContextInterface) error {
+		_, err := ctx.GetStub().GetPrivateData("Org1MSPPrivateCollection", "k")
+		require.Error(t, err)
+
+		hash, err := ctx.GetStub().GetPrivateDataHash("Org1MSPPrivateCollection", "k")
+		require.NoError(t, err)
+		expected := sha256.Sum256([]byte("secret"))
+		require.Equal(t, expected[:], hash)
+		return nil
+	})
+	require.NoError(t, err)
+
+	// Org1MSPPrivateCollection is memberOnlyRead, so an Org2 client cannot read it on an Org1 peer either
+	err = ledger.Evaluate(ledger.NewTransaction(org2, "Get").OnPeer("Org1MSP"), func(ctx contractapi.TransactionContextInterface) error {
+		_, err := ctx.GetStub().GetPrivateData("Org1MSPPrivateCollection", "k")
+		return err
+	})
+	require.Error(t, err)
+}
+
+func TestReadsReturnCommittedState(t *testing.T) {
+	ledger := newTestLedger(t)
+	org1 := NewClient("Org1MSP", "alice")
+
+	err := ledger.Submit(ledger.NewTransaction(org1, "Put"), func(ctx contractapi.TransactionContextInterface) error {
+		err := ctx.GetStub().PutPrivateData("commitmentCollection", "k", []byte("v1"))
+		require.NoError(t, err)
+
+		value, err := ctx.GetStub().GetPrivateData("commitmentCollection", "k")
+		require.NoError(t, err)
+		require.Nil(t, value)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, []byte("v1"), ledger.PrivateData("commitmentCollection", "k"))
+}
+
+func TestPrivateQueriesCannotBeCombinedWithWrites(t *testing.T) {
+	ledger := newTestLedger(t)
+	org1 := NewClient("Org1MSP", "alice")
+
+	err := ledger.Evaluate(ledger.NewTransaction(org1, "WriteThenQuery"), func(ctx contractapi.TransactionContextInterface) error {
+		require.NoError(t, ctx.GetStub().PutPrivateData("commitmentCollection", "k", []byte("v")))
+		_, err := ctx.GetStub().GetPrivateDataByRange("commitmentCollection", "", "")
+		return err
+	})
+	require.Error(t, err)
+
+	err = ledger.Evaluate(ledger.NewTransaction(org1, "QueryThenWrite"), func(ctx contractapi.TransactionContextInterface) error {
+		_, err := ctx.GetStub().GetPrivateDataQueryResult("commitmentCollection", `{"selector":{}}`)
+		require.NoError(t, err)
+		return ctx.GetStub().PutPrivateData("commitmentCollection", "k", []byte("v"))
+	})
+	require.Error(t, err)
+}
+
+func TestConflictingTransactionsFailMVCC(t *testing.T) {
+	ledger := newTestLedger(t)
+	org1 := NewClient("Org1MSP", "alice")
+
+	readAndWrite := func(ctx contractapi.TransactionContextInterface) error {
+		_, err := ctx.GetStub().GetPrivateData("commitmentCollection", "k")
+		require.NoError(t, err)
+		return ctx.GetStub().PutPrivateData("commitmentCollection", "k", []byte(ctx.GetStub().GetTxID()))
+	}
+
+	first := ledger.NewTransaction(org1, "First")
+	second := ledger.NewTransaction(org1, "Second")
+	require.NoError(t, ledger.Evaluate(first, readAndWrite))
+	require.NoError(t, ledger.Evaluate(second, readAndWrite))
+	require.NoError(t, ledger.Commit(first))
+	require.Error(t, ledger.Commit(second))
+}
+
+func TestCompositeKeysAndRichQueries(t *testing.T) {
+	ledger := newTestLedger(t)
+	org1 := NewClient("Org1MSP", "alice")
+
+	documents := map[string]string{
+		"a": `{"objectType":"commitment","crop":"corn","production":10}`,
+		"b": `{"objectType":"commitment","crop":"wheat","production":30}`,
+		"c": `{"objectType":"commitment","crop":"corn","production":20}`,
+	}
+	err := ledger.Submit(ledger.NewTransaction(org1, "Put"), func(ctx contractapi.TransactionContextInterface) error {
+		for id, value := range documents {
+			key, err := ctx.GetStub().CreateCompositeKey("commitment", []string{id})
+			require.NoError(t, err)
+			require.NoError(t, ctx.GetStub().PutPrivateData("commitmentCollection", key, []byte(value)))
+		}
+		return nil
+	})
+	require.NoError(t, err)
+
+	err = ledger.Evaluate(ledger.NewTransaction(org1, "Query"), func(ctx contractapi.TransactionContextInterface) error {
+		iterator, err := ctx.GetStub().GetPrivateDataByPartialCompositeKey("commitmentCollection", "commitment", []string{})
+		require.NoError(t, err)
+		ids := []string{}
+		for iterator.HasNext() {
+			result, err := iterator.Next()
+			require.NoError(t, err)
+			_, attributes, err := ctx.GetStub().SplitCompositeKey(result.Key)
+			require.NoError(t, err)
+			ids = append(ids, attributes[0])
+		}
+		require.Equal(t, []string{"a", "b", "c"}, ids)
+
+		// Simple key ranges exclude composite keys
+		iterator, err = ctx.GetStub().GetPrivateDataByRange("commitmentCollection", "", "")
+		require.NoError(t, err)
+		require.False(t, iterator.HasNext())
+
+		iterator, err = ctx.GetStub().GetPrivateDataQueryResult("commitmentCollection",
+			`{"selector":{"crop":"corn","production":{"$gte":10}},"sort":[{"production":"desc"}],"fields":["production"]}`)
+		require.NoError(t, err)
+		values := []string{}
+		for iterator.HasNext() {
+			result, err := iterator.Next()
+			require.NoError(t, err)
+			values = append(values, string(result.Value))
+		}
+		require.Equal(t, []string{`{"production":20}`, `{"production":10}`}, values)
+		return nil
+	})
+	require.NoError(t, err)
+}
+
+func TestOnlyTheLastEventIsEmitted(t *testing.T) {
+	ledger := newTestLedger(t)
+	org1 := NewClient("Org1MSP", "alice")
+
+	tx := ledger.NewTransaction(org1, "Emit")
+	err := ledger.Submit(tx, func(ctx contractapi.TransactionContextInterface) error {
+		require.NoError(t, ctx.GetStub().SetEvent("First", []byte("1")))
+		return ctx.GetStub().SetEvent("Second", []byte("2"))
+	})
+	require.NoError(t, err)
+	require.Equal(t, []*Event{{TxID: tx.GetTxID(), Name: "Second", Payload: []byte("2")}}, ledger.Events())
+}
+
+func TestClientIdentity(t *testing.T) {
+	client := NewClient("Org1MSP", "alice").WithAttribute("reputation.admin", "true")
+
+	id, err := client.GetID()
+	require.NoError(t, err)
+	decoded, err := base64.StdEncoding.DecodeString(id)
+	require.NoError(t, err)
+	require.Equal(t, client.ID(), string(decoded))
+
+	require.NoError(t, client.AssertAttributeValue("reputation.admin", "true"))
+	require.Error(t, client.AssertAttributeValue("reputation.admin", "false"))
+	_, found, err := client.GetAttributeValue("missing")
+	require.NoError(t, err)
+	require.False(t, found)
+}
+
+// envTopology stands for the topology of a contract, which reads the peer from the environment
+type envTopology struct{}
+
+func (envTopology) PeerMSPID(ctx contractapi.TransactionContextInterface) (string, error) {
+	return "EnvMSP", nil
+}
+
+func (envTopology) OrgCollection(mspID string) string {
+	return mspID + "PrivateCollection"
+}
+
+func (envTopology) ClientID(ctx contractapi.TransactionContextInterface) (string, error) {
+	return "client", nil
+}
+
+func TestTopologyReportsThePeerOfEachTransaction(t *testing.T) {
+	ledger := newTestLedger(t)
+	topology := NewTopology(envTopology{})
+	org1 := NewClient("Org1MSP", "alice")
+
+	peerMSPID, err := topology.PeerMSPID(ledger.NewTransaction(org1, "query"))
+	require.NoError(t, err)
+	require.Equal(t, "Org1MSP", peerMSPID)
+
+	peerMSPID, err = topology.PeerMSPID(ledger.NewTransaction(org1, "query").OnPeer("Org2MSP"))
+	require.NoError(t, err)
+	require.Equal(t, "Org2MSP", peerMSPID)
+
+	// Collections and client identities are left to the wrapped topology
+	require.Equal(t, "Org1MSPPrivateCollection", topology.OrgCollection("Org1MSP"))
+	clientID, err := topology.ClientID(ledger.NewTransaction(org1, "query"))
+	require.NoError(t, err)
+	require.Equal(t, "client", clientID)
+}
@@ -0,0 +1,38 @@
+package simulator
+
+import (
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+)
+
+// topology is the method set of the contract's Topology, which the simulator does not import
+type topology interface {
+	PeerMSPID(ctx contractapi.TransactionContextInterface) (string, error)
+	OrgCollection(mspID string) string
+	ClientID(ctx contractapi.TransactionContextInterface) (string, error)
+}
+
+// Topology is a contract topology for simulated transactions. A chaincode process runs for a
+// single peer, whose MSP ID the contract reads from the environment, while the simulator runs
+// the transactions of every peer in one process. Topology reports the peer of each transaction
+// instead and leaves collections and client identities to the topology it wraps:
+//
+//	contract := &chaincode.SmartContract{Topology: simulator.NewTopology(chaincode.DefaultTopology{})}
+type Topology struct {
+	topology
+}
+
+// NewTopology wraps the topology of a contract for simulated transactions
+func NewTopology(base topology) *Topology {
+	return &Topology{topology: base}
+}
+
+// PeerMSPID returns the MSP ID of the organization of the peer the transaction is sent to
+func (t *Topology) PeerMSPID(ctx contractapi.TransactionContextInterface) (string, error) {
+	tx, ok := ctx.GetStub().(*Transaction)
+	if !ok {
+		return "", fmt.Errorf("transaction %v is not simulated", ctx.GetStub().GetTxID())
+	}
+	return tx.PeerMSPID(), nil
+}
@@ -0,0 +1,632 @@
+package simulator
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"time"
+
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/hyperledger/fabric-chaincode-go/pkg/cid"
+	"github.com/hyperledger/fabric-chaincode-go/shim"
+	"github.com/hyperledger/fabric-contract-api-go/contractapi"
+	"github.com/hyperledger/fabric-protos-go/ledger/queryresult"
+	pb "github.com/hyperledger/fabric-protos-go/peer"
+)
+
+var (
+	_ shim.ChaincodeStubInterface             = (*Transaction)(nil)
+	_ contractapi.TransactionContextInterface = (*Transaction)(nil)
+	_ cid.ClientIdentity                      = (*Client)(nil)
+)
+
+// write is a staged update of a key
+type write struct {
+	value             []byte
+	deleted           bool
+	valueWritten      bool
+	validation        []byte
+	validationWritten bool
+}
+
+// Transaction is a transaction being simulated on a peer. It is both the stub and the
+// transaction context passed to the contract.
+type Transaction struct {
+	ledger    *Ledger
+	client    *Client
+	peerMSP   string
+	txID      string
+	timestamp time.Time
+	function  string
+	args      []string
+	transient map[string][]byte
+
+	reads  map[string]map[string]uint64
+	writes map[string]map[string]*write
+	event  *Event
+
+	writePerformed          bool
+	privateQueryPerformed   bool
+	paginatedQueryPerformed bool
+	committed               bool
+}
+
+// WithTransient adds a value to the transient map of the transaction
+func (tx *Transaction) WithTransient(key string, value []byte) *Transaction {
+	tx.transient[key] = value
+	return tx
+}
+
+// OnPeer sends the transaction to a peer of the given organization instead of the client's own
+func (tx *Transaction) OnPeer(mspID string) *Transaction {
+	tx.peerMSP = mspID
+	return tx
+}
+
+// PeerMSPID returns the MSP ID of the organization of the peer the transaction is sent to
+func (tx *Transaction) PeerMSPID() string {
+	return tx.peerMSP
+}
+
+// GetStub returns the transaction itself, which implements the chaincode stub
+func (tx *Transaction) GetStub() shim.ChaincodeStubInterface {
+	return tx
+}
+
+// GetClientIdentity returns the client that submitted the transaction
+func (tx *Transaction) GetClientIdentity() cid.ClientIdentity {
+	return tx.client
+}
+
+// GetArgs returns the function name followed by the arguments of the transaction
+func (tx *Transaction) GetArgs() [][]byte {
+	args := [][]byte{[]byte(tx.function)}
+	for _, arg := range tx.args {
+		args = append(args, []byte(arg))
+	}
+	return args
+}
+
+// GetStringArgs returns the function name followed by the arguments of the transaction
+func (tx *Transaction) GetStringArgs() []string {
+	return append([]string{tx.function}, tx.args...)
+}
+
+// GetFunctionAndParameters returns the function name and the arguments of the transaction
+func (tx *Transaction) GetFunctionAndParameters() (string, []string) {
+	return tx.function, append([]string{}, tx.args...)
+}
+
+// GetArgsSlice returns the arguments of the transaction concatenated
+func (tx *Transaction) GetArgsSlice() ([]byte, error) {
+	slice := []byte{}
+	for _, arg := range tx.GetArgs() {
+		slice = append(slice, arg...)
+	}
+	return slice, nil
+}
+
+// GetTxID returns the ID of the transaction
+func (tx *Transaction) GetTxID() string {
+	return tx.txID
+}
+
+// GetChannelID returns the channel of the ledger
+func (tx *Transaction) GetChannelID() string {
+	return tx.ledger.channelID
+}
+
+// InvokeChaincode is not supported, the simulator runs a single chaincode
+func (tx *Transaction) InvokeChaincode(chaincodeName string, args [][]byte, channel string) pb.Response {
+	return shim.Error(fmt.Sprintf("cannot invoke chaincode %v: the simulator does not support chaincode to chaincode calls", chaincodeName))
+}
+
+// GetState returns the committed public value of a key
+func (tx *Transaction) GetState(key string) ([]byte, error) {
+	return tx.read(publicNamespace, key), nil
+}
+
+// PutState stages a write of a public key
+func (tx *Transaction) PutState(key string, value []byte) error {
+	return tx.put(publicNamespace, key, value)
+}
+
+// DelState stages the deletion of a public key
+func (tx *Transaction) DelState(key string) error {
+	return tx.del(publicNamespace, key)
+}
+
+// SetStateValidationParameter stages the key-level endorsement policy of a public key
+func (tx *Transaction) SetStateValidationParameter(key string, ep []byte) error {
+	return tx.setValidation(publicNamespace, key, ep)
+}
+
+// GetStateValidationParameter returns the committed key-level endorsement policy of a public key
+func (tx *Transaction) GetStateValidationParameter(key string) ([]byte, error) {
+	return tx.readValidation(publicNamespace, key), nil
+}
+
+// GetStateByRange iterates over the public keys in [startKey, endKey)
+func (tx *Transaction) GetStateByRange(startKey, endKey string) (shim.StateQueryIteratorInterface, error) {
+	err := validateSimpleKeys(startKey, endKey)
+	if err != nil {
+		return nil, err
+	}
+	return tx.rangeIterator(publicNamespace, simpleRangeStart(startKey), endKey), nil
+}
+
+// GetStateByRangeWithPagination returns a page of the public keys in [startKey, endKey). The
+// bookmark is the key to resume from, empty once the range is exhausted.
+func (tx *Transaction) GetStateByRangeWithPagination(startKey, endKey string, pageSize int32, bookmark string) (shim.StateQueryIteratorInterface, *pb.QueryResponseMetadata, error) {
+	err := validateSimpleKeys(startKey, endKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	err = tx.checkBeforePaginatedQuery()
+	if err != nil {
+		return nil, nil, err
+	}
+	if bookmark != "" {
+		startKey = bookmark
+	}
+	return tx.rangePage(publicNamespace, simpleRangeStart(startKey), endKey, pageSize)
+}
+
+// GetStateByPartialCompositeKey iterates over the public composite keys that start with the given attributes
+func (tx *Transaction) GetStateByPartialCompositeKey(objectType string, keys []string) (shim.StateQueryIteratorInterface, error) {
+	startKey, err := createCompositeKey(objectType, keys)
+	if err != nil {
+		return nil, err
+	}
+	return tx.rangeIterator(publicNamespace, startKey, startKey+maxUnicodeRune), nil
+}
+
+// GetStateByPartialCompositeKeyWithPagination returns a page of the public composite keys that
+// start with the given attributes
+func (tx *Transaction) GetStateByPartialCompositeKeyWithPagination(objectType string, keys []string, pageSize int32, bookmark string) (shim.StateQueryIteratorInterface, *pb.QueryResponseMetadata, error) {
+	startKey, err := createCompositeKey(objectType, keys)
+	if err != nil {
+		return nil, nil, err
+	}
+	err = tx.checkBeforePaginatedQuery()
+	if err != nil {
+		return nil, nil, err
+	}
+	endKey := startKey + maxUnicodeRune
+	if bookmark != "" {
+		startKey = bookmark
+	}
+	return tx.rangePage(publicNamespace, startKey, endKey, pageSize)
+}
+
+// CreateCompositeKey combines an object type and attributes into a composite key
+func (tx *Transaction) CreateCompositeKey(objectType string, attributes []string) (string, error) {
+	return createCompositeKey(objectType, attributes)
+}
+
+// SplitCompositeKey splits a composite key into its object type and attributes
+func (tx *Transaction) SplitCompositeKey(compositeKey string) (string, []string, error) {
+	return splitCompositeKey(compositeKey)
+}
+
+// GetQueryResult runs a CouchDB query on the public state
+func (tx *Transaction) GetQueryResult(query string) (shim.StateQueryIteratorInterface, error) {
+	results, _, err := tx.query(publicNamespace, query, 0, "")
+	if err != nil {
+		return nil, err
+	}
+	return &stateIterator{results: results}, nil
+}
+
+// GetQueryResultWithPagination runs a CouchDB query on the public state and returns a page of
+// its results. The bookmark is the key of the last result returned, empty once the results are
+// exhausted.
+func (tx *Transaction) GetQueryResultWithPagination(query string, pageSize int32, bookmark string) (shim.StateQueryIteratorInterface, *pb.QueryResponseMetadata, error) {
+	err := tx.checkBeforePaginatedQuery()
+	if err != nil {
+		return nil, nil, err
+	}
+	if pageSize <= 0 {
+		return nil, nil, fmt.Errorf("pageSize must be positive")
+	}
+
+	results, next, err := tx.query(publicNamespace, query, int(pageSize), bookmark)
+	if err != nil {
+		return nil, nil, err
+	}
+	metadata := &pb.QueryResponseMetadata{FetchedRecordsCount: int32(len(results)), Bookmark: next}
+	return &stateIterator{results: results}, metadata, nil
+}
+
+// GetHistoryForKey iterates over the committed modifications of a public key, most recent first
+func (tx *Transaction) GetHistoryForKey(key string) (shim.HistoryQueryIteratorInterface, error) {
+	return &historyIterator{results: tx.ledger.keyHistory(key)}, nil
+}
+
+// GetPrivateData returns the committed value of a key in a collection. The peer must belong to
+// a member of the collection, and so must the client if the collection is memberOnlyRead.
+func (tx *Transaction) GetPrivateData(collection, key string) ([]byte, error) {
+	err := tx.checkReadAccess(collection)
+	if err != nil {
+		return nil, err
+	}
+	return tx.read(collection, key), nil
+}
+
+// GetPrivateDataHash returns the SHA-256 hash of the committed value of a key in a collection.
+// Hashes are held by every peer of the channel, so no membership is required.
+func (tx *Transaction) GetPrivateDataHash(collection, key string) ([]byte, error) {
+	_, err := tx.ledger.Collection(collection)
+	if err != nil {
+		return nil, err
+	}
+
+	value := tx.read(collection, key)
+	if value == nil {
+		return nil, nil
+	}
+	hash := sha256.Sum256(value)
+	return hash[:], nil
+}
+
+// PutPrivateData stages a write of a key in a collection. The client must belong to a member
+// of the collection if it is memberOnlyWrite.
+func (tx *Transaction) PutPrivateData(collection string, key string, value []byte) error {
+	err := tx.checkWriteAccess(collection)
+	if err != nil {
+		return err
+	}
+	return tx.put(collection, key, value)
+}
+
+// DelPrivateData stages the deletion of a key in a collection
+func (tx *Transaction) DelPrivateData(collection, key string) error {
+	err := tx.checkWriteAccess(collection)
+	if err != nil {
+		return err
+	}
+	return tx.del(collection, key)
+}
+
+// SetPrivateDataValidationParameter stages the key-level endorsement policy of a private key
+func (tx *Transaction) SetPrivateDataValidationParameter(collection, key string, ep []byte) error {
+	err := tx.checkWriteAccess(collection)
+	if err != nil {
+		return err
+	}
+	return tx.setValidation(collection, key, ep)
+}
+
+// GetPrivateDataValidationParameter returns the committed key-level endorsement policy of a private key
+func (tx *Transaction) GetPrivateDataValidationParameter(collection, key string) ([]byte, error) {
+	err := tx.checkReadAccess(collection)
+	if err != nil {
+		return nil, err
+	}
+	return tx.readValidation(collection, key), nil
+}
+
+// GetPrivateDataByRange iterates over the keys of a collection in [startKey, endKey)
+func (tx *Transaction) GetPrivateDataByRange(collection, startKey, endKey string) (shim.StateQueryIteratorInterface, error) {
+	err := validateSimpleKeys(startKey, endKey)
+	if err != nil {
+		return nil, err
+	}
+	err = tx.checkBeforePrivateQuery(collection)
+	if err != nil {
+		return nil, err
+	}
+	return tx.rangeIterator(collection, simpleRangeStart(startKey), endKey), nil
+}
+
+// GetPrivateDataByPartialCompositeKey iterates over the composite keys of a collection that
+// start with the given attributes
+func (tx *Transaction) GetPrivateDataByPartialCompositeKey(collection, objectType string, keys []string) (shim.StateQueryIteratorInterface, error) {
+	startKey, err := createCompositeKey(objectType, keys)
+	if err != nil {
+		return nil, err
+	}
+	err = tx.checkBeforePrivateQuery(collection)
+	if err != nil {
+		return nil, err
+	}
+	return tx.rangeIterator(collection, startKey, startKey+maxUnicodeRune), nil
+}
+
+// GetPrivateDataQueryResult runs a CouchDB query on a collection
+func (tx *Transaction) GetPrivateDataQueryResult(collection, query string) (shim.StateQueryIteratorInterface, error) {
+	err := tx.checkBeforePrivateQuery(collection)
+	if err != nil {
+		return nil, err
+	}
+	results, _, err := tx.query(collection, query, 0, "")
+	if err != nil {
+		return nil, err
+	}
+	return &stateIterator{results: results}, nil
+}
+
+// GetCreator is not supported, simulated transactions carry no signed proposal. The client
+// identity is available from GetClientIdentity.
+func (tx *Transaction) GetCreator() ([]byte, error) {
+	return nil, fmt.Errorf("simulated transaction %v has no creator, use GetClientIdentity", tx.txID)
+}
+
+// GetTransient returns the transient map of the transaction
+func (tx *Transaction) GetTransient() (map[string][]byte, error) {
+	transient := map[string][]byte{}
+	for key, value := range tx.transient {
+		transient[key] = value
+	}
+	return transient, nil
+}
+
+// GetBinding is not supported, simulated transactions carry no signed proposal
+func (tx *Transaction) GetBinding() ([]byte, error) {
+	return nil, fmt.Errorf("simulated transaction %v has no binding", tx.txID)
+}
+
+// GetDecorations returns no decorations
+func (tx *Transaction) GetDecorations() map[string][]byte {
+	return map[string][]byte{}
+}
+
+// GetSignedProposal is not supported, simulated transactions carry no signed proposal
+func (tx *Transaction) GetSignedProposal() (*pb.SignedProposal, error) {
+	return nil, fmt.Errorf("simulated transaction %v has no signed proposal", tx.txID)
+}
+
+// GetTxTimestamp returns the timestamp of the transaction, taken from the ledger clock
+func (tx *Transaction) GetTxTimestamp() (*timestamp.Timestamp, error) {
+	return &timestamp.Timestamp{Seconds: tx.timestamp.Unix(), Nanos: int32(tx.timestamp.Nanosecond())}, nil
+}
+
+// SetEvent sets the event of the transaction. As on a peer, only the last event set is emitted.
+func (tx *Transaction) SetEvent(name string, payload []byte) error {
+	if name == "" {
+		return fmt.Errorf("event name can not be empty string")
+	}
+	tx.event = &Event{TxID: tx.txID, Name: name, Payload: payload}
+	return nil
+}
+
+// checkReadAccess checks that the peer holds the private data of the collection and that the
+// client may read it
+func (tx *Transaction) checkReadAccess(collection string) error {
+	definition, err := tx.ledger.Collection(collection)
+	if err != nil {
+		return err
+	}
+	if !definition.IsMember(tx.peerMSP) {
+		return fmt.Errorf("peer of %v is not a member of collection %v and only holds hashes of its private data", tx.peerMSP, collection)
+	}
+	if definition.MemberOnlyRead && !definition.IsMember(tx.client.MSPID()) {
+		return fmt.Errorf("tx creator of %v does not have read access permission on collection %v", tx.client.MSPID(), collection)
+	}
+	return nil
+}
+
+// checkWriteAccess checks that the client may write to the collection
+func (tx *Transaction) checkWriteAccess(collection string) error {
+	definition, err := tx.ledger.Collection(collection)
+	if err != nil {
+		return err
+	}
+	if definition.MemberOnlyWrite && !definition.IsMember(tx.client.MSPID()) {
+		return fmt.Errorf("tx creator of %v does not have write access permission on collection %v", tx.client.MSPID(), collection)
+	}
+	return nil
+}
+
+// checkBeforePrivateQuery enforces that queries on private data are only run by read-only transactions
+func (tx *Transaction) checkBeforePrivateQuery(collection string) error {
+	err := tx.checkReadAccess(collection)
+	if err != nil {
+		return err
+	}
+	if tx.writePerformed {
+		return fmt.Errorf("txid [%s]: queries on private data are supported only in a read-only transaction", tx.txID)
+	}
+	tx.privateQueryPerformed = true
+	return nil
+}
+
+// checkBeforePaginatedQuery enforces that paginated queries are only run by read-only transactions
+func (tx *Transaction) checkBeforePaginatedQuery() error {
+	if tx.writePerformed {
+		return fmt.Errorf("txid [%s]: paginated queries are supported only in a read-only transaction", tx.txID)
+	}
+	tx.paginatedQueryPerformed = true
+	return nil
+}
+
+// checkBeforeWrite rejects writes after queries on private data or paginated queries
+func (tx *Transaction) checkBeforeWrite(key string) error {
+	if tx.committed {
+		return fmt.Errorf("transaction %v has already been committed", tx.txID)
+	}
+	err := validateKey(key)
+	if err != nil {
+		return err
+	}
+	if tx.privateQueryPerformed {
+		return fmt.Errorf("txid [%s]: transaction has already performed queries on private data, writes are not allowed", tx.txID)
+	}
+	if tx.paginatedQueryPerformed {
+		return fmt.Errorf("txid [%s]: transaction has already performed a paginated query, writes are not allowed", tx.txID)
+	}
+	tx.writePerformed = true
+	return nil
+}
+
+// read returns the committed value of a key and records its version in the read set
+func (tx *Transaction) read(namespace string, key string) []byte {
+	e := tx.ledger.get(namespace, key)
+	if e == nil {
+		tx.recordRead(namespace, key, 0)
+		return nil
+	}
+	tx.recordRead(namespace, key, e.version)
+	return e.value
+}
+
+func (tx *Transaction) readValidation(namespace string, key string) []byte {
+	e := tx.ledger.get(namespace, key)
+	if e == nil {
+		return nil
+	}
+	return e.validation
+}
+
+func (tx *Transaction) recordRead(namespace string, key string, version uint64) {
+	keys, ok := tx.reads[namespace]
+	if !ok {
+		keys = map[string]uint64{}
+		tx.reads[namespace] = keys
+	}
+	keys[key] = version
+}
+
+// staged returns the staged write of a key, creating it if needed
+func (tx *Transaction) staged(namespace string, key string) *write {
+	keys, ok := tx.writes[namespace]
+	if !ok {
+		keys = map[string]*write{}
+		tx.writes[namespace] = keys
+	}
+	w, ok := keys[key]
+	if !ok {
+		w = &write{}
+		keys[key] = w
+	}
+	return w
+}
+
+func (tx *Transaction) put(namespace string, key string, value []byte) error {
+	err := tx.checkBeforeWrite(key)
+	if err != nil {
+		return err
+	}
+	w := tx.staged(namespace, key)
+	w.value = append([]byte{}, value...)
+	w.deleted = false
+	w.valueWritten = true
+	return nil
+}
+
+func (tx *Transaction) del(namespace string, key string) error {
+	err := tx.checkBeforeWrite(key)
+	if err != nil {
+		return err
+	}
+	w := tx.staged(namespace, key)
+	w.value = nil
+	w.deleted = true
+	w.valueWritten = true
+	return nil
+}
+
+func (tx *Transaction) setValidation(namespace string, key string, ep []byte) error {
+	err := tx.checkBeforeWrite(key)
+	if err != nil {
+		return err
+	}
+	w := tx.staged(namespace, key)
+	w.validation = append([]byte{}, ep...)
+	w.validationWritten = true
+	return nil
+}
+
+// results converts committed entries to query results and records them in the read set
+func (tx *Transaction) results(namespace string, keys []string, entries []*entry) []*queryresult.KV {
+	results := make([]*queryresult.KV, len(keys))
+	for i, key := range keys {
+		tx.recordRead(namespace, key, entries[i].version)
+		results[i] = &queryresult.KV{Namespace: namespace, Key: key, Value: entries[i].value}
+	}
+	return results
+}
+
+func (tx *Transaction) rangeIterator(namespace string, startKey string, endKey string) *stateIterator {
+	keys, entries := tx.ledger.scan(namespace, startKey, endKey)
+	return &stateIterator{results: tx.results(namespace, keys, entries)}
+}
+
+func (tx *Transaction) rangePage(namespace string, startKey string, endKey string, pageSize int32) (shim.StateQueryIteratorInterface, *pb.QueryResponseMetadata, error) {
+	if pageSize <= 0 {
+		return nil, nil, fmt.Errorf("pageSize must be positive")
+	}
+
+	keys, entries := tx.ledger.scan(namespace, startKey, endKey)
+	bookmark := ""
+	if len(keys) > int(pageSize) {
+		bookmark = keys[pageSize]
+		keys, entries = keys[:pageSize], entries[:pageSize]
+	}
+
+	metadata := &pb.QueryResponseMetadata{FetchedRecordsCount: int32(len(keys)), Bookmark: bookmark}
+	return &stateIterator{results: tx.results(namespace, keys, entries)}, metadata, nil
+}
+
+// query runs a CouchDB query on a namespace. A positive pageSize returns the page after the
+// bookmark together with the bookmark of the next page.
+func (tx *Transaction) query(namespace string, query string, pageSize int, bookmark string) ([]*queryresult.KV, string, error) {
+	parsed, order, err := parseRichQuery(query)
+	if err != nil {
+		return nil, "", err
+	}
+
+	keys, entries := tx.ledger.scan(namespace, "", "")
+	documents := make([]*document, len(keys))
+	for i, key := range keys {
+		documents[i] = parseDocument(key, entries[i].value)
+	}
+	matches, err := parsed.execute(documents, order)
+	if err != nil {
+		return nil, "", err
+	}
+
+	next := ""
+	if pageSize > 0 {
+		if bookmark != "" {
+			position := -1
+			for i, match := range matches {
+				if match.key == bookmark {
+					position = i
+					break
+				}
+			}
+			if position < 0 {
+				return nil, "", fmt.Errorf("invalid bookmark %v", bookmark)
+			}
+			matches = matches[position+1:]
+		}
+		if len(matches) > pageSize {
+			matches = matches[:pageSize]
+			next = matches[pageSize-1].key
+		}
+	}
+
+	versions := map[string]uint64{}
+	for i, key := range keys {
+		versions[key] = entries[i].version
+	}
+	results := make([]*queryresult.KV, len(matches))
+	for i, match := range matches {
+		value, err := parsed.project(match)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to project query result: %v", err)
+		}
+		tx.recordRead(namespace, match.key, versions[match.key])
+		results[i] = &queryresult.KV{Namespace: namespace, Key: match.key, Value: value}
+	}
+	return results, next, nil
+}
+
+// simpleRangeStart substitutes an empty start key, as the shim does, so that a range over
+// simple keys excludes composite keys
+func simpleRangeStart(startKey string) string {
+	if startKey == "" {
+		return "\x01"
+	}
+	return startKey
+}